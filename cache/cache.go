@@ -0,0 +1,109 @@
+// Package cache provide a Cache interface and some implement engine
+// Usage:
+//
+// import(
+//   "libs/cache"
+// )
+//
+// bm, err := cache.NewCache("memory", `{"interval":60}`)
+//
+// Use it like this:
+//
+//	bm.Put(ctx, "astaxie", 1, 10 * time.Second)
+//	bm.Get(ctx, "astaxie")
+//	bm.IsExist(ctx, "astaxie")
+//	bm.Delete(ctx, "astaxie")
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCacheMiss is returned by Get when the key is not cached or has expired.
+var ErrCacheMiss = errors.New("cache: key not found")
+
+// Cache interface contains all behaviors for cache adapter.
+// usage:
+//	cache.Register("memory", func() cache.Cache { return NewMemoryCache() }) // run in init of memory.go.
+//	c,err := cache.NewCache("memory",`{"interval":60}`)
+//	c.Put(ctx, "key",value, 3600 * time.Second)
+//	v, err := c.Get(ctx, "key")
+//
+//	c.Incr(ctx, "counter")  // now is 1
+//	c.Incr(ctx, "counter")  // now is 2
+//	count, _ := c.Get(ctx, "counter")
+type Cache interface {
+	// get cached value by key, ErrCacheMiss if it does not exist.
+	Get(ctx context.Context, key string) (interface{}, error)
+	// GetMulti is a batch version of Get, missing keys are nil in the result.
+	GetMulti(ctx context.Context, keys []string) ([]interface{}, error)
+	// set cached value with key and expire time, a timeout of 0 stores it forever.
+	Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error
+	// delete cached value by key, deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// increase cached int value by key, as a counter.
+	Incr(ctx context.Context, key string) error
+	// decrease cached int value by key, as a counter.
+	Decr(ctx context.Context, key string) error
+	// check if cached value exists or not.
+	IsExist(ctx context.Context, key string) (bool, error)
+	// clear all cache.
+	ClearAll(ctx context.Context) error
+	// start gc routine based on config string settings.
+	StartAndGC(config string) error
+}
+
+// TagCache is implemented by the adapters able to invalidate many entries at once.
+// usage:
+//	tc := c.(cache.TagCache)
+//	tc.PutWithTags(ctx, "profile:42", value, time.Hour, "user:42")
+//	tc.PutWithTags(ctx, "orders:42", orders, time.Hour, "user:42", "orders")
+//	tc.InvalidateTags(ctx, "user:42")   // deletes profile:42 and orders:42
+//	tc.DeletePrefix(ctx, "orders:")
+type TagCache interface {
+	Cache
+	// PutWithTags puts val like Put and attaches tags to it.
+	PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error
+	// InvalidateTags deletes the entries having one of tags.
+	InvalidateTags(ctx context.Context, tags ...string) error
+	// DeletePrefix deletes the entries whose key starts with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// Instance is a function create a new Cache Instance
+type Instance func() Cache
+
+var adapters = make(map[string]Instance)
+
+// Register makes a cache adapter available by the adapter name.
+// If Register is called twice with the same name or if driver is nil,
+// it panics.
+func Register(name string, adapter Instance) {
+	if adapter == nil {
+		panic("cache: Register adapter is nil")
+	}
+	if _, ok := adapters[name]; ok {
+		panic("cache: Register called twice for adapter " + name)
+	}
+	adapters[name] = adapter
+}
+
+// NewCache Create a new cache driver by adapter name and config string.
+// config need to be correct JSON as string: {"interval":360}.
+// it will start gc automatically.
+func NewCache(adapterName, config string) (adapter Cache, err error) {
+	instanceFunc, ok := adapters[adapterName]
+	if !ok {
+		err = fmt.Errorf("cache: unknown adapter name %q (forgot to import?)", adapterName)
+		return
+	}
+	adapter = instanceFunc()
+	err = adapter.StartAndGC(config)
+	if err != nil {
+		adapter = nil
+	}
+	return
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"libs/clock"
+)
+
+func TestNewCacheUnknownAdapter(t *testing.T) {
+	if _, err := NewCache("unknown", `{}`); err == nil {
+		t.Error("unknown adapter should return error")
+	}
+}
+
+// TestCacheContract checks the adapters agree on a timeout of 0 and the delete of a missing key.
+func TestCacheContract(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	for name, config := range map[string]string{
+		"memory":        `{"interval":60}`,
+		"shardedmemory": `{"interval":60}`,
+		"redis":         `{"conn":"` + s.Addr() + `"}`,
+	} {
+		bm, err := NewCache(name, config)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if err = bm.Put(ctx, "forever", "a", 0); err != nil {
+			t.Error(name, "Put with timeout 0", err)
+		}
+		if ok, _ := bm.IsExist(ctx, "forever"); !ok {
+			t.Error(name, "a timeout of 0 stores forever")
+		}
+		if err = bm.Put(ctx, "short", "a", 1500*time.Millisecond); err != nil {
+			t.Error(name, "Put with a timeout below a second", err)
+		}
+		if err = bm.Delete(ctx, "missing"); err != nil {
+			t.Error(name, "Delete of a missing key", err)
+		}
+	}
+	if ttl := s.TTL("forever"); ttl != 0 {
+		t.Error("redis should store forever", ttl)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	bm, err := NewCache("memory", `{"interval":20}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	timeoutDuration := 10 * time.Second
+	if err = bm.Put(ctx, "astaxie", 1, timeoutDuration); err != nil {
+		t.Error("set Error", err)
+	}
+	if ok, _ := bm.IsExist(ctx, "astaxie"); !ok {
+		t.Error("check err")
+	}
+	if v, _ := bm.Get(ctx, "astaxie"); v.(int) != 1 {
+		t.Error("get err")
+	}
+
+	if err = bm.Incr(ctx, "astaxie"); err != nil {
+		t.Error("Incr Error", err)
+	}
+	if v, _ := bm.Get(ctx, "astaxie"); v.(int) != 2 {
+		t.Error("get err")
+	}
+	if err = bm.Decr(ctx, "astaxie"); err != nil {
+		t.Error("Decr Error", err)
+	}
+	if v, _ := bm.Get(ctx, "astaxie"); v.(int) != 1 {
+		t.Error("get err")
+	}
+
+	if err = bm.Put(ctx, "astaxie1", "author1", timeoutDuration); err != nil {
+		t.Error("set Error", err)
+	}
+	vv, err := bm.GetMulti(ctx, []string{"astaxie", "astaxie1", "astaxie2"})
+	if err != nil || len(vv) != 3 {
+		t.Error("GetMulti ERROR", err)
+	}
+	if vv[1].(string) != "author1" || vv[2] != nil {
+		t.Error("GetMulti ERROR")
+	}
+
+	bm.Delete(ctx, "astaxie")
+	if ok, _ := bm.IsExist(ctx, "astaxie"); ok {
+		t.Error("delete err")
+	}
+	if _, err = bm.Get(ctx, "astaxie"); err != ErrCacheMiss {
+		t.Error("miss should return ErrCacheMiss", err)
+	}
+	if err = bm.Incr(ctx, "astaxie"); err != ErrCacheMiss {
+		t.Error("Incr on missing key should return ErrCacheMiss", err)
+	}
+
+	if err = bm.ClearAll(ctx); err != nil {
+		t.Error("clear all err")
+	}
+	if ok, _ := bm.IsExist(ctx, "astaxie1"); ok {
+		t.Error("clear all err")
+	}
+}
+
+func TestMemoryCacheExpire(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	bm := NewMemoryCache()
+	bm.SetClock(c)
+	ctx := context.Background()
+	if err := bm.Put(ctx, "astaxie", 1, time.Minute); err != nil {
+		t.Error("set Error", err)
+	}
+	c.Advance(30 * time.Second)
+	if v, err := bm.Get(ctx, "astaxie"); err != nil || v != 1 {
+		t.Error("key expired too early", v, err)
+	}
+	c.Advance(time.Minute)
+	if _, err := bm.Get(ctx, "astaxie"); err != ErrCacheMiss {
+		t.Error("expired key should return ErrCacheMiss", err)
+	}
+}
+
+func TestMemoryCacheGC(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	bm := NewMemoryCache()
+	bm.SetClock(c)
+	expired := make(chan string, 1)
+	bm.OnEvicted(func(key string, val interface{}) { expired <- key })
+	ctx := context.Background()
+	bm.Put(ctx, "astaxie", 1, time.Minute)
+	if err := bm.StartAndGC(`{"interval":60}`); err != nil {
+		t.Fatal(err)
+	}
+	for c.Waiters() == 0 {
+		runtime.Gosched()
+	}
+	c.Advance(2 * time.Minute)
+	select {
+	case key := <-expired:
+		if key != "astaxie" {
+			t.Error("gc removed", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("gc did not remove the expired key")
+	}
+}
+
+func TestMemoryCacheUpdate(t *testing.T) {
+	bm := NewMemoryCache()
+	ctx := context.Background()
+	incr := func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		if !exist {
+			return 1, time.Minute, nil
+		}
+		return val.(int) + 1, time.Minute, nil
+	}
+	bm.Update(ctx, "counter", incr)
+	bm.Update(ctx, "counter", incr)
+	if v, _ := bm.Get(ctx, "counter"); v.(int) != 2 {
+		t.Error("Update err", v)
+	}
+
+	errKeep := errors.New("keep")
+	err := bm.Update(ctx, "counter", func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		return nil, 0, errKeep
+	})
+	if err != errKeep {
+		t.Error("Update should return the error of fn", err)
+	}
+	if v, _ := bm.Get(ctx, "counter"); v.(int) != 2 {
+		t.Error("Update error should leave the item unchanged", v)
+	}
+
+	bm.Update(ctx, "counter", func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		return nil, 0, nil
+	})
+	if ok, _ := bm.IsExist(ctx, "counter"); ok {
+		t.Error("nil value should delete the item")
+	}
+}
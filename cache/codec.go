@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Codec encodes values before they are stored and decodes them back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Compressor compresses encoded values above the configured threshold.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecs      = make(map[string]Codec)
+	compressors = make(map[string]compressorEntry)
+)
+
+type compressorEntry struct {
+	id byte
+	Compressor
+}
+
+// RegisterCodec makes a codec available by the provided name.
+// If RegisterCodec is called twice with the same name or if codec is nil,
+// it panics.
+func RegisterCodec(name string, codec Codec) {
+	if codec == nil {
+		panic("cache: RegisterCodec codec is nil")
+	}
+	if _, dup := codecs[name]; dup {
+		panic("cache: RegisterCodec called twice for codec " + name)
+	}
+	codecs[name] = codec
+}
+
+// RegisterCompressor makes a compressor available by the provided name.
+// id is written in front of compressed values and must be unique and not 0.
+// If RegisterCompressor is called twice with the same name or id or if c is nil,
+// it panics.
+func RegisterCompressor(name string, id byte, c Compressor) {
+	if c == nil {
+		panic("cache: RegisterCompressor compressor is nil")
+	}
+	if id == 0 {
+		panic("cache: RegisterCompressor id 0 is reserved")
+	}
+	for n, e := range compressors {
+		if n == name || e.id == id {
+			panic("cache: RegisterCompressor called twice for compressor " + name)
+		}
+	}
+	compressors[name] = compressorEntry{id: id, Compressor: c}
+}
+
+// GetCodec returns the codec registered with name.
+func GetCodec(name string) (Codec, error) {
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("cache: unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// compressedMark starts every compressed value, followed by the compressor id.
+// none of the codecs produce a value starting with a zero byte and longer than one byte.
+const compressedMark = 0
+
+// valueCodec encodes values with a codec and compresses the ones
+// larger than threshold.
+type valueCodec struct {
+	codec      Codec
+	compressor *compressorEntry
+	threshold  int
+}
+
+// newValueCodec returns a valueCodec for the codec and compressor names,
+// an empty compressor name disables compression.
+func newValueCodec(codecName, compressorName string, threshold int) (*valueCodec, error) {
+	if codecName == "" {
+		codecName = "json"
+	}
+	codec, err := GetCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+	vc := &valueCodec{codec: codec, threshold: threshold}
+	if compressorName != "" {
+		c, ok := compressors[compressorName]
+		if !ok {
+			return nil, fmt.Errorf("cache: unknown compressor %q", compressorName)
+		}
+		vc.compressor = &c
+	}
+	return vc, nil
+}
+
+func (vc *valueCodec) encode(v interface{}) ([]byte, error) {
+	data, err := vc.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if vc.compressor == nil || len(data) <= vc.threshold {
+		return data, nil
+	}
+	compressed, err := vc.compressor.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{compressedMark, vc.compressor.id}, compressed...), nil
+}
+
+func (vc *valueCodec) decode(data []byte, v interface{}) error {
+	if len(data) > 2 && data[0] == compressedMark {
+		var c Compressor
+		for _, e := range compressors {
+			if e.id == data[1] {
+				c = e.Compressor
+				break
+			}
+		}
+		if c == nil {
+			return fmt.Errorf("cache: unknown compressor id %d", data[1])
+		}
+		var err error
+		if data, err = c.Decompress(data[2:]); err != nil {
+			return err
+		}
+	}
+	return vc.codec.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+type protobufCodec struct{}
+
+var errNotProtoMessage = errors.New("cache: value does not implement proto.Message")
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func init() {
+	RegisterCodec("json", jsonCodec{})
+	RegisterCodec("gob", gobCodec{})
+	RegisterCodec("msgpack", msgpackCodec{})
+	RegisterCodec("protobuf", protobufCodec{})
+	RegisterCompressor("snappy", 1, snappyCompressor{})
+	RegisterCompressor("gzip", 2, gzipCompressor{})
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+)
+
+type codecUser struct {
+	Name string
+	Age  int
+}
+
+func TestValueCodec(t *testing.T) {
+	for _, name := range []string{"json", "gob", "msgpack"} {
+		for _, compress := range []string{"", "snappy", "gzip"} {
+			vc, err := newValueCodec(name, compress, 16)
+			if err != nil {
+				t.Fatal(name, compress, err)
+			}
+			for _, in := range []codecUser{{"astaxie", 30}, {strings.Repeat("astaxie", 100), 30}} {
+				data, err := vc.encode(in)
+				if err != nil {
+					t.Error(name, compress, "encode err", err)
+					continue
+				}
+				var out codecUser
+				if err = vc.decode(data, &out); err != nil || out != in {
+					t.Error(name, compress, "decode err", err)
+				}
+			}
+		}
+	}
+}
+
+func TestValueCodecCompressThreshold(t *testing.T) {
+	vc, _ := newValueCodec("json", "snappy", 64)
+	small, _ := vc.encode("astaxie")
+	if small[0] == compressedMark {
+		t.Error("small value should not be compressed")
+	}
+	large, _ := vc.encode(strings.Repeat("astaxie", 100))
+	if large[0] != compressedMark || len(large) > 700 {
+		t.Error("large value should be compressed")
+	}
+
+	// a reader without compression configured still reads compressed values.
+	plain, _ := newValueCodec("json", "", 0)
+	var s string
+	if err := plain.decode(large, &s); err != nil || s != strings.Repeat("astaxie", 100) {
+		t.Error("decode compressed value err", err)
+	}
+}
+
+func TestValueCodecProtobuf(t *testing.T) {
+	vc, _ := newValueCodec("protobuf", "gzip", 0)
+	data, err := vc.encode(&types.StringValue{Value: "astaxie"})
+	if err != nil {
+		t.Fatal("encode err", err)
+	}
+	var out types.StringValue
+	if err = vc.decode(data, &out); err != nil || out.Value != "astaxie" {
+		t.Error("decode err", err)
+	}
+	if _, err = vc.encode(codecUser{}); err == nil {
+		t.Error("non proto value should return error")
+	}
+}
+
+func TestValueCodecUnknown(t *testing.T) {
+	if _, err := newValueCodec("xml", "", 0); err == nil {
+		t.Error("unknown codec should return error")
+	}
+	if _, err := newValueCodec("json", "lzma", 0); err == nil {
+		t.Error("unknown compressor should return error")
+	}
+}
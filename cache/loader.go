@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/gob"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a LoadFunc when the value does not exist
+// in the source. the Loader can cache this negative result.
+var ErrNotFound = errors.New("cache: value not found")
+
+var errLoadPanic = errors.New("cache: load panicked")
+
+// negativeMark is the encoded form of negativeValue.
+var negativeMark = []byte("\x00cache:not-found")
+
+// negativeValue is stored in the cache for negative results.
+// the caches holding Go values return it as is, the others store negativeMark
+// whichever way they encode it: redigo argument, binary, sql or gob value.
+type negativeValue struct{}
+
+func (negativeValue) RedisArg() interface{}          { return negativeMark }
+func (negativeValue) MarshalBinary() ([]byte, error) { return negativeMark, nil }
+func (negativeValue) Value() (driver.Value, error)   { return negativeMark, nil }
+func (negativeValue) GobEncode() ([]byte, error)     { return negativeMark, nil }
+func (*negativeValue) GobDecode(data []byte) error   { return nil }
+
+// LoadFunc loads the value of key on a cache miss.
+type LoadFunc func(ctx context.Context, key string) (interface{}, error)
+
+// Loader is a read-through cache over any Cache adapter.
+// concurrent loads of the same key are merged into one call,
+// ErrNotFound results are cached for NegativeTTL,
+// and values are refreshed in the background shortly before they expire.
+// usage:
+//
+//	loader := cache.NewLoader(bm)
+//	v, err := loader.GetOrLoad(ctx, "user:42", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+//		return queryUser(ctx, 42)
+//	})
+type Loader struct {
+	cache Cache
+	group group
+
+	// NegativeTTL is how long ErrNotFound results are cached, 0 disables it.
+	NegativeTTL time.Duration
+	// Beta scales the early refresh probability, 0 disables early refresh.
+	// 1 is the default, larger values refresh earlier.
+	Beta float64
+
+	mu        sync.Mutex
+	meta      map[string]loadMeta
+	nextSweep int
+}
+
+// loadMeta records when a value expires and how long it took to load.
+type loadMeta struct {
+	expire time.Time
+	delta  time.Duration
+}
+
+// NewLoader returns a Loader reading through c.
+func NewLoader(c Cache) *Loader {
+	return &Loader{
+		cache:     c,
+		Beta:      1,
+		meta:      make(map[string]loadMeta),
+		nextSweep: 1024,
+	}
+}
+
+// GetOrLoad returns the cached value of key.
+// on a cache miss it calls load, caches the result for ttl and returns it.
+func (l *Loader) GetOrLoad(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	v, err := l.cache.Get(ctx, key)
+	if err == nil {
+		if isNegative(v) {
+			return nil, ErrNotFound
+		}
+		if l.shouldRefresh(key) && !l.group.inFlight(key) {
+			go l.refresh(key, ttl, load)
+		}
+		return v, nil
+	}
+	if err != ErrCacheMiss {
+		return nil, err
+	}
+	return l.group.do(key, func() (interface{}, error) {
+		return l.load(ctx, key, ttl, load)
+	})
+}
+
+// refresh reloads key in the background, a panic of load is a failed refresh
+// as no caller would receive it.
+func (l *Loader) refresh(key string, ttl time.Duration, load LoadFunc) {
+	defer func() {
+		recover()
+	}()
+	l.group.do(key, func() (interface{}, error) {
+		return l.load(context.Background(), key, ttl, load)
+	})
+}
+
+// load calls load and stores the result in the cache.
+func (l *Loader) load(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (interface{}, error) {
+	start := time.Now()
+	v, err := load(ctx, key)
+	if err == ErrNotFound {
+		if l.NegativeTTL > 0 {
+			l.cache.Put(ctx, key, negativeValue{}, l.NegativeTTL)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = l.cache.Put(ctx, key, v, ttl); err == nil && ttl > 0 {
+		l.record(key, loadMeta{expire: time.Now().Add(ttl), delta: time.Since(start)})
+	}
+	return v, nil
+}
+
+// shouldRefresh decides whether to refresh key before it expires,
+// following the probabilistic early expiration of "Optimal Probabilistic Cache Stampede Prevention".
+func (l *Loader) shouldRefresh(key string) bool {
+	if l.Beta <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	m, ok := l.meta[key]
+	l.mu.Unlock()
+	if !ok {
+		return false
+	}
+	gap := time.Duration(float64(m.delta) * l.Beta * -math.Log(1-rand.Float64()))
+	return !time.Now().Add(gap).Before(m.expire)
+}
+
+// record saves m for key and drops the metadata of expired keys from time to time.
+func (l *Loader) record(key string, m loadMeta) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.meta[key] = m
+	if len(l.meta) < l.nextSweep {
+		return
+	}
+	now := time.Now()
+	for k, v := range l.meta {
+		if now.After(v.expire) {
+			delete(l.meta, k)
+		}
+	}
+	l.nextSweep = 2 * len(l.meta)
+	if l.nextSweep < 1024 {
+		l.nextSweep = 1024
+	}
+}
+
+func isNegative(v interface{}) bool {
+	switch s := v.(type) {
+	case negativeValue, *negativeValue:
+		return true
+	case string:
+		return s == string(negativeMark)
+	case []byte:
+		return bytes.Equal(s, negativeMark)
+	}
+	return false
+}
+
+// call is an in-flight or completed group.do call.
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// group merges concurrent calls with the same key into one.
+type group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// inFlight reports whether a call with key is running.
+func (g *group) inFlight(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.m[key]
+	return ok
+}
+
+// do executes fn once for all concurrent callers with the same key
+// and returns its result to all of them.
+func (g *group) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		c.wg.Done()
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+	}()
+	// waiters see this error if fn panics.
+	c.err = errLoadPanic
+	c.val, c.err = fn()
+	return c.val, c.err
+}
+
+func init() {
+	gob.Register(negativeValue{})
+}
@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLoaderGetOrLoad(t *testing.T) {
+	bm := NewMemoryCache()
+	loader := NewLoader(bm)
+	ctx := context.Background()
+
+	var calls int32
+	release := make(chan struct{})
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value of " + key, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := loader.GetOrLoad(ctx, "astaxie", time.Minute, load)
+			if err != nil || v.(string) != "value of astaxie" {
+				t.Error("GetOrLoad err", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("concurrent loads should be merged, got", n)
+	}
+
+	// served from the cache now.
+	if v, err := loader.GetOrLoad(ctx, "astaxie", time.Minute, load); err != nil || v.(string) != "value of astaxie" {
+		t.Error("GetOrLoad err", v, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("cached value should not be loaded again, got", n)
+	}
+}
+
+func TestLoaderNegative(t *testing.T) {
+	bm := NewMemoryCache()
+	loader := NewLoader(bm)
+	loader.NegativeTTL = time.Minute
+	ctx := context.Background()
+
+	calls := 0
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		calls++
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := loader.GetOrLoad(ctx, "missing", time.Minute, load); err != ErrNotFound {
+			t.Error("should return ErrNotFound", err)
+		}
+	}
+	if calls != 1 {
+		t.Error("negative result should be cached, got", calls)
+	}
+}
+
+func TestLoaderError(t *testing.T) {
+	bm := NewMemoryCache()
+	loader := NewLoader(bm)
+	ctx := context.Background()
+
+	errDB := errors.New("db down")
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		return nil, errDB
+	}
+	if _, err := loader.GetOrLoad(ctx, "astaxie", time.Minute, load); err != errDB {
+		t.Error("load error should be returned", err)
+	}
+	if ok, _ := bm.IsExist(ctx, "astaxie"); ok {
+		t.Error("load error should not be cached")
+	}
+}
+
+func TestLoaderEarlyRefresh(t *testing.T) {
+	bm := NewMemoryCache()
+	loader := NewLoader(bm)
+	ctx := context.Background()
+
+	var calls int32
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return 1, nil
+	}
+	loader.GetOrLoad(ctx, "astaxie", time.Minute, load)
+	// pretend the value is about to expire and took long to load.
+	loader.record("astaxie", loadMeta{expire: time.Now(), delta: time.Second})
+	loader.GetOrLoad(ctx, "astaxie", time.Minute, load)
+	for i := 0; i < 100 && atomic.LoadInt32(&calls) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Error("value should be refreshed early, got", n)
+	}
+
+	// no refresh is started while one is in flight.
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	slow := func(ctx context.Context, key string) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return 2, nil
+	}
+	loader.record("astaxie", loadMeta{expire: time.Now(), delta: time.Second})
+	loader.GetOrLoad(ctx, "astaxie", time.Minute, slow)
+	<-started
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		loader.GetOrLoad(ctx, "astaxie", time.Minute, slow)
+	}
+	if n := runtime.NumGoroutine() - before; n > 0 {
+		t.Error("refreshes started while one is in flight", n)
+	}
+	close(release)
+}
+
+func TestLoaderRefreshPanic(t *testing.T) {
+	bm := NewMemoryCache()
+	loader := NewLoader(bm)
+	ctx := context.Background()
+	loader.GetOrLoad(ctx, "astaxie", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+		return 1, nil
+	})
+
+	// a panic in an early refresh does not crash the process.
+	done := make(chan struct{})
+	loader.record("astaxie", loadMeta{expire: time.Now(), delta: time.Second})
+	v, err := loader.GetOrLoad(ctx, "astaxie", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+		defer close(done)
+		panic("load failed")
+	})
+	if v != 1 || err != nil {
+		t.Error("the cached value should be returned", v, err)
+	}
+	<-done
+	for i := 0; i < 100 && loader.group.inFlight("astaxie"); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ = bm.Get(ctx, "astaxie"); v != 1 {
+		t.Error("a failed refresh should keep the cached value", v)
+	}
+}
+
+func TestLoaderNegativeEncoded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		return nil, ErrNotFound
+	}
+	fail := func(ctx context.Context, key string) (interface{}, error) {
+		t.Error("negative result of " + key + " should be cached")
+		return nil, ErrNotFound
+	}
+
+	// the memory cache snapshots its values with gob, redis stores bytes.
+	snapshot := `{"interval":60,"snapshot":"` + filepath.Join(dir, "memory.snap") + `"}`
+	for name, open := range map[string]func() (Cache, error){
+		"memory": func() (Cache, error) { return NewCache("memory", snapshot) },
+		"redis":  func() (Cache, error) { return NewCache("redis", `{"key":"loader","conn":"`+s.Addr()+`"}`) },
+	} {
+		bm, err := open()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		loader := NewLoader(bm)
+		loader.NegativeTTL = time.Minute
+		if _, err = loader.GetOrLoad(ctx, "missing", time.Minute, load); err != ErrNotFound {
+			t.Error(name, "should return ErrNotFound", err)
+		}
+		bm.Put(ctx, "braces", "{}", time.Minute)
+		if mc, ok := bm.(*MemoryCache); ok {
+			if err = mc.Snapshot(); err != nil {
+				t.Fatal(name, err)
+			}
+			mc.Close()
+		}
+
+		if bm, err = open(); err != nil {
+			t.Fatal(name, err)
+		}
+		loader = NewLoader(bm)
+		if _, err = loader.GetOrLoad(ctx, "missing", time.Minute, fail); err != ErrNotFound {
+			t.Error(name, "should return the cached ErrNotFound", err)
+		}
+		if _, err = loader.GetOrLoad(ctx, "braces", time.Minute, fail); err != nil {
+			t.Error(name, "a value is not a negative result", err)
+		}
+		if mc, ok := bm.(*MemoryCache); ok {
+			mc.Close()
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Package lock provides a distributed mutex on top of the cache adapters.
+//
+// Usage:
+// import(
+//   "libs/cache"
+//   "libs/cache/lock"
+// )
+//
+//	rc, _ := cache.NewCache("redis", `{"conn":"127.0.0.1:6379"}`)
+//	m := lock.NewMutex(lock.NewRedisAdapter(rc.(*cache.RedisCache)), "cron:report", 30*time.Second)
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	if err := m.Lock(ctx); err != nil {
+//		return err
+//	}
+//	defer m.Unlock(context.Background())
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotHeld is returned by Unlock when the mutex is not locked.
+	ErrNotHeld = errors.New("lock: mutex is not held")
+	// ErrLockLost is returned by Unlock when the lease expired
+	// and the lock was taken by someone else.
+	ErrLockLost = errors.New("lock: lease lost")
+)
+
+var (
+	// DefaultRetryDelay is the delay between two attempts of Lock.
+	DefaultRetryDelay = 100 * time.Millisecond
+)
+
+// Adapter stores the lock keys in a cache backend.
+// the token identifies the owner, only the owner can release or refresh the lock.
+type Adapter interface {
+	// Acquire sets key to token with ttl if key does not exist.
+	Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Release deletes key if it holds token.
+	Release(ctx context.Context, key, token string) (bool, error)
+	// Refresh resets the ttl of key if it holds token.
+	Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+}
+
+// Mutex is a distributed mutual exclusion lock.
+// while it is held, the lease is renewed every ttl/3 in the background.
+type Mutex struct {
+	adapter Adapter
+	key     string
+	ttl     time.Duration
+
+	// RetryDelay is the delay between two attempts of Lock.
+	RetryDelay time.Duration
+
+	mu    sync.Mutex
+	token string
+	stop  chan struct{}
+	done  chan struct{}
+	lost  chan struct{}
+}
+
+// NewMutex returns a Mutex for key, the lease lasts ttl unless renewed.
+func NewMutex(adapter Adapter, key string, ttl time.Duration) *Mutex {
+	return &Mutex{
+		adapter:    adapter,
+		key:        key,
+		ttl:        ttl,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// TryLock tries to acquire the lock once.
+func (m *Mutex) TryLock(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token != "" {
+		return false, nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return false, err
+	}
+	ok, err := m.adapter.Acquire(ctx, m.key, token, m.ttl)
+	if err != nil || !ok {
+		return false, err
+	}
+	m.token = token
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	m.lost = make(chan struct{})
+	go m.renew(token, m.stop, m.done, m.lost)
+	return true, nil
+}
+
+// Lock blocks until the lock is acquired or ctx is done.
+func (m *Mutex) Lock(ctx context.Context) error {
+	for {
+		ok, err := m.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.RetryDelay):
+		}
+	}
+}
+
+// Unlock stops the lease renewal and releases the lock.
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token == "" {
+		return ErrNotHeld
+	}
+	close(m.stop)
+	<-m.done
+	token := m.token
+	m.token = ""
+	m.lost = nil
+	ok, err := m.adapter.Release(ctx, m.key, token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Lost returns a channel closed when the lease could not be renewed,
+// the work protected by the lock should be stopped then.
+// it returns nil if the mutex is not held.
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
+// renew refreshes the lease every ttl/3 until stop is closed.
+func (m *Mutex) renew(token string, stop, done, lost chan struct{}) {
+	defer close(done)
+	interval := m.ttl / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			ok, err := m.adapter.Refresh(ctx, m.key, token, m.ttl)
+			cancel()
+			if err == nil && ok {
+				renewed = time.Now()
+				continue
+			}
+			// the key was taken over, or errors lasted until the lease expired.
+			if err == nil || time.Since(renewed) >= m.ttl {
+				close(lost)
+				return
+			}
+		}
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,225 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"libs/cache"
+	"libs/cache/ssdb"
+	"libs/clock"
+	"libs/internal/ssdbtest"
+)
+
+func TestMutex(t *testing.T) {
+	adapter := NewMemoryAdapter(cache.NewMemoryCache())
+	ctx := context.Background()
+	m1 := NewMutex(adapter, "cron", time.Second)
+	m2 := NewMutex(adapter, "cron", time.Second)
+
+	if ok, err := m1.TryLock(ctx); !ok || err != nil {
+		t.Fatal("TryLock err", err)
+	}
+	if ok, _ := m2.TryLock(ctx); ok {
+		t.Error("lock is held by m1")
+	}
+	if err := m2.Unlock(ctx); err != ErrNotHeld {
+		t.Error("Unlock of a mutex not held should return ErrNotHeld", err)
+	}
+	if err := m1.Unlock(ctx); err != nil {
+		t.Error("Unlock err", err)
+	}
+	if ok, _ := m2.TryLock(ctx); !ok {
+		t.Error("lock should be free after Unlock")
+	}
+	m2.Unlock(ctx)
+}
+
+func TestMutexLockTimeout(t *testing.T) {
+	adapter := NewMemoryAdapter(cache.NewMemoryCache())
+	m1 := NewMutex(adapter, "cron", time.Second)
+	m2 := NewMutex(adapter, "cron", time.Second)
+	m2.RetryDelay = 5 * time.Millisecond
+
+	m1.Lock(context.Background())
+	defer m1.Unlock(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := m2.Lock(ctx); err != context.DeadlineExceeded {
+		t.Error("Lock should wait until ctx is done", err)
+	}
+}
+
+func TestMutexRenew(t *testing.T) {
+	adapter := NewMemoryAdapter(cache.NewMemoryCache())
+	ctx := context.Background()
+	m1 := NewMutex(adapter, "cron", 30*time.Millisecond)
+	m1.Lock(ctx)
+	// the lease is renewed while the work is running.
+	time.Sleep(100 * time.Millisecond)
+	m2 := NewMutex(adapter, "cron", time.Second)
+	if ok, _ := m2.TryLock(ctx); ok {
+		t.Error("lease should have been renewed")
+	}
+	select {
+	case <-m1.Lost():
+		t.Error("lease should not be lost")
+	default:
+	}
+	if err := m1.Unlock(ctx); err != nil {
+		t.Error("Unlock err", err)
+	}
+}
+
+func TestMutexLost(t *testing.T) {
+	mc := cache.NewMemoryCache()
+	adapter := NewMemoryAdapter(mc)
+	ctx := context.Background()
+	m := NewMutex(adapter, "cron", 30*time.Millisecond)
+	m.Lock(ctx)
+	// someone else takes over the key.
+	mc.Put(ctx, "cron", "other", 0)
+	select {
+	case <-m.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost lease should be reported")
+	}
+	if err := m.Unlock(ctx); err != ErrLockLost {
+		t.Error("Unlock of a lost lease should return ErrLockLost", err)
+	}
+}
+
+func TestMutexConcurrent(t *testing.T) {
+	adapter := NewMemoryAdapter(cache.NewMemoryCache())
+	var (
+		wg      sync.WaitGroup
+		holders int
+		mu      sync.Mutex
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := NewMutex(adapter, "cron", time.Second)
+			m.RetryDelay = time.Millisecond
+			if err := m.Lock(context.Background()); err != nil {
+				t.Error("Lock err", err)
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > 1 {
+				t.Error("two holders at the same time")
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			m.Unlock(context.Background())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRedisMutex(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	bm, err := cache.NewCache("redis", `{"key":"lock","conn":"`+s.Addr()+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := NewRedisAdapter(bm.(*cache.RedisCache))
+	ctx := context.Background()
+	m1 := NewMutex(adapter, "cron", time.Second)
+	m2 := NewMutex(adapter, "cron", time.Second)
+	if ok, err := m1.TryLock(ctx); !ok || err != nil {
+		t.Fatal("TryLock err", err)
+	}
+	if ok, _ := m2.TryLock(ctx); ok {
+		t.Error("lock is held by m1")
+	}
+	if err = m1.Unlock(ctx); err != nil {
+		t.Error("Unlock err", err)
+	}
+}
+
+func newSSDBAdapter(t *testing.T, c *clock.Fake) (*SSDBAdapter, *ssdbtest.Server) {
+	fs, err := ssdbtest.NewServer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := ssdb.NewSSDB()
+	if err = sd.StartAndGC(fs.Config()); err != nil {
+		fs.Close()
+		t.Fatal(err)
+	}
+	return NewSSDBAdapter(sd), fs
+}
+
+func TestSSDBAdapter(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	adapter, fs := newSSDBAdapter(t, c)
+	defer fs.Close()
+	ctx := context.Background()
+
+	if ok, err := adapter.Acquire(ctx, "cron", "t1", time.Second); !ok || err != nil {
+		t.Fatal("Acquire err", ok, err)
+	}
+	if ok, err := adapter.Acquire(ctx, "cron", "t2", time.Second); ok || err != nil {
+		t.Error("lock is held by t1", ok, err)
+	}
+	if ok, err := adapter.Refresh(ctx, "cron", "t2", time.Second); ok || err != nil {
+		t.Error("Refresh with a wrong token should fail", ok, err)
+	}
+	if ok, err := adapter.Release(ctx, "cron", "t2"); ok || err != nil {
+		t.Error("Release with a wrong token should fail", ok, err)
+	}
+	if ok, err := adapter.Refresh(ctx, "cron", "t1", time.Minute); !ok || err != nil {
+		t.Error("Refresh err", ok, err)
+	}
+	if ok, err := adapter.Release(ctx, "cron", "t1"); !ok || err != nil {
+		t.Error("Release err", ok, err)
+	}
+
+	// an expired lease is neither held nor an error.
+	adapter.Acquire(ctx, "cron", "t1", time.Second)
+	c.Advance(2 * time.Second)
+	if ok, err := adapter.Refresh(ctx, "cron", "t1", time.Second); ok || err != nil {
+		t.Error("Refresh of an expired lease should return false", ok, err)
+	}
+	if ok, err := adapter.Release(ctx, "cron", "t1"); ok || err != nil {
+		t.Error("Release of an expired lease should return false", ok, err)
+	}
+	if ok, err := adapter.Acquire(ctx, "cron", "t2", time.Second); !ok || err != nil {
+		t.Error("an expired lease should be free", ok, err)
+	}
+}
+
+func TestSSDBMutexLost(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	adapter, fs := newSSDBAdapter(t, c)
+	defer fs.Close()
+	ctx := context.Background()
+
+	m := NewMutex(adapter, "cron", 30*time.Millisecond)
+	if err := m.Lock(ctx); err != nil {
+		t.Fatal("Lock err", err)
+	}
+	// the lease expires on the server before it is renewed.
+	c.Advance(time.Minute)
+	select {
+	case <-m.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost lease should be reported")
+	}
+	if err := m.Unlock(ctx); err != ErrLockLost {
+		t.Error("Unlock of an expired lease should return ErrLockLost", err)
+	}
+}
@@ -0,0 +1,63 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"libs/cache"
+)
+
+var errNotChanged = errors.New("lock: not changed")
+
+// MemoryAdapter stores locks in a MemoryCache.
+// it only locks within one process and is meant for tests.
+type MemoryAdapter struct {
+	mc *cache.MemoryCache
+}
+
+// NewMemoryAdapter returns a MemoryAdapter on mc.
+func NewMemoryAdapter(mc *cache.MemoryCache) *MemoryAdapter {
+	return &MemoryAdapter{mc: mc}
+}
+
+// Acquire sets key to token if it does not exist.
+func (a *MemoryAdapter) Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return a.update(ctx, key, func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		if exist {
+			return nil, 0, errNotChanged
+		}
+		return token, ttl, nil
+	})
+}
+
+// Release deletes key if it holds token.
+func (a *MemoryAdapter) Release(ctx context.Context, key, token string) (bool, error) {
+	return a.update(ctx, key, func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		if !exist || val != token {
+			return nil, 0, errNotChanged
+		}
+		return nil, 0, nil
+	})
+}
+
+// Refresh resets the ttl of key if it holds token.
+func (a *MemoryAdapter) Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return a.update(ctx, key, func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		if !exist || val != token {
+			return nil, 0, errNotChanged
+		}
+		return token, ttl, nil
+	})
+}
+
+func (a *MemoryAdapter) update(ctx context.Context, key string, fn cache.UpdateFunc) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	err := a.mc.Update(ctx, key, fn)
+	if err == errNotChanged {
+		return false, nil
+	}
+	return err == nil, err
+}
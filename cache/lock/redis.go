@@ -0,0 +1,59 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"libs/cache"
+)
+
+// releaseScript deletes the key only if it still holds the token.
+var releaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// refreshScript resets the ttl only if the key still holds the token.
+var refreshScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// RedisAdapter stores locks in a RedisCache,
+// the keys are associated with the collection key of the cache.
+type RedisAdapter struct {
+	rc *cache.RedisCache
+}
+
+// NewRedisAdapter returns a RedisAdapter on rc.
+func NewRedisAdapter(rc *cache.RedisCache) *RedisAdapter {
+	return &RedisAdapter{rc: rc}
+}
+
+// Acquire sets key with SET NX PX.
+func (a *RedisAdapter) Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	reply, err := redis.String(a.rc.DoContext(ctx, "SET", key, token, "NX", "PX", int64(ttl/time.Millisecond)))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return reply == "OK", nil
+}
+
+// Release deletes key with a lua compare-and-delete.
+func (a *RedisAdapter) Release(ctx context.Context, key, token string) (bool, error) {
+	n, err := redis.Int(a.rc.Eval(ctx, releaseScript, []string{key}, token))
+	return n == 1, err
+}
+
+// Refresh resets the ttl of key with a lua compare-and-expire.
+func (a *RedisAdapter) Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	n, err := redis.Int(a.rc.Eval(ctx, refreshScript, []string{key}, token, int64(ttl/time.Millisecond)))
+	return n == 1, err
+}
@@ -0,0 +1,93 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"libs/cache/ssdb"
+)
+
+// SSDBAdapter stores locks in SSDB.
+// SSDB has no scripting, so Release and Refresh compare the token and
+// then change the key in two commands; a lease expiring in between can
+// still be deleted or extended. keep the ttl well above the work time.
+type SSDBAdapter struct {
+	sd *ssdb.SSDB
+}
+
+// NewSSDBAdapter returns a SSDBAdapter on sd.
+func NewSSDBAdapter(sd *ssdb.SSDB) *SSDBAdapter {
+	return &SSDBAdapter{sd: sd}
+}
+
+// Acquire sets key with setnx and then its ttl with expire.
+// a key left without ttl by a crash between the two is given one.
+func (a *SSDBAdapter) Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	resp, err := a.sd.Do("setnx", key, token)
+	if err != nil {
+		return false, err
+	}
+	seconds := ttlSeconds(ttl)
+	if len(resp) == 1 && resp[0] == "1" {
+		resp, err = a.sd.Do("expire", key, seconds)
+		if err == ssdb.ErrNotFound {
+			return false, nil
+		}
+		return err == nil && len(resp) == 1 && resp[0] == "1", err
+	}
+	if resp, err = a.sd.Do("ttl", key); err == nil && len(resp) == 1 && resp[0] == "-1" {
+		a.sd.Do("expire", key, seconds)
+	}
+	return false, nil
+}
+
+// Release deletes key if it holds token.
+func (a *SSDBAdapter) Release(ctx context.Context, key, token string) (bool, error) {
+	if ok, err := a.holds(ctx, key, token); err != nil || !ok {
+		return false, err
+	}
+	_, err := a.sd.Do("del", key)
+	return err == nil, err
+}
+
+// Refresh resets the ttl of key if it holds token.
+func (a *SSDBAdapter) Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	if ok, err := a.holds(ctx, key, token); err != nil || !ok {
+		return false, err
+	}
+	resp, err := a.sd.Do("expire", key, ttlSeconds(ttl))
+	if err == ssdb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(resp) == 1 && resp[0] == "1", nil
+}
+
+// holds reports whether key holds token, a missing key holds none.
+func (a *SSDBAdapter) holds(ctx context.Context, key, token string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	resp, err := a.sd.Do("get", key)
+	if err == ssdb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(resp) == 1 && resp[0] == token, nil
+}
+
+// ttlSeconds rounds ttl up to whole seconds, the unit of SSDB.
+func ttlSeconds(ttl time.Duration) int64 {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -1,10 +1,14 @@
 package cache
 
 import (
+	"container/list"
+	"context"
 	"encoding/json"
 	"errors"
 	"sync"
 	"time"
+
+	"libs/clock"
 )
 
 var (
@@ -14,26 +18,63 @@ var (
 
 // MemoryItem store memory cache item.
 type MemoryItem struct {
+	key         string
 	val         interface{}
 	createdTime time.Time
 	lifespan    time.Duration
+	tags        []string
+
+	// bookkeeping of the eviction policy.
+	size     int64
+	elem     *list.Element
+	hits     int64
+	lastUsed int64
+	index    int
 }
 
-func (mi *MemoryItem) isExpire() bool {
+func (mi *MemoryItem) isExpire(now time.Time) bool {
 	// 0 means forever
 	if mi.lifespan == 0 {
 		return false
 	}
-	return time.Now().Sub(mi.createdTime) > mi.lifespan
+	return now.Sub(mi.createdTime) > mi.lifespan
 }
 
 // MemoryCache is Memory cache adapter.
 // it contains a RW locker for safe map storage.
+// when maxentries or maxbytes is configured, items are evicted
+// by the configured policy once the limits are exceeded.
 type MemoryCache struct {
 	sync.RWMutex
 	dur   time.Duration
 	items map[string]*MemoryItem
 	Every int // run an expiration check Every clock time
+
+	policy     evictionPolicy
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	onEvicted  EvictedFunc
+	persist    *memoryPersist
+
+	// tags indexes the keys of the tagged items by tag.
+	tags map[string]map[string]struct{}
+
+	clock clock.Clock
+}
+
+// memoryConfig is the json config accepted by MemoryCache.StartAndGC
+// and ShardedMemoryCache.StartAndGC.
+type memoryConfig struct {
+	Interval   *int   `json:"interval"`
+	Shards     int    `json:"shards"`
+	MaxEntries int    `json:"maxentries"`
+	MaxBytes   int64  `json:"maxbytes"`
+	Policy     string `json:"policy"`
+
+	Snapshot         string `json:"snapshot"`
+	SnapshotInterval int    `json:"snapshotinterval"`
+	AppendOnly       bool   `json:"appendonly"`
 }
 
 // NewMemoryCache returns a new MemoryCache.
@@ -48,64 +89,203 @@ func (bc *MemoryCache) Do(commandName string, args ...interface{}) (reply interf
 }
 
 // Get cache from memory.
-// if non-existed or expired, return nil.
-func (bc *MemoryCache) Get(name string) interface{} {
-	bc.RLock()
-	defer bc.RUnlock()
+// if non-existed or expired, return ErrCacheMiss.
+func (bc *MemoryCache) Get(ctx context.Context, name string) (interface{}, error) {
+	if bc.policy != nil {
+		// the eviction policy records every access.
+		bc.Lock()
+		defer bc.Unlock()
+	} else {
+		bc.RLock()
+		defer bc.RUnlock()
+	}
 	if itm, ok := bc.items[name]; ok {
-		if itm.isExpire() {
-			return nil
+		if itm.isExpire(bc.now()) {
+			return nil, ErrCacheMiss
+		}
+		if bc.policy != nil {
+			bc.policy.access(itm)
 		}
-		return itm.val
+		return itm.val, nil
 	}
-	return nil
+	return nil, ErrCacheMiss
 }
 
 // GetMulti gets caches from memory.
-// if non-existed or expired, return nil.
-func (bc *MemoryCache) GetMulti(names []string) []interface{} {
-	var rc []interface{}
-	for _, name := range names {
-		rc = append(rc, bc.Get(name))
+// if non-existed or expired, the value is nil.
+func (bc *MemoryCache) GetMulti(ctx context.Context, names []string) ([]interface{}, error) {
+	rc := make([]interface{}, len(names))
+	for i, name := range names {
+		rc[i], _ = bc.Get(ctx, name)
 	}
-	return rc
+	return rc, nil
 }
 
 // Put cache to memory.
 // if lifespan is 0, it will be forever till restart.
-func (bc *MemoryCache) Put(name string, value interface{}, lifespan time.Duration) error {
+func (bc *MemoryCache) Put(ctx context.Context, name string, value interface{}, lifespan time.Duration) error {
 	bc.Lock()
-	defer bc.Unlock()
-	bc.items[name] = &MemoryItem{
+	evicted, err := bc.put(&MemoryItem{
+		key:         name,
 		val:         value,
-		createdTime: time.Now(),
+		createdTime: bc.now(),
 		lifespan:    lifespan,
+	})
+	onEvicted := bc.onEvicted
+	bc.Unlock()
+	bc.notifyEvicted(onEvicted, evicted)
+	return err
+}
+
+// put stores itm, evicting items until it fits into the limits.
+// it returns the evicted items, the caller must hold the lock.
+func (bc *MemoryCache) put(itm *MemoryItem) (evicted []*MemoryItem, err error) {
+	if bc.policy == nil {
+		if err = bc.appendLog(logPut, itm); err != nil {
+			return nil, err
+		}
+		if old, ok := bc.items[itm.key]; ok {
+			bc.removeItem(old)
+		}
+		bc.items[itm.key] = itm
+		bc.indexTags(itm)
+		return nil, nil
 	}
-	return nil
+	itm.size = sizeOf(itm.key, itm.val)
+	if bc.maxBytes > 0 && itm.size > bc.maxBytes {
+		return nil, errors.New("cache: item is larger than maxbytes")
+	}
+	if err = bc.appendLog(logPut, itm); err != nil {
+		return nil, err
+	}
+	if old, ok := bc.items[itm.key]; ok {
+		bc.removeItem(old)
+	}
+	for (bc.maxEntries > 0 && len(bc.items) >= bc.maxEntries) ||
+		(bc.maxBytes > 0 && bc.bytes+itm.size > bc.maxBytes) {
+		victim := bc.policy.victim()
+		if victim == nil {
+			break
+		}
+		bc.deleteItem(victim)
+		evicted = append(evicted, victim)
+	}
+	bc.items[itm.key] = itm
+	bc.indexTags(itm)
+	bc.bytes += itm.size
+	bc.policy.add(itm)
+	return evicted, nil
 }
 
-// Delete cache in memory.
-func (bc *MemoryCache) Delete(name string) error {
+// removeItem deletes itm from the map and the eviction policy.
+// the caller must hold the lock.
+func (bc *MemoryCache) removeItem(itm *MemoryItem) {
+	delete(bc.items, itm.key)
+	bc.unindexTags(itm)
+	if bc.policy != nil {
+		bc.bytes -= itm.size
+		bc.policy.remove(itm)
+	}
+}
+
+// deleteItem removes itm and records the deletion in the append-only log.
+// the caller must hold the lock.
+func (bc *MemoryCache) deleteItem(itm *MemoryItem) {
+	bc.removeItem(itm)
+	bc.appendLog(logDelete, itm)
+}
+
+// notifyEvicted calls onEvicted for every evicted item, outside of the lock.
+func (bc *MemoryCache) notifyEvicted(onEvicted EvictedFunc, evicted []*MemoryItem) {
+	if onEvicted == nil {
+		return
+	}
+	for _, itm := range evicted {
+		onEvicted(itm.key, itm.val)
+	}
+}
+
+// SetClock sets the clock the items expire with, the system time by default.
+// call it before StartAndGC.
+func (bc *MemoryCache) SetClock(c clock.Clock) {
+	bc.clock = c
+}
+
+func (bc *MemoryCache) now() time.Time {
+	return clock.Or(bc.clock).Now()
+}
+
+// OnEvicted sets the function called when an item is evicted or expires.
+func (bc *MemoryCache) OnEvicted(f EvictedFunc) {
 	bc.Lock()
 	defer bc.Unlock()
-	if _, ok := bc.items[name]; !ok {
-		return errors.New("key not exist")
+	bc.onEvicted = f
+}
+
+func (bc *MemoryCache) evictedFunc() EvictedFunc {
+	bc.RLock()
+	defer bc.RUnlock()
+	return bc.onEvicted
+}
+
+// UpdateFunc computes the new value of an item from its current value,
+// exist is false if the item is missing or expired.
+// a nil newVal deletes the item, an error leaves it unchanged.
+type UpdateFunc func(val interface{}, exist bool) (newVal interface{}, lifespan time.Duration, err error)
+
+// Update atomically replaces the item of key with the result of fn.
+// it returns the error of fn.
+func (bc *MemoryCache) Update(ctx context.Context, key string, fn UpdateFunc) error {
+	bc.Lock()
+	var val interface{}
+	itm, exist := bc.items[key]
+	if exist && itm.isExpire(bc.now()) {
+		exist = false
 	}
-	delete(bc.items, name)
-	if _, ok := bc.items[name]; ok {
-		return errors.New("delete key error")
+	if exist {
+		val = itm.val
+	}
+	newVal, lifespan, err := fn(val, exist)
+	var evicted []*MemoryItem
+	if err == nil {
+		if newVal == nil {
+			if itm != nil {
+				bc.deleteItem(itm)
+			}
+		} else {
+			evicted, err = bc.put(&MemoryItem{
+				key:         key,
+				val:         newVal,
+				createdTime: bc.now(),
+				lifespan:    lifespan,
+			})
+		}
+	}
+	onEvicted := bc.onEvicted
+	bc.Unlock()
+	bc.notifyEvicted(onEvicted, evicted)
+	return err
+}
+
+// Delete cache in memory.
+// if non-existed, it does nothing.
+func (bc *MemoryCache) Delete(ctx context.Context, name string) error {
+	bc.Lock()
+	defer bc.Unlock()
+	if itm, ok := bc.items[name]; ok {
+		bc.deleteItem(itm)
 	}
 	return nil
 }
 
 // Incr increase cache counter in memory.
 // it supports int,int32,int64,uint,uint32,uint64.
-func (bc *MemoryCache) Incr(key string) error {
-	bc.RLock()
-	defer bc.RUnlock()
+func (bc *MemoryCache) Incr(ctx context.Context, key string) error {
+	bc.Lock()
+	defer bc.Unlock()
 	itm, ok := bc.items[key]
 	if !ok {
-		return errors.New("key not exist")
+		return ErrCacheMiss
 	}
 	switch itm.val.(type) {
 	case int:
@@ -123,16 +303,16 @@ func (bc *MemoryCache) Incr(key string) error {
 	default:
 		return errors.New("item val is not (u)int (u)int32 (u)int64")
 	}
-	return nil
+	return bc.appendLog(logPut, itm)
 }
 
 // Decr decrease counter in memory.
-func (bc *MemoryCache) Decr(key string) error {
-	bc.RLock()
-	defer bc.RUnlock()
+func (bc *MemoryCache) Decr(ctx context.Context, key string) error {
+	bc.Lock()
+	defer bc.Unlock()
 	itm, ok := bc.items[key]
 	if !ok {
-		return errors.New("key not exist")
+		return ErrCacheMiss
 	}
 	switch itm.val.(type) {
 	case int:
@@ -162,49 +342,109 @@ func (bc *MemoryCache) Decr(key string) error {
 	default:
 		return errors.New("item val is not int int64 int32")
 	}
-	return nil
+	return bc.appendLog(logPut, itm)
 }
 
 // IsExist check cache exist in memory.
-func (bc *MemoryCache) IsExist(name string) bool {
+func (bc *MemoryCache) IsExist(ctx context.Context, name string) (bool, error) {
 	bc.RLock()
 	defer bc.RUnlock()
 	if v, ok := bc.items[name]; ok {
-		return !v.isExpire()
+		return !v.isExpire(bc.now()), nil
 	}
-	return false
+	return false, nil
 }
 
 // ClearAll will delete all cache in memory.
-func (bc *MemoryCache) ClearAll() error {
+func (bc *MemoryCache) ClearAll(ctx context.Context) error {
 	bc.Lock()
 	defer bc.Unlock()
+	bc.clear()
+	return bc.appendLog(logClear, nil)
+}
+
+// clear deletes all items, the caller must hold the lock.
+func (bc *MemoryCache) clear() {
 	bc.items = make(map[string]*MemoryItem)
-	return nil
+	bc.tags = nil
+	bc.bytes = 0
+	if bc.policy != nil {
+		bc.policy.reset()
+	}
 }
 
 // StartAndGC start memory cache. it will check expiration in every clock time.
+// config is like {"interval":60,"maxentries":10000,"maxbytes":67108864,"policy":"lru"}
+// maxentries and maxbytes are optional limits, 0 means unlimited,
+// policy is lru (default) or lfu and only used when a limit is set.
+// the items survive restarts with {"snapshot":"/var/cache/app.snap","snapshotinterval":300,"appendonly":true},
+// see Snapshot, the periodic snapshots stop with Close.
 func (bc *MemoryCache) StartAndGC(config string) error {
-	var cf map[string]int
-	json.Unmarshal([]byte(config), &cf)
-	if _, ok := cf["interval"]; !ok {
-		cf = make(map[string]int)
-		cf["interval"] = DefaultEvery
-	}
-	dur := time.Duration(cf["interval"]) * time.Second
-	bc.Every = cf["interval"]
+	cf, err := parseMemoryConfig(config)
+	if err != nil {
+		return err
+	}
+	if err = bc.setLimits(cf.MaxEntries, cf.MaxBytes, cf.Policy); err != nil {
+		return err
+	}
+	if cf.Snapshot != "" {
+		if err = bc.startPersist(cf.Snapshot, cf.SnapshotInterval, cf.AppendOnly); err != nil {
+			return err
+		}
+	}
+	dur := time.Duration(cf.interval()) * time.Second
+	bc.Every = cf.interval()
 	bc.dur = dur
 	go bc.vacuum()
 	return nil
 }
 
+// parseMemoryConfig parses the json config, an empty config means the defaults.
+func parseMemoryConfig(config string) (cf memoryConfig, err error) {
+	if config != "" {
+		err = json.Unmarshal([]byte(config), &cf)
+	}
+	return
+}
+
+// interval returns the configured interval or DefaultEvery.
+func (cf memoryConfig) interval() int {
+	if cf.Interval == nil {
+		return DefaultEvery
+	}
+	return *cf.Interval
+}
+
+// setLimits enables the eviction policy when maxEntries or maxBytes is set.
+func (bc *MemoryCache) setLimits(maxEntries int, maxBytes int64, policyName string) error {
+	if maxEntries <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	policy, err := newEvictionPolicy(policyName)
+	if err != nil {
+		return err
+	}
+	bc.Lock()
+	defer bc.Unlock()
+	bc.maxEntries = maxEntries
+	bc.maxBytes = maxBytes
+	bc.policy = policy
+	bc.bytes = 0
+	for _, itm := range bc.items {
+		itm.size = sizeOf(itm.key, itm.val)
+		bc.bytes += itm.size
+		policy.add(itm)
+	}
+	return nil
+}
+
 // check expiration.
 func (bc *MemoryCache) vacuum() {
 	if bc.Every < 1 {
 		return
 	}
 	for {
-		<-time.After(bc.dur)
+		<-clock.Or(bc.clock).After(bc.dur)
 		if bc.items == nil {
 			return
 		}
@@ -219,18 +459,29 @@ func (bc *MemoryCache) expiredKeys() (keys []string) {
 	bc.RLock()
 	defer bc.RUnlock()
 	for key, itm := range bc.items {
-		if itm.isExpire() {
+		if itm.isExpire(bc.now()) {
 			keys = append(keys, key)
 		}
 	}
 	return
 }
 
-// clearItems removes all the items which key in keys.
+// clearItems removes all the items which key in keys
+// and are still expired.
 func (bc *MemoryCache) clearItems(keys []string) {
 	bc.Lock()
-	defer bc.Unlock()
+	var expired []*MemoryItem
 	for _, key := range keys {
-		delete(bc.items, key)
+		if itm, ok := bc.items[key]; ok && itm.isExpire(bc.now()) {
+			bc.removeItem(itm)
+			expired = append(expired, itm)
+		}
 	}
+	onEvicted := bc.onEvicted
+	bc.Unlock()
+	bc.notifyEvicted(onEvicted, expired)
+}
+
+func init() {
+	Register("memory", func() Cache { return NewMemoryCache() })
 }
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"reflect"
+)
+
+// Eviction policy names for the "policy" field of the memory cache config.
+const (
+	PolicyLRU = "lru"
+	PolicyLFU = "lfu"
+)
+
+// EvictedFunc is called with the key and value of an item removed
+// from MemoryCache because of the size limits or because it expired.
+type EvictedFunc func(key string, val interface{})
+
+// evictionPolicy keeps the order in which MemoryCache items are evicted.
+// all methods are called with the MemoryCache lock held.
+type evictionPolicy interface {
+	add(itm *MemoryItem)
+	access(itm *MemoryItem)
+	remove(itm *MemoryItem)
+	// victim returns the next item to evict, nil if there is none.
+	victim() *MemoryItem
+	reset()
+}
+
+func newEvictionPolicy(name string) (evictionPolicy, error) {
+	switch name {
+	case "", PolicyLRU:
+		return newLRUPolicy(), nil
+	case PolicyLFU:
+		return newLFUPolicy(), nil
+	}
+	return nil, fmt.Errorf("cache: unknown eviction policy %q", name)
+}
+
+// lruPolicy evicts the least recently used item.
+type lruPolicy struct {
+	ll *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{ll: list.New()}
+}
+
+func (p *lruPolicy) add(itm *MemoryItem) {
+	itm.elem = p.ll.PushFront(itm)
+}
+
+func (p *lruPolicy) access(itm *MemoryItem) {
+	if itm.elem != nil {
+		p.ll.MoveToFront(itm.elem)
+	}
+}
+
+func (p *lruPolicy) remove(itm *MemoryItem) {
+	if itm.elem != nil {
+		p.ll.Remove(itm.elem)
+		itm.elem = nil
+	}
+}
+
+func (p *lruPolicy) victim() *MemoryItem {
+	if e := p.ll.Back(); e != nil {
+		return e.Value.(*MemoryItem)
+	}
+	return nil
+}
+
+func (p *lruPolicy) reset() {
+	p.ll.Init()
+}
+
+// lfuPolicy evicts the least frequently used item,
+// the least recently used one among items with the same hits.
+type lfuPolicy struct {
+	h    lfuHeap
+	tick int64
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{}
+}
+
+func (p *lfuPolicy) add(itm *MemoryItem) {
+	p.tick++
+	itm.hits = 0
+	itm.lastUsed = p.tick
+	heap.Push(&p.h, itm)
+}
+
+func (p *lfuPolicy) access(itm *MemoryItem) {
+	if itm.index < 0 {
+		return
+	}
+	p.tick++
+	itm.hits++
+	itm.lastUsed = p.tick
+	heap.Fix(&p.h, itm.index)
+}
+
+func (p *lfuPolicy) remove(itm *MemoryItem) {
+	if itm.index >= 0 && itm.index < len(p.h) && p.h[itm.index] == itm {
+		heap.Remove(&p.h, itm.index)
+	}
+	itm.index = -1
+}
+
+func (p *lfuPolicy) victim() *MemoryItem {
+	if len(p.h) == 0 {
+		return nil
+	}
+	return p.h[0]
+}
+
+func (p *lfuPolicy) reset() {
+	p.h = nil
+}
+
+type lfuHeap []*MemoryItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].hits != h[j].hits {
+		return h[i].hits < h[j].hits
+	}
+	return h[i].lastUsed < h[j].lastUsed
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	itm := x.(*MemoryItem)
+	itm.index = len(*h)
+	*h = append(*h, itm)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	itm := old[n-1]
+	old[n-1] = nil
+	itm.index = -1
+	*h = old[:n-1]
+	return itm
+}
+
+// sizeOf returns the approximate number of bytes held by key and val.
+// strings and byte slices count their length, other values the size of their type.
+func sizeOf(key string, val interface{}) int64 {
+	size := int64(len(key))
+	switch v := val.(type) {
+	case nil:
+	case string:
+		size += int64(len(v))
+	case []byte:
+		size += int64(len(v))
+	default:
+		size += int64(reflect.TypeOf(val).Size())
+	}
+	return size
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryCacheLRU(t *testing.T) {
+	bm := NewMemoryCache()
+	if err := bm.StartAndGC(`{"interval":0,"maxentries":2,"policy":"lru"}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	var evicted []string
+	bm.OnEvicted(func(key string, val interface{}) {
+		evicted = append(evicted, key)
+	})
+	ctx := context.Background()
+	bm.Put(ctx, "a", 1, 0)
+	bm.Put(ctx, "b", 2, 0)
+	// a is now the most recently used.
+	bm.Get(ctx, "a")
+	bm.Put(ctx, "c", 3, 0)
+
+	if ok, _ := bm.IsExist(ctx, "b"); ok {
+		t.Error("b should be evicted")
+	}
+	if ok, _ := bm.IsExist(ctx, "a"); !ok {
+		t.Error("a should be kept")
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Error("evicted callback err", evicted)
+	}
+}
+
+func TestMemoryCacheLFU(t *testing.T) {
+	bm := NewMemoryCache()
+	if err := bm.StartAndGC(`{"interval":0,"maxentries":2,"policy":"lfu"}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	bm.Put(ctx, "a", 1, 0)
+	bm.Put(ctx, "b", 2, 0)
+	bm.Get(ctx, "a")
+	bm.Get(ctx, "a")
+	bm.Get(ctx, "b")
+	// b was read less often than a.
+	bm.Put(ctx, "c", 3, 0)
+
+	if ok, _ := bm.IsExist(ctx, "b"); ok {
+		t.Error("b should be evicted")
+	}
+	if ok, _ := bm.IsExist(ctx, "a"); !ok {
+		t.Error("a should be kept")
+	}
+	if ok, _ := bm.IsExist(ctx, "c"); !ok {
+		t.Error("c should be kept")
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	bm := NewMemoryCache()
+	if err := bm.StartAndGC(`{"interval":0,"maxbytes":20}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	bm.Put(ctx, "a", "123456789", 0)
+	bm.Put(ctx, "b", "123456789", 0)
+	if ok, _ := bm.IsExist(ctx, "a"); !ok {
+		t.Error("a should be kept")
+	}
+	bm.Put(ctx, "c", "123456789", 0)
+	if ok, _ := bm.IsExist(ctx, "a"); ok {
+		t.Error("a should be evicted")
+	}
+	if bm.bytes > 20 {
+		t.Error("bytes over limit", bm.bytes)
+	}
+	if err := bm.Put(ctx, "d", "this value is too large", 0); err == nil {
+		t.Error("item larger than maxbytes should be rejected")
+	}
+
+	bm.Delete(ctx, "b")
+	bm.Delete(ctx, "c")
+	if bm.bytes != 0 {
+		t.Error("bytes should be 0 after delete", bm.bytes)
+	}
+}
+
+func TestMemoryCacheUnknownPolicy(t *testing.T) {
+	bm := NewMemoryCache()
+	if err := bm.StartAndGC(`{"maxentries":2,"policy":"fifo"}`); err == nil {
+		t.Error("unknown policy should return error")
+	}
+}
@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"libs/clock"
+)
+
+var (
+	// DefaultShards is the number of shards of ShardedMemoryCache.
+	DefaultShards = 16
+)
+
+// ShardedMemoryCache is a memory cache adapter which stripes keys
+// across several MemoryCache shards, each guarded by its own lock.
+// expired items are recycled one shard at a time so the whole cache
+// is never locked at once.
+type ShardedMemoryCache struct {
+	shards []*MemoryCache
+	dur    time.Duration
+	Every   int // visit all shards once in Every clock time
+	clock   clock.Clock
+	started int32 // set by StartAndGC, which runs once
+}
+
+// NewShardedMemoryCache returns a new ShardedMemoryCache with DefaultShards shards.
+func NewShardedMemoryCache() *ShardedMemoryCache {
+	sc := &ShardedMemoryCache{}
+	sc.initShards(DefaultShards)
+	return sc
+}
+
+func (sc *ShardedMemoryCache) initShards(n int) {
+	sc.shards = make([]*MemoryCache, n)
+	for i := range sc.shards {
+		sc.shards[i] = NewMemoryCache()
+		sc.shards[i].clock = sc.clock
+	}
+}
+
+// shard returns the shard which owns key.
+func (sc *ShardedMemoryCache) shard(key string) *MemoryCache {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return sc.shards[h.Sum32()%uint32(len(sc.shards))]
+}
+
+// Get cache from memory.
+// if non-existed or expired, return ErrCacheMiss.
+func (sc *ShardedMemoryCache) Get(ctx context.Context, key string) (interface{}, error) {
+	return sc.shard(key).Get(ctx, key)
+}
+
+// GetMulti gets caches from memory.
+// if non-existed or expired, the value is nil.
+func (sc *ShardedMemoryCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	rc := make([]interface{}, len(keys))
+	for i, key := range keys {
+		rc[i], _ = sc.Get(ctx, key)
+	}
+	return rc, nil
+}
+
+// Put cache to memory.
+// if lifespan is 0, it will be forever till restart.
+func (sc *ShardedMemoryCache) Put(ctx context.Context, key string, val interface{}, lifespan time.Duration) error {
+	return sc.shard(key).Put(ctx, key, val, lifespan)
+}
+
+// Delete cache in memory.
+func (sc *ShardedMemoryCache) Delete(ctx context.Context, key string) error {
+	return sc.shard(key).Delete(ctx, key)
+}
+
+// Incr increase cache counter in memory.
+func (sc *ShardedMemoryCache) Incr(ctx context.Context, key string) error {
+	return sc.shard(key).Incr(ctx, key)
+}
+
+// Decr decrease counter in memory.
+func (sc *ShardedMemoryCache) Decr(ctx context.Context, key string) error {
+	return sc.shard(key).Decr(ctx, key)
+}
+
+// IsExist check cache exist in memory.
+func (sc *ShardedMemoryCache) IsExist(ctx context.Context, key string) (bool, error) {
+	return sc.shard(key).IsExist(ctx, key)
+}
+
+// ClearAll will delete all cache in memory.
+func (sc *ShardedMemoryCache) ClearAll(ctx context.Context) error {
+	for _, s := range sc.shards {
+		s.ClearAll(ctx)
+	}
+	return nil
+}
+
+// PutWithTags puts val like Put and attaches tags to it.
+func (sc *ShardedMemoryCache) PutWithTags(ctx context.Context, key string, val interface{}, lifespan time.Duration, tags ...string) error {
+	return sc.shard(key).PutWithTags(ctx, key, val, lifespan, tags...)
+}
+
+// InvalidateTags deletes the items having one of tags, shard by shard.
+func (sc *ShardedMemoryCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, s := range sc.shards {
+		s.InvalidateTags(ctx, tags...)
+	}
+	return nil
+}
+
+// DeletePrefix deletes the items whose key starts with prefix, shard by shard.
+func (sc *ShardedMemoryCache) DeletePrefix(ctx context.Context, prefix string) error {
+	for _, s := range sc.shards {
+		s.DeletePrefix(ctx, prefix)
+	}
+	return nil
+}
+
+// OnEvicted sets the function called when an item is evicted or expires.
+func (sc *ShardedMemoryCache) OnEvicted(f EvictedFunc) {
+	for _, s := range sc.shards {
+		s.OnEvicted(f)
+	}
+}
+
+func (sc *ShardedMemoryCache) evictedFunc() EvictedFunc {
+	return sc.shards[0].evictedFunc()
+}
+
+// SetClock sets the clock the items of every shard expire with,
+// the system time by default. call it before StartAndGC.
+func (sc *ShardedMemoryCache) SetClock(c clock.Clock) {
+	sc.clock = c
+	for _, s := range sc.shards {
+		s.SetClock(c)
+	}
+}
+
+// StartAndGC start sharded memory cache. it will check expiration in every clock time.
+// config is like {"interval":60,"shards":16,"maxentries":10000,"maxbytes":67108864,"policy":"lru"}
+// the limits are divided between the shards, so there must be no more shards
+// than maxentries or maxbytes. snapshot is only supported by MemoryCache.
+// it can be called once.
+func (sc *ShardedMemoryCache) StartAndGC(config string) error {
+	cf, err := parseMemoryConfig(config)
+	if err != nil {
+		return err
+	}
+	if cf.Snapshot != "" || cf.SnapshotInterval != 0 || cf.AppendOnly {
+		return errors.New("cache: snapshot is not supported by shardedmemory")
+	}
+	n := len(sc.shards)
+	if cf.Shards > 0 {
+		n = cf.Shards
+	}
+	if (cf.MaxEntries > 0 && cf.MaxEntries < n) || (cf.MaxBytes > 0 && cf.MaxBytes < int64(n)) {
+		return errors.New("cache: more shards than maxentries or maxbytes")
+	}
+	if !atomic.CompareAndSwapInt32(&sc.started, 0, 1) {
+		return errors.New("cache: shardedmemory is already started")
+	}
+	if n != len(sc.shards) {
+		sc.initShards(n)
+	}
+	for i, s := range sc.shards {
+		if err = s.setLimits(int(shareOf(int64(cf.MaxEntries), n, i)), shareOf(cf.MaxBytes, n, i), cf.Policy); err != nil {
+			return err
+		}
+	}
+	sc.Every = cf.interval()
+	sc.dur = time.Duration(sc.Every) * time.Second
+	go sc.vacuum()
+	return nil
+}
+
+// shareOf returns the part of total given to the shard i of n,
+// the remainder is spread over the first shards.
+func shareOf(total int64, n, i int) int64 {
+	share := total / int64(n)
+	if int64(i) < total%int64(n) {
+		share++
+	}
+	return share
+}
+
+// check expiration, one shard per tick.
+func (sc *ShardedMemoryCache) vacuum() {
+	if sc.Every < 1 {
+		return
+	}
+	step := sc.dur / time.Duration(len(sc.shards))
+	for i := 0; ; i = (i + 1) % len(sc.shards) {
+		<-clock.Or(sc.clock).After(step)
+		s := sc.shards[i]
+		if keys := s.expiredKeys(); len(keys) != 0 {
+			s.clearItems(keys)
+		}
+	}
+}
+
+func init() {
+	Register("shardedmemory", func() Cache { return NewShardedMemoryCache() })
+}
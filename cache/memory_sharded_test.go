@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShardedMemoryCache(t *testing.T) {
+	bm, err := NewCache("shardedmemory", `{"interval":20,"shards":4}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		if err = bm.Put(ctx, "key"+strconv.Itoa(i), i, 10*time.Second); err != nil {
+			t.Error("set Error", err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if v, err := bm.Get(ctx, "key"+strconv.Itoa(i)); err != nil || v.(int) != i {
+			t.Error("get err", err)
+		}
+	}
+	if err = bm.Incr(ctx, "key1"); err != nil {
+		t.Error("Incr Error", err)
+	}
+	if v, _ := bm.Get(ctx, "key1"); v.(int) != 2 {
+		t.Error("get err")
+	}
+	vv, _ := bm.GetMulti(ctx, []string{"key2", "missing"})
+	if vv[0].(int) != 2 || vv[1] != nil {
+		t.Error("GetMulti ERROR")
+	}
+	bm.Delete(ctx, "key3")
+	if _, err = bm.Get(ctx, "key3"); err != ErrCacheMiss {
+		t.Error("delete err")
+	}
+	if err = bm.ClearAll(ctx); err != nil {
+		t.Error("clear all err")
+	}
+	if ok, _ := bm.IsExist(ctx, "key4"); ok {
+		t.Error("clear all err")
+	}
+}
+
+func TestShardedMemoryCacheLimits(t *testing.T) {
+	bm := NewShardedMemoryCache()
+	if err := bm.StartAndGC(`{"interval":0,"shards":2,"maxentries":10}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		bm.Put(ctx, "key"+strconv.Itoa(i), i, 0)
+	}
+	n := 0
+	for _, s := range bm.shards {
+		n += len(s.items)
+	}
+	if n > 10 {
+		t.Error("entries over limit", n)
+	}
+
+	// the limit is not rounded up per shard.
+	bm = NewShardedMemoryCache()
+	if err := bm.StartAndGC(`{"interval":0,"shards":4,"maxentries":10,"maxbytes":4099}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	entries, bytes := 0, int64(0)
+	for _, s := range bm.shards {
+		entries += s.maxEntries
+		bytes += s.maxBytes
+	}
+	if entries != 10 || bytes != 4099 {
+		t.Error("limits of the shards should add up to the config", entries, bytes)
+	}
+	if err := bm.StartAndGC(`{"interval":0}`); err == nil {
+		t.Error("a second StartAndGC should fail")
+	}
+
+	for _, config := range []string{
+		`{"shards":16,"maxentries":10}`,
+		`{"shards":16,"maxbytes":10}`,
+		`{"snapshot":"cache.snapshot"}`,
+	} {
+		if err := NewShardedMemoryCache().StartAndGC(config); err == nil {
+			t.Error("config should be rejected", config)
+		}
+	}
+}
+
+func benchmarkCacheParallel(b *testing.B, bm Cache) {
+	ctx := context.Background()
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		bm.Put(ctx, keys[i], i, 0)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			// one write for every nine reads.
+			if i%10 == 0 {
+				bm.Put(ctx, key, i, 0)
+			} else {
+				bm.Get(ctx, key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkMemoryCacheParallel(b *testing.B) {
+	bm := NewMemoryCache()
+	bm.StartAndGC(`{"interval":0}`)
+	benchmarkCacheParallel(b, bm)
+}
+
+func BenchmarkShardedMemoryCacheParallel(b *testing.B) {
+	bm := NewShardedMemoryCache()
+	bm.StartAndGC(`{"interval":0}`)
+	benchmarkCacheParallel(b, bm)
+}
@@ -0,0 +1,400 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultSnapshotEvery is the default interval in seconds between two snapshots of MemoryCache.
+	DefaultSnapshotEvery = 300
+)
+
+// the operations recorded in the append-only log.
+const (
+	logPut byte = iota + 1
+	logDelete
+	logClear
+)
+
+// persistEntry is one item in a snapshot or a log record.
+// the values are gob encoded, so their concrete types must be registered
+// with gob.Register unless they are basic types. Put returns an error for
+// the values which cannot be encoded.
+type persistEntry struct {
+	Key         string
+	Val         interface{}
+	CreatedTime time.Time
+	Lifespan    time.Duration
+	Tags        []string
+}
+
+type logRecord struct {
+	Op    byte
+	Entry persistEntry
+}
+
+// memoryPersist holds the snapshot files of a MemoryCache.
+// the snapshot is written to path, the append-only logs to path.aof.1,
+// path.aof.2... a snapshot starts the next log and deletes the older ones
+// once it is complete, so after a crash or a failed snapshot the logs
+// not covered by the last snapshot are replayed in order.
+type memoryPersist struct {
+	mu         sync.Mutex // serializes the snapshots
+	path       string
+	appendOnly bool
+	log        *os.File
+	enc        *gob.Encoder
+	seq        int // number of the current log
+	ticker     *time.Ticker
+	done       chan struct{}
+
+	// encodable holds the value types known to be encodable.
+	encodable map[reflect.Type]bool
+}
+
+func newPersistEntry(itm *MemoryItem) persistEntry {
+	return persistEntry{
+		Key:         itm.key,
+		Val:         itm.val,
+		CreatedTime: itm.createdTime,
+		Lifespan:    itm.lifespan,
+		Tags:        itm.tags,
+	}
+}
+
+// appendLog records op on itm in the append-only log, if it is enabled.
+// a value which cannot be encoded in a snapshot is rejected.
+// the caller must hold the lock.
+func (bc *MemoryCache) appendLog(op byte, itm *MemoryItem) error {
+	if bc.persist == nil {
+		return nil
+	}
+	if op == logPut {
+		if err := bc.persist.checkEncodable(itm.val); err != nil {
+			return err
+		}
+	}
+	if bc.persist.enc == nil {
+		return nil
+	}
+	rec := logRecord{Op: op}
+	if itm != nil {
+		rec.Entry = newPersistEntry(itm)
+	}
+	return bc.persist.enc.Encode(&rec)
+}
+
+// checkEncodable returns an error if val cannot be gob encoded, the
+// encodable types are remembered. the caller must hold the cache lock.
+func (p *memoryPersist) checkEncodable(val interface{}) error {
+	t := reflect.TypeOf(val)
+	if p.encodable[t] {
+		return nil
+	}
+	if err := gob.NewEncoder(ioutil.Discard).Encode(&persistEntry{Val: val}); err != nil {
+		return fmt.Errorf("cache: value of type %v cannot be snapshotted: %v", t, err)
+	}
+	if p.encodable == nil {
+		p.encodable = make(map[reflect.Type]bool)
+	}
+	p.encodable[t] = true
+	return nil
+}
+
+// startPersist restores the items from the snapshot and its logs,
+// writes a fresh snapshot and snapshots every interval seconds until Close.
+func (bc *MemoryCache) startPersist(path string, interval int, appendOnly bool) error {
+	bc.persist = &memoryPersist{path: path, appendOnly: appendOnly, done: make(chan struct{})}
+	if err := bc.restore(); err != nil {
+		return err
+	}
+	if err := bc.Snapshot(); err != nil {
+		return err
+	}
+	if interval <= 0 {
+		interval = DefaultSnapshotEvery
+	}
+	p := bc.persist
+	p.ticker = time.NewTicker(time.Duration(interval) * time.Second)
+	go func() {
+		for {
+			select {
+			case <-p.ticker.C:
+				if err := bc.Snapshot(); err != nil {
+					log.Println("cache: snapshot", p.path, err)
+				}
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stops the periodic snapshots and closes the append-only log,
+// call Snapshot before to keep the latest items.
+func (bc *MemoryCache) Close() error {
+	p := bc.persist
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	close(p.done)
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+	bc.Lock()
+	defer bc.Unlock()
+	if p.log == nil {
+		return nil
+	}
+	err := p.log.Close()
+	p.log, p.enc = nil, nil
+	return err
+}
+
+// logs returns the append-only logs of the snapshot path, oldest first,
+// and the number of the last one.
+func (p *memoryPersist) logs() (names []string, last int, err error) {
+	infos, err := ioutil.ReadDir(filepath.Dir(p.path))
+	if err != nil {
+		return nil, 0, err
+	}
+	prefix := filepath.Base(p.path) + ".aof."
+	var seqs []int
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), prefix) {
+			continue
+		}
+		if seq, err := strconv.Atoi(info.Name()[len(prefix):]); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Ints(seqs)
+	for _, seq := range seqs {
+		names = append(names, p.logName(seq))
+		last = seq
+	}
+	return names, last, nil
+}
+
+func (p *memoryPersist) logName(seq int) string {
+	return p.path + ".aof." + strconv.Itoa(seq)
+}
+
+// restore loads the snapshot, then replays the logs written after it.
+// the expired items are skipped, the others keep their remaining lifespan.
+func (bc *MemoryCache) restore() error {
+	path := bc.persist.path
+	bc.Lock()
+	defer bc.Unlock()
+	f, err := os.Open(path)
+	if err == nil {
+		dec := gob.NewDecoder(f)
+		for {
+			var entry persistEntry
+			if err = dec.Decode(&entry); err != nil {
+				break
+			}
+			bc.restoreEntry(entry)
+		}
+		f.Close()
+		if err != io.EOF {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	logs, last, err := bc.persist.logs()
+	if err != nil {
+		return err
+	}
+	for _, name := range logs {
+		if err = bc.replayLog(name); err != nil {
+			return err
+		}
+	}
+	bc.persist.seq = last
+	return nil
+}
+
+// replayLog applies the records of the log file name.
+// a record torn by a crash ends the log.
+func (bc *MemoryCache) replayLog(name string) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := gob.NewDecoder(f)
+	for {
+		var rec logRecord
+		if err = dec.Decode(&rec); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		switch rec.Op {
+		case logPut:
+			bc.restoreEntry(rec.Entry)
+		case logDelete:
+			if itm, ok := bc.items[rec.Entry.Key]; ok {
+				bc.removeItem(itm)
+			}
+		case logClear:
+			bc.clear()
+		}
+	}
+}
+
+// restoreEntry puts entry back unless it has expired, the caller must hold the lock.
+func (bc *MemoryCache) restoreEntry(entry persistEntry) {
+	itm := &MemoryItem{
+		key:         entry.Key,
+		val:         entry.Val,
+		createdTime: entry.CreatedTime,
+		lifespan:    entry.Lifespan,
+		tags:        entry.Tags,
+	}
+	if itm.isExpire(bc.now()) {
+		if old, ok := bc.items[itm.key]; ok {
+			bc.removeItem(old)
+		}
+		return
+	}
+	bc.put(itm)
+}
+
+// Snapshot writes all the items to the snapshot file configured in StartAndGC.
+// it runs periodically, call it before exiting to keep the latest items.
+// the items are copied under the lock and written without blocking the cache.
+func (bc *MemoryCache) Snapshot() error {
+	p := bc.persist
+	if p == nil {
+		return errors.New("cache: snapshot is not configured")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bc.Lock()
+	entries := make([]persistEntry, 0, len(bc.items))
+	for _, itm := range bc.items {
+		if !itm.isExpire(bc.now()) {
+			entries = append(entries, newPersistEntry(itm))
+		}
+	}
+	if p.appendOnly {
+		// the writes from now on go to a new log, the current ones
+		// are covered by this snapshot.
+		// a log is never truncated, it may hold writes not in a snapshot.
+		var next *os.File
+		var err error
+		for {
+			p.seq++
+			next, err = os.OpenFile(p.logName(p.seq), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+			if !os.IsExist(err) {
+				break
+			}
+		}
+		if err != nil {
+			bc.Unlock()
+			return err
+		}
+		if p.log != nil {
+			p.log.Close()
+		}
+		p.log, p.enc = next, gob.NewEncoder(next)
+	}
+	bc.Unlock()
+
+	// the logs are kept until the snapshot covering them is written.
+	if err := writeSnapshot(p.path, entries); err != nil {
+		return err
+	}
+	logs, _, err := p.logs()
+	if err != nil {
+		return err
+	}
+	for _, name := range logs {
+		if p.appendOnly && name == p.logName(p.seq) {
+			break
+		}
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSnapshot writes entries to a temporary file and renames it to path,
+// so a crash never leaves a partial snapshot. an entry which cannot be
+// encoded, put before the snapshot was configured, is skipped.
+func writeSnapshot(path string, entries []persistEntry) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := &snapshotWriter{w: f}
+	enc := gob.NewEncoder(w)
+	for i := range entries {
+		if err = enc.Encode(&entries[i]); w.err != nil {
+			err = w.err
+			break
+		}
+		if err != nil {
+			log.Println("cache: snapshot skips", entries[i].Key, err)
+			err = nil
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// snapshotWriter keeps the error of the file, to tell it from the errors
+// of the values which cannot be encoded.
+type snapshotWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (sw *snapshotWriter) Write(b []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	n, err := sw.w.Write(b)
+	sw.err = err
+	return n, err
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemorySnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := `{"interval":60,"snapshot":"` + filepath.Join(dir, "memory.snap") + `"}`
+	ctx := context.Background()
+
+	bm, err := NewCache("memory", config)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	bm.Put(ctx, "forever", "a", 0)
+	bm.Put(ctx, "short", 1, 20*time.Millisecond)
+	bm.(TagCache).PutWithTags(ctx, "tagged", 2, time.Hour, "t")
+	if err = bm.(*MemoryCache).Snapshot(); err != nil {
+		t.Fatal("Snapshot err", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	restored, err := NewCache("memory", config)
+	if err != nil {
+		t.Fatal("restore err", err)
+	}
+	if v, _ := restored.Get(ctx, "forever"); v != "a" {
+		t.Error("forever should be restored", v)
+	}
+	if ok, _ := restored.IsExist(ctx, "short"); ok {
+		t.Error("short has expired and should not be restored")
+	}
+	itm := restored.(*MemoryCache).items["tagged"]
+	if itm == nil || itm.lifespan != time.Hour || time.Since(itm.createdTime) > time.Minute {
+		t.Fatal("tagged should keep its lifespan", itm)
+	}
+	restored.(TagCache).InvalidateTags(ctx, "t")
+	if ok, _ := restored.IsExist(ctx, "tagged"); ok {
+		t.Error("tags should be restored")
+	}
+}
+
+func TestMemoryAppendOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := `{"interval":60,"snapshot":"` + filepath.Join(dir, "memory.snap") + `","appendonly":true}`
+	ctx := context.Background()
+
+	bm, err := NewCache("memory", config)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	// written after the last snapshot, only in the log.
+	bm.Put(ctx, "a", 1, time.Hour)
+	bm.Put(ctx, "b", 2, time.Hour)
+	bm.Incr(ctx, "b")
+	bm.Delete(ctx, "a")
+	bm.Put(ctx, "c", 3, time.Hour)
+	bm.(*MemoryCache).Update(ctx, "c", func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		return nil, 0, nil
+	})
+
+	restored, err := NewCache("memory", config)
+	if err != nil {
+		t.Fatal("restore err", err)
+	}
+	if ok, _ := restored.IsExist(ctx, "a"); ok {
+		t.Error("a was deleted")
+	}
+	if v, _ := restored.Get(ctx, "b"); v != 3 {
+		t.Error("b should be replayed with its increment", v)
+	}
+	if ok, _ := restored.IsExist(ctx, "c"); ok {
+		t.Error("c was deleted by Update")
+	}
+
+	restored.ClearAll(ctx)
+	again, err := NewCache("memory", config)
+	if err != nil {
+		t.Fatal("restore err", err)
+	}
+	if ok, _ := again.IsExist(ctx, "b"); ok {
+		t.Error("ClearAll should be replayed")
+	}
+}
+
+type unregistered struct{ N int }
+
+func TestMemorySnapshotUnencodable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "memory.snap")
+	ctx := context.Background()
+
+	bm := NewMemoryCache()
+	// put before the snapshot is configured, skipped by the snapshot.
+	bm.Put(ctx, "before", unregistered{1}, 0)
+	bm.Put(ctx, "a", "a", 0)
+	if err = bm.StartAndGC(`{"interval":60,"snapshot":"` + path + `","appendonly":true}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	defer bm.Close()
+	if err = bm.Put(ctx, "after", unregistered{2}, 0); err == nil {
+		t.Error("Put of a value which cannot be encoded should fail")
+	}
+	if ok, _ := bm.IsExist(ctx, "after"); ok {
+		t.Error("the rejected value should not be stored")
+	}
+	bm.Put(ctx, "b", "b", 0)
+	if err = bm.Snapshot(); err != nil {
+		t.Fatal("Snapshot err", err)
+	}
+
+	restored := NewMemoryCache()
+	if err = restored.StartAndGC(`{"interval":60,"snapshot":"` + path + `"}`); err != nil {
+		t.Fatal("restore err", err)
+	}
+	defer restored.Close()
+	if v, _ := restored.Get(ctx, "a"); v != "a" {
+		t.Error("a should be restored", v)
+	}
+	if v, _ := restored.Get(ctx, "b"); v != "b" {
+		t.Error("b should be restored", v)
+	}
+}
+
+func TestMemorySnapshotFailureKeepsLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "memory.snap")
+	config := `{"interval":60,"snapshot":"` + path + `","appendonly":true}`
+	ctx := context.Background()
+
+	bm := NewMemoryCache()
+	if err = bm.StartAndGC(config); err != nil {
+		t.Fatal("init err", err)
+	}
+	defer bm.Close()
+	bm.Put(ctx, "a", 1, 0)
+	// the temporary snapshot cannot be created.
+	if err = os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = bm.Snapshot(); err == nil {
+		t.Fatal("Snapshot should fail")
+	}
+	bm.Put(ctx, "b", 2, 0)
+	if err = bm.Snapshot(); err == nil {
+		t.Fatal("Snapshot should fail")
+	}
+	bm.Put(ctx, "c", 3, 0)
+
+	restored := NewMemoryCache()
+	if err = restored.StartAndGC(`{"interval":60,"snapshot":"` + path + `","appendonly":true}`); err == nil {
+		t.Fatal("the snapshot of the restore should fail")
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if ok, _ := restored.IsExist(ctx, key); !ok {
+			t.Error(key, "should be replayed from the logs")
+		}
+	}
+	restored.Close()
+
+	os.Remove(path + ".tmp")
+	if err = bm.Snapshot(); err != nil {
+		t.Fatal("Snapshot err", err)
+	}
+	logs, _ := filepath.Glob(path + ".aof*")
+	if len(logs) != 1 {
+		t.Error("the logs covered by the snapshot should be deleted", logs)
+	}
+}
+
+func TestMemoryClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bm := NewMemoryCache()
+	if err = bm.StartAndGC(`{"interval":60,"snapshot":"` + filepath.Join(dir, "memory.snap") + `","appendonly":true}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	if err = bm.Close(); err != nil {
+		t.Fatal("Close err", err)
+	}
+	if err = bm.Put(context.Background(), "a", 1, 0); err != nil {
+		t.Error("Put after Close err", err)
+	}
+	if err = bm.Close(); err != nil {
+		t.Error("second Close err", err)
+	}
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// PutWithTags puts value like Put and attaches tags to it.
+// putting the key again without tags detaches them.
+func (bc *MemoryCache) PutWithTags(ctx context.Context, name string, value interface{}, lifespan time.Duration, tags ...string) error {
+	bc.Lock()
+	evicted, err := bc.put(&MemoryItem{
+		key:         name,
+		val:         value,
+		createdTime: bc.now(),
+		lifespan:    lifespan,
+		tags:        tags,
+	})
+	onEvicted := bc.onEvicted
+	bc.Unlock()
+	bc.notifyEvicted(onEvicted, evicted)
+	return err
+}
+
+// InvalidateTags deletes the items having one of tags.
+func (bc *MemoryCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	bc.Lock()
+	defer bc.Unlock()
+	for _, tag := range tags {
+		for key := range bc.tags[tag] {
+			if itm, ok := bc.items[key]; ok {
+				bc.deleteItem(itm)
+			}
+		}
+	}
+	return nil
+}
+
+// DeletePrefix deletes the items whose key starts with prefix.
+func (bc *MemoryCache) DeletePrefix(ctx context.Context, prefix string) error {
+	bc.Lock()
+	defer bc.Unlock()
+	for key, itm := range bc.items {
+		if strings.HasPrefix(key, prefix) {
+			bc.deleteItem(itm)
+		}
+	}
+	return nil
+}
+
+// indexTags adds itm to the index of its tags, the caller must hold the lock.
+func (bc *MemoryCache) indexTags(itm *MemoryItem) {
+	if len(itm.tags) == 0 {
+		return
+	}
+	if bc.tags == nil {
+		bc.tags = make(map[string]map[string]struct{})
+	}
+	for _, tag := range itm.tags {
+		keys, ok := bc.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			bc.tags[tag] = keys
+		}
+		keys[itm.key] = struct{}{}
+	}
+}
+
+// unindexTags removes itm from the index of its tags, the caller must hold the lock.
+func (bc *MemoryCache) unindexTags(itm *MemoryItem) {
+	for _, tag := range itm.tags {
+		keys := bc.tags[tag]
+		delete(keys, itm.key)
+		if len(keys) == 0 {
+			delete(bc.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryTags(t *testing.T) {
+	for _, name := range []string{"memory", "shardedmemory"} {
+		c, err := NewCache(name, `{"interval":60}`)
+		if err != nil {
+			t.Fatal("init err", err)
+		}
+		tc := c.(TagCache)
+		ctx := context.Background()
+		tc.PutWithTags(ctx, "profile:42", 1, time.Minute, "user:42")
+		tc.PutWithTags(ctx, "orders:42", 2, time.Minute, "user:42", "orders")
+		tc.PutWithTags(ctx, "orders:43", 3, time.Minute, "orders")
+		tc.PutWithTags(ctx, "profile:43", 4, time.Minute, "user:43")
+		// putting again without tags detaches them.
+		tc.Put(ctx, "profile:43", 4, time.Minute)
+
+		if err = tc.InvalidateTags(ctx, "user:42", "user:43"); err != nil {
+			t.Error(name, "InvalidateTags err", err)
+		}
+		for key, exist := range map[string]bool{"profile:42": false, "orders:42": false, "orders:43": true, "profile:43": true} {
+			if ok, _ := tc.IsExist(ctx, key); ok != exist {
+				t.Errorf("%s: %s exists %v, want %v", name, key, ok, exist)
+			}
+		}
+
+		tc.Put(ctx, "order", 5, time.Minute)
+		if err = tc.DeletePrefix(ctx, "orders:"); err != nil {
+			t.Error(name, "DeletePrefix err", err)
+		}
+		if ok, _ := tc.IsExist(ctx, "orders:43"); ok {
+			t.Error(name, "orders:43 should be deleted by prefix")
+		}
+		if ok, _ := tc.IsExist(ctx, "order"); !ok {
+			t.Error(name, "order does not have the prefix")
+		}
+	}
+}
+
+func TestMemoryTagsIndex(t *testing.T) {
+	bm := NewMemoryCache()
+	ctx := context.Background()
+	bm.PutWithTags(ctx, "a", 1, time.Minute, "t")
+	bm.Delete(ctx, "a")
+	if len(bm.tags) != 0 {
+		t.Error("deleted items should leave the tag index", bm.tags)
+	}
+	bm.PutWithTags(ctx, "a", 1, time.Minute, "t")
+	bm.ClearAll(ctx)
+	bm.PutWithTags(ctx, "b", 1, time.Minute, "t")
+	bm.InvalidateTags(ctx, "t")
+	if len(bm.items) != 0 || len(bm.tags) != 0 {
+		t.Error("InvalidateTags should remove the items and the tag", bm.items, bm.tags)
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	if got := escapeGlob(`a*b?[c]\`); got != `a\*b\?\[c\]\\` {
+		t.Error("escapeGlob got", got)
+	}
+}
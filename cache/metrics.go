@@ -0,0 +1,514 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Op describes one operation of an instrumented cache.
+type Op struct {
+	Adapter string
+	// Name is the Cache method in lower case, like get or put.
+	Name   string
+	Prefix string
+	// Hits and Misses count the keys found and not found by get, getmulti and isexist.
+	Hits     int
+	Misses   int
+	Err      error
+	Duration time.Duration
+}
+
+// Observer receives the operations and evictions of an instrumented cache.
+// it is called synchronously, so it must be fast and safe for concurrent use.
+type Observer interface {
+	ObserveOp(op Op)
+	ObserveEviction(adapter, prefix string)
+}
+
+// OtherPrefix is the prefix of the keys without a colon.
+const OtherPrefix = "other"
+
+// KeyPrefix returns the part of key before the first colon, or OtherPrefix
+// if it has no colon, so such keys do not add a series each.
+// it is the default prefix of InstrumentedCache.
+func KeyPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return OtherPrefix
+}
+
+// InstrumentedCache wraps a Cache and reports every operation to an Observer.
+// the TagCache methods, PutStruct and GetInto are forwarded to the wrapped
+// cache and return an error when it does not implement them.
+// usage:
+//	metrics := cache.NewMetrics()
+//	bm, err := cache.NewInstrumentedCache("redis", `{"conn":"127.0.0.1:6379"}`, metrics)
+//	http.Handle("/metrics", metrics)
+type InstrumentedCache struct {
+	Cache
+	// Prefix groups keys in the reported operations, it defaults to KeyPrefix.
+	// keep the number of prefixes small, each one is a time series.
+	Prefix func(key string) string
+
+	adapter   string
+	observer  Observer
+	mu        sync.RWMutex
+	onEvicted EvictedFunc
+}
+
+// evictedFuncer is implemented by the caches whose OnEvicted function can be read.
+type evictedFuncer interface {
+	evictedFunc() EvictedFunc
+}
+
+// Instrument returns c reporting to o under the adapter name.
+// if c reports evictions, like MemoryCache, they are observed as well and
+// passed on to the OnEvicted function c already had, which the OnEvicted
+// of the returned cache replaces.
+func Instrument(adapter string, c Cache, o Observer) *InstrumentedCache {
+	ic := &InstrumentedCache{Cache: c, Prefix: KeyPrefix, adapter: adapter, observer: o}
+	if ec, ok := c.(interface{ OnEvicted(EvictedFunc) }); ok {
+		if ef, ok := c.(evictedFuncer); ok {
+			ic.onEvicted = ef.evictedFunc()
+		}
+		ec.OnEvicted(ic.evicted)
+	}
+	return ic
+}
+
+// NewInstrumentedCache creates a cache like NewCache and instruments it with o.
+func NewInstrumentedCache(adapterName, config string, o Observer) (*InstrumentedCache, error) {
+	c, err := NewCache(adapterName, config)
+	if err != nil {
+		return nil, err
+	}
+	return Instrument(adapterName, c, o), nil
+}
+
+// OnEvicted sets the function called when an item of the wrapped cache
+// is evicted or expires.
+func (ic *InstrumentedCache) OnEvicted(f EvictedFunc) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.onEvicted = f
+}
+
+func (ic *InstrumentedCache) evictedFunc() EvictedFunc {
+	ic.mu.RLock()
+	defer ic.mu.RUnlock()
+	return ic.onEvicted
+}
+
+func (ic *InstrumentedCache) evicted(key string, val interface{}) {
+	ic.observer.ObserveEviction(ic.adapter, ic.Prefix(key))
+	ic.mu.RLock()
+	f := ic.onEvicted
+	ic.mu.RUnlock()
+	if f != nil {
+		f(key, val)
+	}
+}
+
+// observe reports the operation name on key started at start.
+func (ic *InstrumentedCache) observe(name, key string, start time.Time, hits, misses int, err error) {
+	ic.observer.ObserveOp(Op{
+		Adapter:  ic.adapter,
+		Name:     name,
+		Prefix:   ic.Prefix(key),
+		Hits:     hits,
+		Misses:   misses,
+		Err:      err,
+		Duration: time.Since(start),
+	})
+}
+
+// Get gets the value of key, a ErrCacheMiss is reported as a miss.
+func (ic *InstrumentedCache) Get(ctx context.Context, key string) (interface{}, error) {
+	start := time.Now()
+	v, err := ic.Cache.Get(ctx, key)
+	switch err {
+	case nil:
+		ic.observe("get", key, start, 1, 0, nil)
+	case ErrCacheMiss:
+		ic.observe("get", key, start, 0, 1, nil)
+	default:
+		ic.observe("get", key, start, 0, 0, err)
+	}
+	return v, err
+}
+
+// GetMulti gets the values of keys, it is reported under the prefix of the first key.
+func (ic *InstrumentedCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	start := time.Now()
+	values, err := ic.Cache.GetMulti(ctx, keys)
+	var hits, misses int
+	if err == nil {
+		for _, v := range values {
+			if v == nil {
+				misses++
+			} else {
+				hits++
+			}
+		}
+	}
+	var key string
+	if len(keys) > 0 {
+		key = keys[0]
+	}
+	ic.observe("getmulti", key, start, hits, misses, err)
+	return values, err
+}
+
+// Put stores val under key.
+func (ic *InstrumentedCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	start := time.Now()
+	err := ic.Cache.Put(ctx, key, val, timeout)
+	ic.observe("put", key, start, 0, 0, err)
+	return err
+}
+
+// Delete deletes key.
+func (ic *InstrumentedCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := ic.Cache.Delete(ctx, key)
+	ic.observe("delete", key, start, 0, 0, err)
+	return err
+}
+
+// Incr increases the counter of key.
+func (ic *InstrumentedCache) Incr(ctx context.Context, key string) error {
+	start := time.Now()
+	err := ic.Cache.Incr(ctx, key)
+	ic.observe("incr", key, start, 0, 0, err)
+	return err
+}
+
+// Decr decreases the counter of key.
+func (ic *InstrumentedCache) Decr(ctx context.Context, key string) error {
+	start := time.Now()
+	err := ic.Cache.Decr(ctx, key)
+	ic.observe("decr", key, start, 0, 0, err)
+	return err
+}
+
+// IsExist checks if key exists, it is reported as a hit or a miss.
+func (ic *InstrumentedCache) IsExist(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	ok, err := ic.Cache.IsExist(ctx, key)
+	switch {
+	case err != nil:
+		ic.observe("isexist", key, start, 0, 0, err)
+	case ok:
+		ic.observe("isexist", key, start, 1, 0, nil)
+	default:
+		ic.observe("isexist", key, start, 0, 1, nil)
+	}
+	return ok, err
+}
+
+// ClearAll clears the wrapped cache, it is reported with an empty prefix.
+func (ic *InstrumentedCache) ClearAll(ctx context.Context) error {
+	start := time.Now()
+	err := ic.Cache.ClearAll(ctx)
+	ic.observer.ObserveOp(Op{Adapter: ic.adapter, Name: "clearall", Err: err, Duration: time.Since(start)})
+	return err
+}
+
+// unsupported is the error of the methods the wrapped cache does not implement.
+func (ic *InstrumentedCache) unsupported(method string) error {
+	return fmt.Errorf("cache: %s adapter does not support %s", ic.adapter, method)
+}
+
+// PutWithTags puts val like Put and attaches tags to it.
+func (ic *InstrumentedCache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	start := time.Now()
+	err := ic.unsupported("tags")
+	if tc, ok := ic.Cache.(TagCache); ok {
+		err = tc.PutWithTags(ctx, key, val, timeout, tags...)
+	}
+	ic.observe("put", key, start, 0, 0, err)
+	return err
+}
+
+// InvalidateTags deletes the entries having one of tags, it is reported with an empty prefix.
+func (ic *InstrumentedCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	start := time.Now()
+	err := ic.unsupported("tags")
+	if tc, ok := ic.Cache.(TagCache); ok {
+		err = tc.InvalidateTags(ctx, tags...)
+	}
+	ic.observer.ObserveOp(Op{Adapter: ic.adapter, Name: "invalidatetags", Err: err, Duration: time.Since(start)})
+	return err
+}
+
+// DeletePrefix deletes the entries whose key starts with prefix.
+func (ic *InstrumentedCache) DeletePrefix(ctx context.Context, prefix string) error {
+	start := time.Now()
+	err := ic.unsupported("tags")
+	if tc, ok := ic.Cache.(TagCache); ok {
+		err = tc.DeletePrefix(ctx, prefix)
+	}
+	ic.observe("deleteprefix", prefix, start, 0, 0, err)
+	return err
+}
+
+// PutStruct encodes and stores val, like RedisCache.PutStruct.
+func (ic *InstrumentedCache) PutStruct(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	start := time.Now()
+	err := ic.unsupported("PutStruct")
+	if sc, ok := ic.Cache.(interface {
+		PutStruct(ctx context.Context, key string, val interface{}, timeout time.Duration) error
+	}); ok {
+		err = sc.PutStruct(ctx, key, val, timeout)
+	}
+	ic.observe("put", key, start, 0, 0, err)
+	return err
+}
+
+// GetInto decodes the value stored by PutStruct into dst, like RedisCache.GetInto.
+// a ErrCacheMiss is reported as a miss.
+func (ic *InstrumentedCache) GetInto(ctx context.Context, key string, dst interface{}) error {
+	start := time.Now()
+	err := ic.unsupported("GetInto")
+	if sc, ok := ic.Cache.(interface {
+		GetInto(ctx context.Context, key string, dst interface{}) error
+	}); ok {
+		err = sc.GetInto(ctx, key, dst)
+	}
+	switch err {
+	case nil:
+		ic.observe("get", key, start, 1, 0, nil)
+	case ErrCacheMiss:
+		ic.observe("get", key, start, 0, 1, nil)
+	default:
+		ic.observe("get", key, start, 0, 0, err)
+	}
+	return err
+}
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the latency histogram.
+var DefaultLatencyBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+
+type prefixLabels struct {
+	adapter, prefix string
+}
+
+type opLabels struct {
+	adapter, prefix, op string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics is an Observer counting hits, misses, errors, evictions and
+// latencies per adapter and key prefix. it is exported in the prometheus
+// text format by ServeHTTP and WriteTo.
+type Metrics struct {
+	mu        sync.Mutex
+	buckets   []float64
+	hits      map[prefixLabels]uint64
+	misses    map[prefixLabels]uint64
+	evictions map[prefixLabels]uint64
+	errors    map[opLabels]uint64
+	latencies map[opLabels]*histogram
+}
+
+// NewMetrics returns a Metrics with DefaultLatencyBuckets.
+func NewMetrics() *Metrics {
+	return NewMetricsWithBuckets(DefaultLatencyBuckets)
+}
+
+// NewMetricsWithBuckets returns a Metrics with the latency buckets,
+// upper bounds in seconds in increasing order.
+func NewMetricsWithBuckets(buckets []float64) *Metrics {
+	return &Metrics{
+		buckets:   buckets,
+		hits:      make(map[prefixLabels]uint64),
+		misses:    make(map[prefixLabels]uint64),
+		evictions: make(map[prefixLabels]uint64),
+		errors:    make(map[opLabels]uint64),
+		latencies: make(map[opLabels]*histogram),
+	}
+}
+
+// ObserveOp implements Observer.
+func (m *Metrics) ObserveOp(op Op) {
+	pl := prefixLabels{op.Adapter, op.Prefix}
+	ol := opLabels{op.Adapter, op.Prefix, op.Name}
+	seconds := op.Duration.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if op.Hits > 0 {
+		m.hits[pl] += uint64(op.Hits)
+	}
+	if op.Misses > 0 {
+		m.misses[pl] += uint64(op.Misses)
+	}
+	if op.Err != nil {
+		m.errors[ol]++
+	}
+	h, ok := m.latencies[ol]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latencies[ol] = h
+	}
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// ObserveEviction implements Observer.
+func (m *Metrics) ObserveEviction(adapter, prefix string) {
+	m.mu.Lock()
+	m.evictions[prefixLabels{adapter, prefix}]++
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the metrics in the prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the prometheus text format to w.
+// the metrics are copied first, a slow w does not block the observations.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	s := m.snapshot()
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	writeCounters(cw, "cache_hits_total", "Keys found in the cache.", s.hits)
+	writeCounters(cw, "cache_misses_total", "Keys not found in the cache.", s.misses)
+	writeCounters(cw, "cache_evictions_total", "Items evicted or expired.", s.evictions)
+	fmt.Fprintf(cw, "# HELP cache_errors_total Failed cache operations.\n# TYPE cache_errors_total counter\n")
+	for _, l := range sortedOpLabels(s.errors) {
+		fmt.Fprintf(cw, "cache_errors_total{%s} %d\n", l.String(), s.errors[l])
+	}
+	fmt.Fprintf(cw, "# HELP cache_operation_duration_seconds Latency of cache operations.\n# TYPE cache_operation_duration_seconds histogram\n")
+	keys := make([]opLabels, 0, len(s.latencies))
+	for l := range s.latencies {
+		keys = append(keys, l)
+	}
+	sortOpLabels(keys)
+	for _, l := range keys {
+		h := s.latencies[l]
+		var cumulative uint64
+		for i, bound := range s.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(cw, "cache_operation_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				l.String(), strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(cw, "cache_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l.String(), h.count)
+		fmt.Fprintf(cw, "cache_operation_duration_seconds_sum{%s} %s\n", l.String(), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(cw, "cache_operation_duration_seconds_count{%s} %d\n", l.String(), h.count)
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// snapshot returns a copy of the counters and histograms of m.
+func (m *Metrics) snapshot() *Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &Metrics{
+		buckets:   m.buckets,
+		hits:      copyCounters(m.hits),
+		misses:    copyCounters(m.misses),
+		evictions: copyCounters(m.evictions),
+		errors:    make(map[opLabels]uint64, len(m.errors)),
+		latencies: make(map[opLabels]*histogram, len(m.latencies)),
+	}
+	for l, n := range m.errors {
+		s.errors[l] = n
+	}
+	for l, h := range m.latencies {
+		s.latencies[l] = &histogram{counts: append([]uint64(nil), h.counts...), sum: h.sum, count: h.count}
+	}
+	return s
+}
+
+func copyCounters(counters map[prefixLabels]uint64) map[prefixLabels]uint64 {
+	c := make(map[prefixLabels]uint64, len(counters))
+	for l, n := range counters {
+		c[l] = n
+	}
+	return c
+}
+
+func writeCounters(w io.Writer, name, help string, counters map[prefixLabels]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]prefixLabels, 0, len(counters))
+	for l := range counters {
+		keys = append(keys, l)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].adapter != keys[j].adapter {
+			return keys[i].adapter < keys[j].adapter
+		}
+		return keys[i].prefix < keys[j].prefix
+	})
+	for _, l := range keys {
+		fmt.Fprintf(w, "%s{adapter=\"%s\",prefix=\"%s\"} %d\n",
+			name, escapeLabel(l.adapter), escapeLabel(l.prefix), counters[l])
+	}
+}
+
+func (l opLabels) String() string {
+	return fmt.Sprintf("adapter=\"%s\",prefix=\"%s\",op=\"%s\"",
+		escapeLabel(l.adapter), escapeLabel(l.prefix), escapeLabel(l.op))
+}
+
+func sortedOpLabels(m map[opLabels]uint64) []opLabels {
+	keys := make([]opLabels, 0, len(m))
+	for l := range m {
+		keys = append(keys, l)
+	}
+	sortOpLabels(keys)
+	return keys
+}
+
+func sortOpLabels(keys []opLabels) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// countWriter counts the bytes written and keeps the first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
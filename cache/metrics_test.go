@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedCache(t *testing.T) {
+	metrics := NewMetrics()
+	bm, err := NewInstrumentedCache("memory", `{"interval":60,"maxentries":1,"policy":"lru"}`, metrics)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	var evicted []string
+	bm.OnEvicted(func(key string, val interface{}) { evicted = append(evicted, key) })
+	ctx := context.Background()
+
+	bm.Put(ctx, "user:1", 1, time.Minute)
+	bm.Get(ctx, "user:1")
+	bm.Get(ctx, "user:2")
+	bm.Put(ctx, "session:1", 1, time.Minute)
+	bm.GetMulti(ctx, []string{"session:1", "session:2"})
+	if len(evicted) != 1 || evicted[0] != "user:1" {
+		t.Error("OnEvicted should still be called", evicted)
+	}
+
+	var buf bytes.Buffer
+	if _, err = metrics.WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo err", err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		`cache_hits_total{adapter="memory",prefix="user"} 1`,
+		`cache_misses_total{adapter="memory",prefix="user"} 1`,
+		`cache_hits_total{adapter="memory",prefix="session"} 1`,
+		`cache_misses_total{adapter="memory",prefix="session"} 1`,
+		`cache_evictions_total{adapter="memory",prefix="user"} 1`,
+		`cache_operation_duration_seconds_count{adapter="memory",prefix="user",op="get"} 2`,
+		`cache_operation_duration_seconds_bucket{adapter="memory",prefix="session",op="put",le="+Inf"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics should contain %s, got\n%s", line, out)
+		}
+	}
+}
+
+type failingCache struct {
+	MemoryCache
+}
+
+func (fc *failingCache) Get(ctx context.Context, key string) (interface{}, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestMetricsErrors(t *testing.T) {
+	metrics := NewMetricsWithBuckets([]float64{1})
+	bm := Instrument("redis", &failingCache{}, metrics)
+	bm.Get(context.Background(), `a"b:1`)
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	out := buf.String()
+	if !strings.Contains(out, `cache_errors_total{adapter="redis",prefix="a\"b",op="get"} 1`) {
+		t.Error("errors should be counted with escaped labels, got\n", out)
+	}
+	if strings.Contains(out, "cache_misses_total{") {
+		t.Error("an error should not be counted as a miss")
+	}
+	if !strings.Contains(out, `le="1"} 1`) {
+		t.Error("custom buckets should be used, got\n", out)
+	}
+}
+
+// blockingWriter blocks the writes until release is closed.
+type blockingWriter struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.writing:
+	default:
+		close(w.writing)
+	}
+	<-w.release
+	return len(p), nil
+}
+
+func TestMetricsSlowScraper(t *testing.T) {
+	metrics := NewMetrics()
+	// enough series to fill the buffer of WriteTo.
+	for i := 0; i < 200; i++ {
+		metrics.ObserveEviction("memory", "prefix"+strconv.Itoa(i))
+	}
+	w := &blockingWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	defer close(w.release)
+	go metrics.WriteTo(w)
+	<-w.writing
+
+	observed := make(chan struct{})
+	go func() {
+		metrics.ObserveEviction("memory", "user")
+		close(observed)
+	}()
+	select {
+	case <-observed:
+	case <-time.After(time.Second):
+		t.Fatal("a slow scraper should not block the observations")
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	if p := KeyPrefix("user:1"); p != "user" {
+		t.Error("prefix error", p)
+	}
+	if p := KeyPrefix("token123"); p != OtherPrefix {
+		t.Error("a key without a colon should be in the other prefix", p)
+	}
+}
+
+func TestInstrumentedCacheForwards(t *testing.T) {
+	bm := NewMemoryCache()
+	if err := bm.StartAndGC(`{"interval":60,"maxentries":1}`); err != nil {
+		t.Fatal("init err", err)
+	}
+	var evicted []string
+	bm.OnEvicted(func(key string, val interface{}) { evicted = append(evicted, key) })
+	metrics := NewMetrics()
+	ic := Instrument("memory", bm, metrics)
+	ctx := context.Background()
+
+	ic.Put(ctx, "user:1", 1, time.Minute)
+	ic.Put(ctx, "user:2", 2, time.Minute)
+	if len(evicted) != 1 || evicted[0] != "user:1" {
+		t.Error("the OnEvicted of the wrapped cache should still be called", evicted)
+	}
+
+	var tc TagCache = ic
+	if err := tc.PutWithTags(ctx, "user:3", 3, time.Minute, "t"); err != nil {
+		t.Fatal("PutWithTags err", err)
+	}
+	if err := tc.InvalidateTags(ctx, "t"); err != nil {
+		t.Fatal("InvalidateTags err", err)
+	}
+	if ok, _ := ic.IsExist(ctx, "user:3"); ok {
+		t.Error("InvalidateTags should be forwarded")
+	}
+	if err := ic.PutStruct(ctx, "user:4", struct{}{}, time.Minute); err == nil {
+		t.Error("PutStruct of a cache without it should fail")
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"libs/cache"
+)
+
+// MemoryStore keeps the limiter state in a MemoryCache,
+// the limits apply to one process.
+type MemoryStore struct {
+	mc *cache.MemoryCache
+}
+
+// NewMemoryStore returns a MemoryStore on mc.
+func NewMemoryStore(mc *cache.MemoryCache) *MemoryStore {
+	return &MemoryStore{mc: mc}
+}
+
+type bucketState struct {
+	tokens float64
+	ts     int64
+}
+
+type windowState struct {
+	hits []int64
+}
+
+type gcraState struct {
+	tat float64
+}
+
+func (s *MemoryStore) take(ctx context.Context, alg algorithm, key string, l Limit, now time.Time) (res *Result, err error) {
+	nowMs := toMillis(now)
+	err = s.mc.Update(ctx, key, func(val interface{}, exist bool) (interface{}, time.Duration, error) {
+		var state interface{}
+		var ttl time.Duration
+		switch alg {
+		case tokenBucket:
+			st, _ := val.(*bucketState)
+			res, state, ttl = takeTokenBucket(st, l, nowMs)
+		case slidingWindow:
+			st, _ := val.(*windowState)
+			res, state, ttl = takeSlidingWindow(st, l, nowMs)
+		default:
+			st, _ := val.(*gcraState)
+			res, state, ttl = takeGCRA(st, l, nowMs)
+		}
+		return state, ttl, nil
+	})
+	return res, err
+}
+
+// takeTokenBucket mirrors tokenBucketScript.
+func takeTokenBucket(st *bucketState, l Limit, now int64) (*Result, interface{}, time.Duration) {
+	rate := float64(l.Rate) / durationMillis(l.Period)
+	burst := float64(l.burst())
+	if st == nil {
+		st = &bucketState{tokens: burst, ts: now}
+	}
+	elapsed := math.Max(0, float64(now-st.ts))
+	tokens := math.Min(burst, st.tokens+elapsed*rate)
+	res := &Result{}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = millisDuration(math.Ceil((1 - tokens) / rate))
+	}
+	res.Remaining = int(tokens)
+	ttl := millisDuration(math.Ceil(burst / rate))
+	return res, &bucketState{tokens: tokens, ts: now}, ttl
+}
+
+// takeSlidingWindow mirrors slidingWindowScript.
+func takeSlidingWindow(st *windowState, l Limit, now int64) (*Result, interface{}, time.Duration) {
+	window := int64(durationMillis(l.Period))
+	var hits []int64
+	if st != nil {
+		for _, hit := range st.hits {
+			if hit > now-window {
+				hits = append(hits, hit)
+			}
+		}
+	}
+	res := &Result{}
+	if len(hits) < l.Rate {
+		hits = append(hits, now)
+		res.Allowed = true
+		res.Remaining = l.Rate - len(hits)
+	} else {
+		res.RetryAfter = millisDuration(float64(hits[0] + window - now))
+	}
+	return res, &windowState{hits: hits}, l.Period
+}
+
+// takeGCRA mirrors gcraScript.
+func takeGCRA(st *gcraState, l Limit, now int64) (*Result, interface{}, time.Duration) {
+	interval := durationMillis(l.interval())
+	tolerance := interval * float64(l.burst())
+	tat := float64(now)
+	if st != nil && st.tat > tat {
+		tat = st.tat
+	}
+	newTat := tat + interval
+	allowAt := newTat - tolerance
+	if float64(now) < allowAt {
+		res := &Result{RetryAfter: millisDuration(allowAt - float64(now))}
+		if st == nil {
+			return res, nil, 0
+		}
+		return res, st, millisDuration(math.Ceil(st.tat - float64(now)))
+	}
+	res := &Result{
+		Allowed:   true,
+		Remaining: int((tolerance - (newTat - float64(now))) / interval),
+	}
+	return res, &gcraState{tat: newTat}, millisDuration(math.Ceil(newTat - float64(now)))
+}
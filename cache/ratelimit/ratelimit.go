@@ -0,0 +1,121 @@
+// Package ratelimit provides token bucket, sliding window log and GCRA
+// rate limiters keeping their state in a cache adapter.
+//
+// Usage:
+// import(
+//   "libs/cache"
+//   "libs/cache/ratelimit"
+// )
+//
+//	rc, _ := cache.NewCache("redis", `{"key":"ratelimit","conn":"127.0.0.1:6379"}`)
+//	limiter := ratelimit.NewGCRA(ratelimit.NewRedisStore(rc.(*cache.RedisCache)), ratelimit.Limit{Rate: 100, Period: time.Minute, Burst: 10})
+//	http.Handle("/api/", ratelimit.Middleware(limiter, ratelimit.KeyByIP)(apiHandler))
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Limit allows Rate requests per Period.
+// Burst is the number of requests allowed at once,
+// it defaults to Rate and is not used by the sliding window log.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// interval returns the time between two requests at the steady rate.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+// Result is the outcome of Allow.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of requests still allowed right now.
+	Remaining int
+	// RetryAfter is how long to wait before the next request is allowed,
+	// it is 0 when the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a request identified by key is allowed.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (*Result, error)
+}
+
+type algorithm int
+
+const (
+	tokenBucket algorithm = iota
+	slidingWindow
+	gcra
+)
+
+// Store keeps the state of the limiters, see NewRedisStore and NewMemoryStore.
+type Store interface {
+	take(ctx context.Context, alg algorithm, key string, l Limit, now time.Time) (*Result, error)
+}
+
+// RateLimiter is a Limiter running one algorithm on a Store.
+type RateLimiter struct {
+	store Store
+	alg   algorithm
+	limit Limit
+	now   func() time.Time
+}
+
+var errInvalidLimit = errors.New("ratelimit: rate and period must be positive")
+
+func newRateLimiter(store Store, alg algorithm, limit Limit) *RateLimiter {
+	return &RateLimiter{store: store, alg: alg, limit: limit, now: time.Now}
+}
+
+// NewTokenBucket returns a token bucket limiter, the bucket holds Burst tokens
+// and is refilled with Rate tokens per Period.
+func NewTokenBucket(store Store, limit Limit) *RateLimiter {
+	return newRateLimiter(store, tokenBucket, limit)
+}
+
+// NewSlidingWindow returns a sliding window log limiter allowing Rate requests
+// in any window of Period. it keeps the time of every request.
+func NewSlidingWindow(store Store, limit Limit) *RateLimiter {
+	return newRateLimiter(store, slidingWindow, limit)
+}
+
+// NewGCRA returns a generic cell rate algorithm limiter spacing requests by
+// Period/Rate with a tolerance of Burst requests. it keeps one timestamp per key.
+func NewGCRA(store Store, limit Limit) *RateLimiter {
+	return newRateLimiter(store, gcra, limit)
+}
+
+// Allow takes one request for key.
+func (rl *RateLimiter) Allow(ctx context.Context, key string) (*Result, error) {
+	if rl.limit.Rate <= 0 || rl.limit.Period <= 0 {
+		return nil, errInvalidLimit
+	}
+	return rl.store.take(ctx, rl.alg, key, rl.limit, rl.now())
+}
+
+// toMillis returns t in milliseconds, the unit of the stored state.
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func millisDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"libs/cache"
+)
+
+// fakeClock returns a now func starting at a fixed time and a func to advance it.
+func fakeClock() (func() time.Time, func(time.Duration)) {
+	now := time.Unix(1500000000, 0)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func allowN(t *testing.T, rl *RateLimiter, key string, n int) *Result {
+	var res *Result
+	var err error
+	for i := 0; i < n; i++ {
+		if res, err = rl.Allow(context.Background(), key); err != nil {
+			t.Fatal("Allow err", err)
+		}
+	}
+	return res
+}
+
+func TestLimiters(t *testing.T) {
+	limit := Limit{Rate: 10, Period: time.Second, Burst: 5}
+	tests := []struct {
+		name   string
+		new    func(Store, Limit) *RateLimiter
+		burst  int
+		refill time.Duration
+	}{
+		{"tokenbucket", NewTokenBucket, 5, 100 * time.Millisecond},
+		{"slidingwindow", NewSlidingWindow, 10, time.Second},
+		{"gcra", NewGCRA, 5, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		rl := tt.new(NewMemoryStore(cache.NewMemoryCache()), limit)
+		now, advance := fakeClock()
+		rl.now = now
+
+		res := allowN(t, rl, "user", tt.burst)
+		if !res.Allowed || res.Remaining != 0 {
+			t.Errorf("%s: request %d should be the last allowed, got %+v", tt.name, tt.burst, res)
+		}
+		res = allowN(t, rl, "user", 1)
+		if res.Allowed || res.RetryAfter != tt.refill {
+			t.Errorf("%s: request over the burst should wait %v, got %+v", tt.name, tt.refill, res)
+		}
+		if res = allowN(t, rl, "other", 1); !res.Allowed {
+			t.Errorf("%s: keys should be limited separately", tt.name)
+		}
+		advance(tt.refill)
+		if res = allowN(t, rl, "user", 1); !res.Allowed {
+			t.Errorf("%s: request after RetryAfter should be allowed, got %+v", tt.name, res)
+		}
+	}
+}
+
+func TestInvalidLimit(t *testing.T) {
+	rl := NewGCRA(NewMemoryStore(cache.NewMemoryCache()), Limit{Period: time.Second})
+	if _, err := rl.Allow(context.Background(), "user"); err != errInvalidLimit {
+		t.Error("zero rate should be rejected", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	rl := NewGCRA(NewMemoryStore(cache.NewMemoryCache()), Limit{Rate: 1, Period: 90 * time.Second})
+	h := Middleware(rl, KeyByIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Error("first request should pass", w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Error("second request should be limited", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "90" {
+		t.Error("Retry-After should be 90, got", got)
+	}
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"libs/cache"
+)
+
+// tokenBucketScript refills the bucket for the elapsed time and takes a token.
+// ARGV: tokens per ms, burst, now in ms, ttl in ms.
+var tokenBucketScript = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return {allowed, math.floor(tokens), retry}`)
+
+// slidingWindowScript keeps the request times of the last window in a sorted set.
+// ARGV: limit, window in ms, now in ms, unique member.
+var slidingWindowScript = redis.NewScript(1, `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	return {1, limit - count - 1, 0}
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, 0, tonumber(oldest[2]) + window - now}`)
+
+// gcraScript keeps the theoretical arrival time of the next request.
+// ARGV: emission interval in ms, tolerance in ms, now in ms.
+var gcraScript = redis.NewScript(1, `
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+local newTat = tat + interval
+local allowAt = newTat - tolerance
+if now < allowAt then
+	return {0, 0, math.ceil(allowAt - now)}
+end
+redis.call("SET", KEYS[1], newTat, "PX", math.ceil(newTat - now))
+return {1, math.floor((tolerance - (newTat - now)) / interval), 0}`)
+
+// RedisStore keeps the limiter state in a RedisCache, the limits apply
+// to every instance sharing the redis. each check is one atomic lua script,
+// the time is taken from the caller, so keep the clocks synchronized.
+type RedisStore struct {
+	rc *cache.RedisCache
+}
+
+// NewRedisStore returns a RedisStore on rc.
+func NewRedisStore(rc *cache.RedisCache) *RedisStore {
+	return &RedisStore{rc: rc}
+}
+
+func (s *RedisStore) take(ctx context.Context, alg algorithm, key string, l Limit, now time.Time) (*Result, error) {
+	nowMs := toMillis(now)
+	var reply interface{}
+	var err error
+	switch alg {
+	case tokenBucket:
+		rate := float64(l.Rate) / durationMillis(l.Period)
+		ttl := int64(float64(l.burst())/rate) + 1
+		reply, err = s.rc.Eval(ctx, tokenBucketScript, []string{key},
+			strconv.FormatFloat(rate, 'f', -1, 64), l.burst(), nowMs, ttl)
+	case slidingWindow:
+		member, e := uniqueMember(nowMs)
+		if e != nil {
+			return nil, e
+		}
+		reply, err = s.rc.Eval(ctx, slidingWindowScript, []string{key},
+			l.Rate, int64(durationMillis(l.Period)), nowMs, member)
+	default:
+		interval := durationMillis(l.interval())
+		reply, err = s.rc.Eval(ctx, gcraScript, []string{key},
+			strconv.FormatFloat(interval, 'f', -1, 64),
+			strconv.FormatFloat(interval*float64(l.burst()), 'f', -1, 64), nowMs)
+	}
+	values, err := redis.Int64s(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// uniqueMember returns a sorted set member for one request.
+func uniqueMember(nowMs int64) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(nowMs, 10) + "-" + hex.EncodeToString(b), nil
+}
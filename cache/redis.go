@@ -6,7 +6,7 @@
 //
 // Usage:
 // import(
-//     "libs/redis"
+//     "libs/cache"
 // )
 //
 //  c, err := cache.NewCache("redis", `{"conn":"127.0.0.1:6379"}`)
@@ -14,6 +14,7 @@
 package cache
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -37,11 +38,12 @@ type RedisCache struct {
 	password  string
 	maxIdle   int
 	maxActive int
+	codec     *valueCodec // encodes the values of PutStruct and GetInto
 }
 
 // NewRedisCache create new redis cache with default collection name.
 func NewRedisCache() *RedisCache {
-	return &RedisCache{key: DefaultKey}
+	return &RedisCache{key: DefaultKey, codec: &valueCodec{codec: jsonCodec{}}}
 }
 
 func (rc *RedisCache) GetConn() redis.Conn {
@@ -58,18 +60,56 @@ func (rc *RedisCache) DoByConn(conn redis.Conn, commandName string, args ...inte
 
 // actually do the redis cmds
 func (rc *RedisCache) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
-	return rc.do(commandName, args...)
+	return rc.do(context.Background(), commandName, args...)
 }
 
 // actually do the redis cmds, args[0] must be the key name.
-func (rc *RedisCache) do(commandName string, args ...interface{}) (reply interface{}, err error) {
+func (rc *RedisCache) do(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
 	if len(args) < 1 {
 		return nil, errors.New("missing required arguments")
 	}
 	args[0] = rc.associate(args[0])
-	c := rc.p.Get()
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer c.Close()
 
+	return doContext(ctx, c, commandName, args...)
+}
+
+// DoContext is Do bounded by ctx, args[0] must be the key name.
+func (rc *RedisCache) DoContext(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	return rc.do(ctx, commandName, args...)
+}
+
+// Eval runs a lua script, the keys are associated with the collection key.
+// the script is sent with EVALSHA and falls back to EVAL.
+func (rc *RedisCache) Eval(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	keysAndArgs := make([]interface{}, 0, len(keys)+len(args))
+	for _, key := range keys {
+		keysAndArgs = append(keysAndArgs, rc.associate(key))
+	}
+	keysAndArgs = append(keysAndArgs, args...)
+	return script.Do(c, keysAndArgs...)
+}
+
+// doContext runs the command on c, bounding the read by the deadline of ctx.
+func doContext(ctx context.Context, c redis.Conn, commandName string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		return redis.DoWithTimeout(c, time.Until(deadline), commandName, args...)
+	}
 	return c.Do(commandName, args...)
 }
 
@@ -81,88 +121,110 @@ func (rc *RedisCache) associate(originKey interface{}) string {
 	return fmt.Sprintf("%s:%s", rc.key, originKey)
 }
 
+// SetStruct encodes val with the configured codec and stores it forever.
 func (rc *RedisCache) SetStruct(key string, val interface{}) error {
-	value, err := json.Marshal(val)
+	return rc.PutStruct(context.Background(), key, val, 0)
+}
+
+// SetStructWithExpire encodes val with the configured codec and stores it for timeout.
+func (rc *RedisCache) SetStructWithExpire(key string, val interface{}, timeout time.Duration) error {
+	return rc.PutStruct(context.Background(), key, val, timeout)
+}
+
+// PutStruct encodes val with the configured codec, compresses it when it is
+// larger than the compress threshold, and stores it for timeout.
+// if timeout is 0, it is stored forever.
+func (rc *RedisCache) PutStruct(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	value, err := rc.codec.encode(val)
 	if err != nil {
 		return err
 	}
-	_, err = rc.Do("SET", key, value)
-	return err
+	return rc.Put(ctx, key, value, timeout)
 }
 
-func (rc *RedisCache) SetStructWithExpire(key string, val interface{}, timeout time.Duration) error {
-	value, err := json.Marshal(val)
+// GetInto gets the value stored by PutStruct and decodes it into dst,
+// which must be a pointer.
+// if non-existed, return ErrCacheMiss.
+func (rc *RedisCache) GetInto(ctx context.Context, key string, dst interface{}) error {
+	data, err := redis.Bytes(rc.Get(ctx, key))
 	if err != nil {
 		return err
 	}
-	return rc.Put(key, value, timeout)
+	return rc.codec.decode(data, dst)
 }
 
 // Set cache to redis.
 func (rc *RedisCache) Set(key string, val interface{}) error {
-	_, err := rc.do("SET", key, val)
+	_, err := rc.Do("SET", key, val)
 	return err
 }
 
 // Get cache from redis.
-func (rc *RedisCache) Get(key string) interface{} {
-	if v, err := rc.do("GET", key); err == nil {
-		return v
+// if non-existed, return ErrCacheMiss.
+func (rc *RedisCache) Get(ctx context.Context, key string) (interface{}, error) {
+	v, err := rc.do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrCacheMiss
 	}
-	return nil
+	return v, nil
 }
 
 // Put put cache to redis.
 func (rc *RedisCache) Expire(key string, timeout time.Duration) error {
-	_, err := rc.do("EXPIRE", key, int64(timeout/time.Second))
+	_, err := rc.Do("EXPIRE", key, int64(timeout/time.Second))
 	return err
 }
 
 // GetMulti get cache from redis.
-func (rc *RedisCache) GetMulti(keys []string) []interface{} {
-	c := rc.p.Get()
+// missing keys are nil in the result.
+func (rc *RedisCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer c.Close()
 	var args []interface{}
 	for _, key := range keys {
 		args = append(args, rc.associate(key))
 	}
-	values, err := redis.Values(c.Do("MGET", args...))
-	if err != nil {
-		return nil
-	}
-	return values
+	return redis.Values(doContext(ctx, c, "MGET", args...))
 }
 
 // Put put cache to redis.
-func (rc *RedisCache) Put(key string, val interface{}, timeout time.Duration) error {
-	_, err := rc.do("SETEX", key, int64(timeout/time.Second), val)
+// if timeout is 0, it is stored forever.
+func (rc *RedisCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	if timeout <= 0 {
+		_, err := rc.do(ctx, "SET", key, val)
+		return err
+	}
+	ttl := int64((timeout + time.Millisecond - 1) / time.Millisecond)
+	_, err := rc.do(ctx, "PSETEX", key, ttl, val)
 	return err
 }
 
 // Delete delete cache in redis.
-func (rc *RedisCache) Delete(key string) error {
-	_, err := rc.do("DEL", key)
+func (rc *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := rc.do(ctx, "DEL", key)
 	return err
 }
 
 // IsExist check cache's existence in redis.
-func (rc *RedisCache) IsExist(key string) bool {
-	v, err := redis.Bool(rc.do("EXISTS", key))
-	if err != nil {
-		return false
-	}
-	return v
+func (rc *RedisCache) IsExist(ctx context.Context, key string) (bool, error) {
+	return redis.Bool(rc.do(ctx, "EXISTS", key))
 }
 
 // Incr increase counter in redis.
-func (rc *RedisCache) Incr(key string) error {
-	_, err := redis.Bool(rc.do("INCRBY", key, 1))
+func (rc *RedisCache) Incr(ctx context.Context, key string) error {
+	_, err := rc.do(ctx, "INCRBY", key, 1)
 	return err
 }
 
 // Decr decrease counter in redis.
-func (rc *RedisCache) Decr(key string) error {
-	_, err := redis.Bool(rc.do("INCRBY", key, -1))
+func (rc *RedisCache) Decr(ctx context.Context, key string) error {
+	_, err := rc.do(ctx, "INCRBY", key, -1)
 	return err
 }
 
@@ -193,26 +255,27 @@ func (rc *RedisCache) Hmget(key string, keys []string) (interface{}, error) {
 }
 
 // ClearAll clean all cache in redis. delete this redis collection.
-func (rc *RedisCache) ClearAll() error {
-	c := rc.p.Get()
-	defer c.Close()
-	cachedKeys, err := redis.Strings(c.Do("KEYS", rc.key+":*"))
-	if err != nil {
-		return err
-	}
-	for _, str := range cachedKeys {
-		if _, err = c.Do("DEL", str); err != nil {
-			return err
-		}
-	}
-	return err
+// the keys are deleted in batches with SCAN.
+func (rc *RedisCache) ClearAll(ctx context.Context) error {
+	return rc.deletePattern(ctx, rc.key+":*")
 }
 
 // StartAndGC start redis cache adapter.
-// config is like {"key":"collection key","conn":"127.0.0.1:6379","dbnum":"0","password":"","maxidle":3,"maxactive":2000}
+// config is like {"key":"collection key","conn":"127.0.0.1:6379","dbnum":"0","password":"","maxidle":"3","maxactive":"2000"}
+// the codec of PutStruct and GetInto is set by {"codec":"json","compress":"snappy","compressthreshold":"1024"},
+// codec is one of json (default), gob, msgpack or protobuf,
+// compress is snappy or gzip and applies to values larger than compressthreshold bytes.
 // the cache item in redis are stored forever,
 // so no gc operation.
-func (rc *RedisCache) StartAndGC(conf map[string]string) error {
+func (rc *RedisCache) StartAndGC(config string) error {
+	var conf map[string]string
+	if err := json.Unmarshal([]byte(config), &conf); err != nil {
+		return err
+	}
+	// a config of null leaves conf nil.
+	if conf == nil {
+		conf = make(map[string]string)
+	}
 	if _, ok := conf["key"]; !ok {
 		conf["key"] = DefaultKey
 	}
@@ -245,6 +308,13 @@ func (rc *RedisCache) StartAndGC(conf map[string]string) error {
 	rc.maxIdle, _ = strconv.Atoi(conf["maxidle"])
 	rc.maxActive, _ = strconv.Atoi(conf["maxactive"])
 
+	threshold, _ := strconv.Atoi(conf["compressthreshold"])
+	codec, err := newValueCodec(conf["codec"], conf["compress"], threshold)
+	if err != nil {
+		return err
+	}
+	rc.codec = codec
+
 	rc.connectInit()
 
 	c := rc.p.Get()
@@ -283,3 +353,7 @@ func (rc *RedisCache) connectInit() {
 		Dial:        dialFunc,
 	}
 }
+
+func init() {
+	Register("redis", func() Cache { return NewRedisCache() })
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	rediss "github.com/go-redis/redis"
+)
+
+// RedisClusterDefaultPoolSize is the default pool size per cluster node.
+var RedisClusterDefaultPoolSize = 1000
+
+// RedisClusterCache is Redis Cluster cache adapter.
+// keys are routed to the node owning their hash slot,
+// MOVED and ASK redirects are followed by the go-redis cluster client.
+type RedisClusterCache struct {
+	universalRedisCache
+}
+
+// NewRedisClusterCache create new redis cluster cache with default collection name.
+func NewRedisClusterCache() *RedisClusterCache {
+	return &RedisClusterCache{}
+}
+
+// StartAndGC start redis cluster cache adapter.
+// config is like {"key":"collection key","conn":"127.0.0.1:7000;127.0.0.1:7001","password":"","poolsize":"1000"}
+// conn lists some of the cluster nodes, the others are discovered.
+// codec, compress and compressthreshold work as in RedisCache.
+func (rc *RedisClusterCache) StartAndGC(config string) error {
+	conf, err := rc.parseConfig(config)
+	if err != nil {
+		return err
+	}
+	client := rediss.NewClusterClient(&rediss.ClusterOptions{
+		Addrs:    splitAddrs(conf["conn"]),
+		Password: conf["password"],
+		PoolSize: atoiDefault(conf["poolsize"], RedisClusterDefaultPoolSize),
+	})
+	if err = client.Ping().Err(); err != nil {
+		client.Close()
+		return err
+	}
+	rc.client = client
+	return nil
+}
+
+func init() {
+	Register("redis_cluster", func() Cache { return NewRedisClusterCache() })
+}
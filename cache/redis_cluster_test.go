@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRedisClusterCache(t *testing.T) {
+	bm, err := NewCache("redis_cluster", `{"key":"test","conn":"127.0.0.1:7000;127.0.0.1:7001;127.0.0.1:7002"}`)
+	if err != nil {
+		t.Skip(err)
+	}
+	ctx := context.Background()
+	timeoutDuration := 10 * time.Second
+	keys := []string{"astaxie", "astaxie1", "astaxie2"}
+	for _, key := range keys {
+		if err = bm.Put(ctx, key, key, timeoutDuration); err != nil {
+			t.Error("set Error", err)
+		}
+	}
+	// the keys hash to different slots.
+	vv, err := bm.GetMulti(ctx, append(keys, "missing"))
+	if err != nil || len(vv) != 4 {
+		t.Fatal("GetMulti ERROR", err)
+	}
+	for i, key := range keys {
+		if string(vv[i].([]byte)) != key {
+			t.Error("GetMulti ERROR")
+		}
+	}
+	if vv[3] != nil {
+		t.Error("GetMulti ERROR")
+	}
+	if err = bm.Incr(ctx, "counter"); err != nil {
+		t.Error("Incr Error", err)
+	}
+	if err = bm.ClearAll(ctx); err != nil {
+		t.Error("clear all err", err)
+	}
+	if ok, _ := bm.IsExist(ctx, "astaxie"); ok {
+		t.Error("clear all err")
+	}
+}
+
+func TestRedisClusterCacheConfig(t *testing.T) {
+	for _, name := range []string{"redis", "redis_cluster", "redis_sentinel"} {
+		if _, err := NewCache(name, `{"key":"test"}`); err == nil {
+			t.Error(name, "config without conn should return error")
+		}
+		if _, err := NewCache(name, `null`); err == nil {
+			t.Error(name, "null config should return error")
+		}
+	}
+	if _, err := NewCache("redis_sentinel", `{"conn":"127.0.0.1:26379","codec":"xml"}`); err == nil {
+		t.Error("unknown codec should return error")
+	}
+	addrs := splitAddrs("127.0.0.1:7000; 127.0.0.1:7001;")
+	if len(addrs) != 2 || addrs[1] != "127.0.0.1:7001" {
+		t.Error("splitAddrs err", addrs)
+	}
+}
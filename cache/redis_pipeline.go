@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrTxFailed is returned when a watched key was changed
+// before the transaction was executed.
+var ErrTxFailed = errors.New("cache: transaction failed, watched key changed")
+
+type redisCmd struct {
+	name string
+	args []interface{}
+}
+
+// Pipeline queues redis commands and sends them in one round trip.
+// usage:
+//	pipe := rc.Pipeline()
+//	pipe.Send("SET", "a", 1)
+//	pipe.Send("INCR", "b")
+//	replies, err := pipe.Exec(ctx)
+type Pipeline struct {
+	rc   *RedisCache
+	cmds []redisCmd
+	tx   bool
+}
+
+// Pipeline returns a new Pipeline on rc.
+func (rc *RedisCache) Pipeline() *Pipeline {
+	return &Pipeline{rc: rc}
+}
+
+// TxPipeline returns a new Pipeline whose commands are
+// wrapped in MULTI/EXEC and executed atomically.
+func (rc *RedisCache) TxPipeline() *Pipeline {
+	return &Pipeline{rc: rc, tx: true}
+}
+
+// Send queues a command, args[0] must be the key name
+// and is associated with the collection key.
+func (p *Pipeline) Send(commandName string, args ...interface{}) error {
+	if len(args) < 1 {
+		return errors.New("missing required arguments")
+	}
+	args[0] = p.rc.associate(args[0])
+	p.cmds = append(p.cmds, redisCmd{name: commandName, args: args})
+	return nil
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Exec sends the queued commands in one round trip and returns their
+// replies in order. a command failing on the server has its redis.Error
+// as reply, and the first of them is returned as err.
+// the pipeline is empty afterwards and can be reused.
+func (p *Pipeline) Exec(ctx context.Context) ([]interface{}, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	c, err := p.rc.p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if p.tx {
+		return execTx(ctx, c, cmds)
+	}
+	return execPipeline(ctx, c, cmds)
+}
+
+// execPipeline sends cmds on c and reads all replies.
+func execPipeline(ctx context.Context, c redis.Conn, cmds []redisCmd) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		if err := c.Send(cmd.name, cmd.args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		reply, err := receiveContext(ctx, c)
+		if rerr, ok := err.(redis.Error); ok {
+			replies[i] = rerr
+			if firstErr == nil {
+				firstErr = rerr
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// execTx sends cmds on c between MULTI and EXEC and returns the EXEC replies.
+// if a watched key was changed, ErrTxFailed is returned.
+func execTx(ctx context.Context, c redis.Conn, cmds []redisCmd) ([]interface{}, error) {
+	all := make([]redisCmd, 0, len(cmds)+2)
+	all = append(all, redisCmd{name: "MULTI"})
+	all = append(all, cmds...)
+	all = append(all, redisCmd{name: "EXEC"})
+	replies, err := execPipeline(ctx, c, all)
+	if err != nil {
+		// a command was rejected while queueing, EXEC is aborted.
+		return nil, err
+	}
+	exec := replies[len(replies)-1]
+	if exec == nil {
+		return nil, ErrTxFailed
+	}
+	values, err := redis.Values(exec, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if rerr, ok := v.(redis.Error); ok {
+			return values, rerr
+		}
+	}
+	return values, nil
+}
+
+// receiveContext reads a reply from c, bounded by the deadline of ctx.
+func receiveContext(ctx context.Context, c redis.Conn) (interface{}, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return redis.ReceiveWithTimeout(c, time.Until(deadline))
+	}
+	return c.Receive()
+}
+
+// Tx is a transaction with watched keys, see RedisCache.Watch.
+type Tx struct {
+	ctx  context.Context
+	rc   *RedisCache
+	conn redis.Conn
+	cmds []redisCmd
+}
+
+// Do runs a command immediately on the watched connection,
+// it is used to read the values the transaction depends on.
+// args[0] must be the key name.
+func (tx *Tx) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, errors.New("missing required arguments")
+	}
+	args[0] = tx.rc.associate(args[0])
+	return doContext(tx.ctx, tx.conn, commandName, args...)
+}
+
+// Send queues a command executed with MULTI/EXEC after fn returns.
+// args[0] must be the key name.
+func (tx *Tx) Send(commandName string, args ...interface{}) error {
+	if len(args) < 1 {
+		return errors.New("missing required arguments")
+	}
+	args[0] = tx.rc.associate(args[0])
+	tx.cmds = append(tx.cmds, redisCmd{name: commandName, args: args})
+	return nil
+}
+
+// Watch implements optimistic locking: keys are watched, fn reads them with
+// tx.Do and queues its writes with tx.Send, then the writes are executed
+// with MULTI/EXEC and their replies returned.
+// if one of keys was changed by another client meanwhile, nothing is written
+// and ErrTxFailed is returned, the caller usually retries.
+// usage:
+//	_, err := rc.Watch(ctx, func(tx *cache.Tx) error {
+//		n, err := redis.Int(tx.Do("GET", "counter"))
+//		if err != nil && err != redis.ErrNil {
+//			return err
+//		}
+//		return tx.Send("SET", "counter", n*2)
+//	}, "counter")
+func (rc *RedisCache) Watch(ctx context.Context, fn func(tx *Tx) error, keys ...string) ([]interface{}, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("missing keys to watch")
+	}
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = rc.associate(key)
+	}
+	if _, err = doContext(ctx, c, "WATCH", args...); err != nil {
+		return nil, err
+	}
+	tx := &Tx{ctx: ctx, rc: rc, conn: c}
+	if err = fn(tx); err != nil {
+		c.Do("UNWATCH")
+		return nil, err
+	}
+	if len(tx.cmds) == 0 {
+		_, err = c.Do("UNWATCH")
+		return nil, err
+	}
+	return execTx(ctx, c, tx.cmds)
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+)
+
+// scriptedConn is a redis.Conn replying with the scripted replies in order.
+type scriptedConn struct {
+	sent    []string
+	replies []interface{}
+}
+
+func (c *scriptedConn) Close() error { return nil }
+func (c *scriptedConn) Err() error   { return nil }
+func (c *scriptedConn) Flush() error { return nil }
+
+func (c *scriptedConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	c.Send(commandName, args...)
+	return c.Receive()
+}
+
+func (c *scriptedConn) Send(commandName string, args ...interface{}) error {
+	c.sent = append(c.sent, commandName)
+	return nil
+}
+
+func (c *scriptedConn) Receive() (interface{}, error) {
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	if err, ok := reply.(redis.Error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func TestExecPipeline(t *testing.T) {
+	c := &scriptedConn{replies: []interface{}{"OK", int64(2), redis.Error("WRONGTYPE")}}
+	cmds := []redisCmd{{"SET", []interface{}{"a", 1}}, {"INCR", []interface{}{"b"}}, {"INCR", []interface{}{"c"}}}
+	replies, err := execPipeline(context.Background(), c, cmds)
+	if err == nil || err.Error() != "WRONGTYPE" {
+		t.Error("the failed command should be returned as err", err)
+	}
+	if len(replies) != 3 || replies[0] != "OK" || replies[1] != int64(2) {
+		t.Error("replies err", replies)
+	}
+	if _, ok := replies[2].(redis.Error); !ok {
+		t.Error("failed command should have its error as reply")
+	}
+}
+
+func TestExecTx(t *testing.T) {
+	c := &scriptedConn{replies: []interface{}{"OK", "QUEUED", "QUEUED", []interface{}{"OK", int64(1)}}}
+	cmds := []redisCmd{{"SET", []interface{}{"a", 1}}, {"INCR", []interface{}{"b"}}}
+	replies, err := execTx(context.Background(), c, cmds)
+	if err != nil || len(replies) != 2 || replies[1] != int64(1) {
+		t.Error("execTx err", replies, err)
+	}
+	if len(c.sent) != 4 || c.sent[0] != "MULTI" || c.sent[3] != "EXEC" {
+		t.Error("commands should be wrapped in MULTI/EXEC", c.sent)
+	}
+
+	// EXEC replies nil when a watched key was changed.
+	c = &scriptedConn{replies: []interface{}{"OK", "QUEUED", nil}}
+	if _, err = execTx(context.Background(), c, cmds[:1]); err != ErrTxFailed {
+		t.Error("aborted transaction should return ErrTxFailed", err)
+	}
+}
+
+func TestRedisPipeline(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	bm, err := NewCache("redis", `{"key":"pipe","conn":"`+s.Addr()+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := bm.(*RedisCache)
+	ctx := context.Background()
+
+	pipe := rc.Pipeline()
+	pipe.Send("SET", "counter", 1)
+	pipe.Send("INCR", "counter")
+	replies, err := pipe.Exec(ctx)
+	if err != nil || len(replies) != 2 {
+		t.Fatal("pipeline err", err)
+	}
+	if v, _ := redis.Int(replies[1], nil); v != 2 {
+		t.Error("pipeline INCR err")
+	}
+
+	_, err = rc.Watch(ctx, func(tx *Tx) error {
+		n, err := redis.Int(tx.Do("GET", "counter"))
+		if err != nil {
+			return err
+		}
+		return tx.Send("SET", "counter", n*2)
+	}, "counter")
+	if err != nil {
+		t.Error("watch err", err)
+	}
+	if v, _ := redis.Int(rc.Get(ctx, "counter")); v != 4 {
+		t.Error("transaction err", v)
+	}
+	rc.Delete(ctx, "counter")
+}
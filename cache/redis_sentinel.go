@@ -0,0 +1,52 @@
+package cache
+
+import (
+	rediss "github.com/go-redis/redis"
+)
+
+// RedisSentinelDefaultPoolSize is the default pool size of the master connection.
+var RedisSentinelDefaultPoolSize = 100
+
+// RedisSentinelCache is Redis Sentinel cache adapter.
+// the master is discovered through the sentinels and
+// the client follows it after a failover.
+type RedisSentinelCache struct {
+	universalRedisCache
+}
+
+// NewRedisSentinelCache create new redis sentinel cache with default collection name.
+func NewRedisSentinelCache() *RedisSentinelCache {
+	return &RedisSentinelCache{}
+}
+
+// StartAndGC start redis sentinel cache adapter.
+// config is like {"key":"collection key","conn":"127.0.0.1:26379;127.0.0.2:26379","mastername":"mymaster","password":"","dbnum":"0","poolsize":"100"}
+// conn lists the sentinels, mastername defaults to mymaster.
+// codec, compress and compressthreshold work as in RedisCache.
+func (rc *RedisSentinelCache) StartAndGC(config string) error {
+	conf, err := rc.parseConfig(config)
+	if err != nil {
+		return err
+	}
+	masterName := conf["mastername"]
+	if masterName == "" {
+		masterName = "mymaster"
+	}
+	client := rediss.NewFailoverClient(&rediss.FailoverOptions{
+		SentinelAddrs: splitAddrs(conf["conn"]),
+		MasterName:    masterName,
+		Password:      conf["password"],
+		DB:            atoiDefault(conf["dbnum"], 0),
+		PoolSize:      atoiDefault(conf["poolsize"], RedisSentinelDefaultPoolSize),
+	})
+	if err = client.Ping().Err(); err != nil {
+		client.Close()
+		return err
+	}
+	rc.client = client
+	return nil
+}
+
+func init() {
+	Register("redis_sentinel", func() Cache { return NewRedisSentinelCache() })
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// tagKeyPrefix starts the keys of the sets listing the keys of a tag.
+const tagKeyPrefix = "__tag:"
+
+// putWithTagsScript sets KEYS[1] and adds it to the tag sets KEYS[2..].
+// a tag set lives as long as its longest lived key.
+// ARGV: value, ttl in ms, 0 means forever.
+var putWithTagsScript = redis.NewScript(-1, `
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+for i = 2, #KEYS do
+	local existed = redis.call("EXISTS", KEYS[i])
+	local pttl = redis.call("PTTL", KEYS[i])
+	redis.call("SADD", KEYS[i], KEYS[1])
+	if ttl == 0 then
+		redis.call("PERSIST", KEYS[i])
+	elseif existed == 0 or (pttl >= 0 and pttl < ttl) then
+		redis.call("PEXPIRE", KEYS[i], ttl)
+	end
+end
+return redis.status_reply("OK")`)
+
+// scanCount is the COUNT hint of SCAN and SPOP, it bounds the work of one command.
+const scanCount = 1000
+
+// PutWithTags puts val and attaches tags to it.
+// a timeout of 0 or less means forever.
+func (rc *RedisCache) PutWithTags(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, key)
+	for _, tag := range tags {
+		keys = append(keys, tagKeyPrefix+tag)
+	}
+	var ttl int64
+	if timeout > 0 {
+		ttl = int64((timeout + time.Millisecond - 1) / time.Millisecond)
+	}
+	_, err := rc.Eval(ctx, putWithTagsScript, keys, val, ttl)
+	return err
+}
+
+// InvalidateTags deletes the keys having one of tags.
+// the members of a tag set are popped and deleted in batches, so redis is not
+// blocked by a large tag and keys tagged meanwhile are not lost.
+func (rc *RedisCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, tag := range tags {
+		tagKey := rc.associate(tagKeyPrefix + tag)
+		for {
+			keys, err := redis.Values(doContext(ctx, c, "SPOP", tagKey, scanCount))
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				break
+			}
+			if _, err = doContext(ctx, c, "DEL", keys...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeletePrefix deletes the keys starting with prefix, using SCAN.
+func (rc *RedisCache) DeletePrefix(ctx context.Context, prefix string) error {
+	return rc.deletePattern(ctx, rc.associate(escapeGlob(prefix))+"*")
+}
+
+// deletePattern deletes the keys matching pattern in batches with SCAN,
+// unlike KEYS it does not block redis on a large database.
+func (rc *RedisCache) deletePattern(ctx context.Context, pattern string) error {
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	cursor := int64(0)
+	for {
+		reply, err := redis.Values(doContext(ctx, c, "SCAN", cursor, "MATCH", pattern, "COUNT", scanCount))
+		if err != nil {
+			return err
+		}
+		var keys []interface{}
+		if _, err = redis.Scan(reply, &cursor, &keys); err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if _, err = doContext(ctx, c, "DEL", keys...); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// escapeGlob escapes the glob special characters of a MATCH pattern.
+func escapeGlob(s string) string {
+	return globEscaper.Replace(s)
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -8,75 +9,74 @@ import (
 )
 
 func TestRedisCache(t *testing.T) {
-	conf := map[string]string{"conn": "127.0.0.1:6379"}
-	bm := NewRedisCache()
-	err := bm.StartAndGC(conf)
+	bm, err := NewCache("redis", `{"conn": "127.0.0.1:6379"}`)
 	if err != nil {
-		t.Error("init err")
+		t.Fatal("init err", err)
 	}
+	ctx := context.Background()
 	timeoutDuration := 10 * time.Second
-	if err = bm.Put("astaxie", 1, timeoutDuration); err != nil {
+	if err = bm.Put(ctx, "astaxie", 1, timeoutDuration); err != nil {
 		t.Error("set Error", err)
 	}
-	if !bm.IsExist("astaxie") {
+	if !isExist(bm, "astaxie") {
 		t.Error("check err")
 	}
 
 	time.Sleep(11 * time.Second)
 
-	if bm.IsExist("astaxie") {
+	if isExist(bm, "astaxie") {
 		t.Error("check err")
 	}
-	if err = bm.Put("astaxie", 1, timeoutDuration); err != nil {
+	if err = bm.Put(ctx, "astaxie", 1, timeoutDuration); err != nil {
 		t.Error("set Error", err)
 	}
 
-	if v, _ := redis.Int(bm.Get("astaxie"), err); v != 1 {
+	if v, _ := redis.Int(bm.Get(ctx, "astaxie")); v != 1 {
 		t.Error("get err")
 	}
 
-	if err = bm.Incr("astaxie"); err != nil {
+	if err = bm.Incr(ctx, "astaxie"); err != nil {
 		t.Error("Incr Error", err)
 	}
 
-	if v, _ := redis.Int(bm.Get("astaxie"), err); v != 2 {
+	if v, _ := redis.Int(bm.Get(ctx, "astaxie")); v != 2 {
 		t.Error("get err")
 	}
 
-	if err = bm.Decr("astaxie"); err != nil {
+	if err = bm.Decr(ctx, "astaxie"); err != nil {
 		t.Error("Decr Error", err)
 	}
 
-	if v, _ := redis.Int(bm.Get("astaxie"), err); v != 1 {
+	if v, _ := redis.Int(bm.Get(ctx, "astaxie")); v != 1 {
 		t.Error("get err")
 	}
-	bm.Delete("astaxie")
-	if bm.IsExist("astaxie") {
+	bm.Delete(ctx, "astaxie")
+	if isExist(bm, "astaxie") {
 		t.Error("delete err")
 	}
 
 	//test string
-	if err = bm.Put("astaxie", "author", timeoutDuration); err != nil {
+	if err = bm.Put(ctx, "astaxie", "author", timeoutDuration); err != nil {
 		t.Error("set Error", err)
 	}
-	if !bm.IsExist("astaxie") {
+	if !isExist(bm, "astaxie") {
 		t.Error("check err")
 	}
 
-	if v, _ := redis.String(bm.Get("astaxie"), err); v != "author" {
+	if v, _ := redis.String(bm.Get(ctx, "astaxie")); v != "author" {
 		t.Error("get err")
 	}
 
 	//test GetMulti
-	if err = bm.Put("astaxie1", "author1", timeoutDuration); err != nil {
+	if err = bm.Put(ctx, "astaxie1", "author1", timeoutDuration); err != nil {
 		t.Error("set Error", err)
 	}
-	if !bm.IsExist("astaxie1") {
+	if !isExist(bm, "astaxie1") {
 		t.Error("check err")
 	}
 
-	vv := bm.GetMulti([]string{"astaxie", "astaxie1"})
-	if len(vv) != 2 {
+	vv, err := bm.GetMulti(ctx, []string{"astaxie", "astaxie1"})
+	if err != nil || len(vv) != 2 {
 		t.Error("GetMulti ERROR")
 	}
 	if v, _ := redis.String(vv[0], nil); v != "author" {
@@ -86,8 +86,22 @@ func TestRedisCache(t *testing.T) {
 		t.Error("GetMulti ERROR")
 	}
 
+	//test struct
+	if err = bm.(*RedisCache).PutStruct(ctx, "astaxie2", codecUser{"astaxie", 30}, timeoutDuration); err != nil {
+		t.Error("set Error", err)
+	}
+	var u codecUser
+	if err = bm.(*RedisCache).GetInto(ctx, "astaxie2", &u); err != nil || u.Name != "astaxie" {
+		t.Error("GetInto ERROR", err)
+	}
+
 	// test clear all
-	if err = bm.ClearAll(); err != nil {
+	if err = bm.ClearAll(ctx); err != nil {
 		t.Error("clear all err")
 	}
 }
+
+func isExist(bm Cache, key string) bool {
+	ok, _ := bm.IsExist(context.Background(), key)
+	return ok
+}
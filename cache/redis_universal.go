@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	rediss "github.com/go-redis/redis"
+)
+
+// universalRedisCache implements the Cache methods shared by
+// RedisClusterCache and RedisSentinelCache on top of a go-redis client.
+// go-redis does not take a context, so ctx is checked before every command.
+type universalRedisCache struct {
+	client rediss.UniversalClient
+	key    string
+	codec  *valueCodec
+}
+
+// parseConfig parses the json config shared by the go-redis adapters
+// and sets the key and the codec.
+func (rc *universalRedisCache) parseConfig(config string) (map[string]string, error) {
+	var conf map[string]string
+	if err := json.Unmarshal([]byte(config), &conf); err != nil {
+		return nil, err
+	}
+	if conf["conn"] == "" {
+		return nil, errors.New("config has no conn key")
+	}
+	if _, ok := conf["key"]; !ok {
+		conf["key"] = DefaultKey
+	}
+	threshold, _ := strconv.Atoi(conf["compressthreshold"])
+	codec, err := newValueCodec(conf["codec"], conf["compress"], threshold)
+	if err != nil {
+		return nil, err
+	}
+	rc.key = conf["key"]
+	rc.codec = codec
+	return conf, nil
+}
+
+// associate with config key.
+func (rc *universalRedisCache) associate(originKey string) string {
+	if rc.key == "" {
+		return originKey
+	}
+	return fmt.Sprintf("%s:%s", rc.key, originKey)
+}
+
+// Get cache from redis.
+// if non-existed, return ErrCacheMiss.
+func (rc *universalRedisCache) Get(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	v, err := rc.client.Get(rc.associate(key)).Bytes()
+	if err == rediss.Nil {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// GetMulti get cache from redis.
+// the keys may live on different nodes, so they are read in a pipeline.
+// missing keys are nil in the result.
+func (rc *universalRedisCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pipe := rc.client.Pipeline()
+	cmds := make([]*rediss.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(rc.associate(key))
+	}
+	if _, err := pipe.Exec(); err != nil && err != rediss.Nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		if v, err := cmd.Bytes(); err == nil {
+			values[i] = v
+		}
+	}
+	return values, nil
+}
+
+// Put put cache to redis.
+// if timeout is 0, it is stored forever.
+func (rc *universalRedisCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rc.client.Set(rc.associate(key), val, timeout).Err()
+}
+
+// PutStruct encodes val with the configured codec and stores it for timeout.
+func (rc *universalRedisCache) PutStruct(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	value, err := rc.codec.encode(val)
+	if err != nil {
+		return err
+	}
+	return rc.Put(ctx, key, value, timeout)
+}
+
+// GetInto gets the value stored by PutStruct and decodes it into dst.
+// if non-existed, return ErrCacheMiss.
+func (rc *universalRedisCache) GetInto(ctx context.Context, key string, dst interface{}) error {
+	v, err := rc.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return rc.codec.decode(v.([]byte), dst)
+}
+
+// Delete delete cache in redis.
+func (rc *universalRedisCache) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rc.client.Del(rc.associate(key)).Err()
+}
+
+// Incr increase counter in redis.
+func (rc *universalRedisCache) Incr(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rc.client.IncrBy(rc.associate(key), 1).Err()
+}
+
+// Decr decrease counter in redis.
+func (rc *universalRedisCache) Decr(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rc.client.IncrBy(rc.associate(key), -1).Err()
+}
+
+// IsExist check cache's existence in redis.
+func (rc *universalRedisCache) IsExist(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	n, err := rc.client.Exists(rc.associate(key)).Result()
+	return n > 0, err
+}
+
+// ClearAll deletes all keys under the collection key.
+// on a cluster every master is scanned.
+func (rc *universalRedisCache) ClearAll(ctx context.Context) error {
+	return rc.deletePattern(ctx, rc.associate("*"))
+}
+
+// DeletePrefix deletes the keys starting with prefix, using SCAN.
+// on a cluster every master is scanned.
+func (rc *universalRedisCache) DeletePrefix(ctx context.Context, prefix string) error {
+	return rc.deletePattern(ctx, rc.associate(escapeGlob(prefix))+"*")
+}
+
+func (rc *universalRedisCache) deletePattern(ctx context.Context, pattern string) error {
+	if cc, ok := rc.client.(*rediss.ClusterClient); ok {
+		return cc.ForEachMaster(func(c *rediss.Client) error {
+			return clearByPattern(ctx, c, pattern)
+		})
+	}
+	return clearByPattern(ctx, rc.client, pattern)
+}
+
+// clearByPattern deletes the keys matching pattern on one node with SCAN.
+func clearByPattern(ctx context.Context, c rediss.Cmdable, pattern string) error {
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		keys, next, err := c.Scan(cursor, pattern, 100).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = c.Del(key).Err(); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Close closes the go-redis client.
+func (rc *universalRedisCache) Close() error {
+	return rc.client.Close()
+}
+
+// splitAddrs splits a conn config like 127.0.0.1:7000;127.0.0.1:7001.
+func splitAddrs(conn string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(conn, ";") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// atoiDefault returns the int value of s, or def if s is empty or invalid.
+func atoiDefault(s string, def int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,261 @@
+// Package sqlite is the cache adapter storing the cache in a single sqlite
+// file, for the deployments running one node. it uses the pure-Go driver
+// modernc.org/sqlite, so it builds without cgo.
+//
+// Usage:
+//
+//	import (
+//		"libs/cache"
+//		_ "libs/cache/sqlite"
+//	)
+//
+//	c, err := cache.NewCache("sqlite", `{"path":"./data/cache.db","interval":60}`)
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"libs/cache"
+	"libs/clock"
+	"libs/internal/sqlitedb"
+)
+
+// DefaultTable is the table of the cache.
+var DefaultTable = "cache"
+
+// Sqlite adapter.
+// the values are stored as integer, real, text or blob, so an int is read
+// back as int64. the expired items are deleted every interval seconds
+// with the index on their expiry.
+type Sqlite struct {
+	db       *sqlitedb.DB
+	table    string
+	interval time.Duration
+	codec    cache.Codec // encodes the values of PutStruct and GetInto
+	clock    clock.Clock
+	done     chan struct{}
+}
+
+// sqliteConfig is the json config accepted by StartAndGC.
+type sqliteConfig struct {
+	Path     string `json:"path"`
+	Alias    string `json:"alias"`
+	Table    string `json:"table"`
+	Interval *int   `json:"interval"`
+	Codec    string `json:"codec"`
+}
+
+// NewSqlite create new sqlite adapter.
+func NewSqlite() *Sqlite {
+	return &Sqlite{table: DefaultTable}
+}
+
+// SetClock sets the clock the items expire with, the system time by default.
+func (sc *Sqlite) SetClock(c clock.Clock) {
+	sc.clock = c
+}
+
+// now returns the time in unix nanoseconds, as stored in the expiry column.
+func (sc *Sqlite) now() int64 {
+	return clock.Or(sc.clock).Now().UnixNano()
+}
+
+// Get value from sqlite.
+// if non-existed or expired, return cache.ErrCacheMiss.
+func (sc *Sqlite) Get(ctx context.Context, key string) (interface{}, error) {
+	var v interface{}
+	err := sc.db.QueryRowContext(ctx, "SELECT value FROM "+sc.table+" WHERE key = ? AND (expiry = 0 OR expiry > ?)",
+		key, sc.now()).Scan(&v)
+	if err == sql.ErrNoRows {
+		return nil, cache.ErrCacheMiss
+	}
+	return v, err
+}
+
+// GetMulti gets values from sqlite.
+// if non-existed or expired, the value is nil.
+func (sc *Sqlite) GetMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	rc := make([]interface{}, len(keys))
+	for i, key := range keys {
+		v, err := sc.Get(ctx, key)
+		if err != nil && err != cache.ErrCacheMiss {
+			return nil, err
+		}
+		rc[i] = v
+	}
+	return rc, nil
+}
+
+// Put value into sqlite.
+// if timeout is 0, it is stored forever.
+func (sc *Sqlite) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	var expiry int64
+	if timeout > 0 {
+		expiry = sc.now() + int64(timeout)
+	}
+	_, err := sc.db.Write("INSERT INTO "+sc.table+" (key, value, expiry) VALUES (?, ?, ?) "+
+		"ON CONFLICT (key) DO UPDATE SET value = excluded.value, expiry = excluded.expiry", key, val, expiry)
+	return err
+}
+
+// PutStruct encodes val with the configured codec and stores it for timeout.
+// if timeout is 0, it is stored forever.
+func (sc *Sqlite) PutStruct(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	value, err := sc.codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return sc.Put(ctx, key, value, timeout)
+}
+
+// GetInto gets the value stored by PutStruct and decodes it into dst,
+// which must be a pointer.
+// if non-existed or expired, return cache.ErrCacheMiss.
+func (sc *Sqlite) GetInto(ctx context.Context, key string, dst interface{}) error {
+	v, err := sc.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		return errors.New("sqlite: value of " + key + " is not encoded")
+	}
+	return sc.codec.Unmarshal(data, dst)
+}
+
+// Delete value in sqlite.
+// if non-existed, it does nothing.
+func (sc *Sqlite) Delete(ctx context.Context, key string) error {
+	_, err := sc.db.Write("DELETE FROM "+sc.table+" WHERE key = ?", key)
+	return err
+}
+
+// Incr increase counter in sqlite.
+func (sc *Sqlite) Incr(ctx context.Context, key string) error {
+	return sc.add(ctx, key, 1)
+}
+
+// Decr decrease counter in sqlite.
+func (sc *Sqlite) Decr(ctx context.Context, key string) error {
+	return sc.add(ctx, key, -1)
+}
+
+// add adds delta to the integer stored at key.
+func (sc *Sqlite) add(ctx context.Context, key string, delta int) error {
+	n, err := sc.db.Write("UPDATE "+sc.table+" SET value = value + ? WHERE key = ? AND (expiry = 0 OR expiry > ?) AND typeof(value) = 'integer'",
+		delta, key, sc.now())
+	if err != nil || n == 1 {
+		return err
+	}
+	if ok, err := sc.IsExist(ctx, key); err != nil || !ok {
+		if err == nil {
+			err = cache.ErrCacheMiss
+		}
+		return err
+	}
+	return errors.New("item val is not an integer")
+}
+
+// IsExist check value exists in sqlite.
+func (sc *Sqlite) IsExist(ctx context.Context, key string) (bool, error) {
+	var n int
+	err := sc.db.QueryRowContext(ctx, "SELECT 1 FROM "+sc.table+" WHERE key = ? AND (expiry = 0 OR expiry > ?)",
+		key, sc.now()).Scan(&n)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClearAll will delete all values in sqlite.
+func (sc *Sqlite) ClearAll(ctx context.Context) error {
+	_, err := sc.db.Write("DELETE FROM " + sc.table)
+	return err
+}
+
+// StartAndGC start sqlite adapter.
+// config is like {"path":"./data/cache.db","table":"cache","interval":60},
+// the database file and the table are created if missing.
+// {"alias":"default"} uses the sqlite database registered with orm.RegisterDataBase instead.
+// the codec of PutStruct and GetInto is set by {"codec":"json"}.
+// the database is opened in WAL mode and the writes of concurrent calls
+// are committed together in one transaction.
+func (sc *Sqlite) StartAndGC(config string) error {
+	var cf sqliteConfig
+	if err := json.Unmarshal([]byte(config), &cf); err != nil {
+		return err
+	}
+	source := cf.Path
+	if cf.Alias != "" {
+		source = "orm:" + cf.Alias
+	}
+	if source == "" {
+		return errors.New("config has no path key")
+	}
+	if cf.Table != "" {
+		sc.table = cf.Table
+	}
+	interval := cache.DefaultEvery
+	if cf.Interval != nil {
+		interval = *cf.Interval
+	}
+	if cf.Codec == "" {
+		cf.Codec = "json"
+	}
+	codec, err := cache.GetCodec(cf.Codec)
+	if err != nil {
+		return err
+	}
+	sc.codec = codec
+
+	db, err := sqlitedb.Open(source)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + sc.table + ` (
+		key TEXT NOT NULL PRIMARY KEY,
+		value,
+		expiry INTEGER NOT NULL DEFAULT 0)`)
+	if err == nil {
+		_, err = db.Exec("CREATE INDEX IF NOT EXISTS " + sc.table + "_expiry_idx ON " + sc.table + " (expiry)")
+	}
+	if err != nil {
+		db.Close()
+		return err
+	}
+	sc.db = db
+	sc.interval = time.Duration(interval) * time.Second
+	sc.done = make(chan struct{})
+	go sc.vacuum()
+	return nil
+}
+
+// Close stops the gc and closes the database once the queued writes are committed.
+func (sc *Sqlite) Close() error {
+	close(sc.done)
+	return sc.db.Close()
+}
+
+// vacuum deletes the expired items every interval.
+func (sc *Sqlite) vacuum() {
+	if sc.interval < time.Second {
+		return
+	}
+	for {
+		select {
+		case <-clock.Or(sc.clock).After(sc.interval):
+		case <-sc.done:
+			return
+		}
+		// a failed delete is retried at the next interval.
+		sc.db.Write("DELETE FROM "+sc.table+" WHERE expiry > 0 AND expiry <= ?", sc.now())
+	}
+}
+
+func init() {
+	cache.Register("sqlite", func() cache.Cache { return NewSqlite() })
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"libs/cache"
+	"libs/clock"
+)
+
+func newTestSqlite(t *testing.T, c clock.Clock, config string) (*Sqlite, func()) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm := NewSqlite()
+	bm.SetClock(c)
+	if err = bm.StartAndGC(`{"path":"` + filepath.Join(dir, "cache.db") + `"` + config + `}`); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("init err", err)
+	}
+	return bm, func() {
+		bm.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSqlite(t *testing.T) {
+	bm, closeCache := newTestSqlite(t, nil, "")
+	defer closeCache()
+	ctx := context.Background()
+	if err := bm.Put(ctx, "astaxie", 1, 10*time.Second); err != nil {
+		t.Error("set Error", err)
+	}
+	if v, err := bm.Get(ctx, "astaxie"); err != nil || v.(int64) != 1 {
+		t.Error("get err", v, err)
+	}
+	if err := bm.Incr(ctx, "astaxie"); err != nil {
+		t.Error("Incr Error", err)
+	}
+	if v, _ := bm.Get(ctx, "astaxie"); v.(int64) != 2 {
+		t.Error("get err", v)
+	}
+	if err := bm.Decr(ctx, "astaxie"); err != nil {
+		t.Error("Decr Error", err)
+	}
+	if v, _ := bm.Get(ctx, "astaxie"); v.(int64) != 1 {
+		t.Error("get err", v)
+	}
+	if err := bm.Incr(ctx, "missing"); err != cache.ErrCacheMiss {
+		t.Error("Incr of a missing key", err)
+	}
+	bm.Put(ctx, "name", "author", 0)
+	if err := bm.Incr(ctx, "name"); err == nil || err == cache.ErrCacheMiss {
+		t.Error("Incr of a string", err)
+	}
+	vv, err := bm.GetMulti(ctx, []string{"name", "missing"})
+	if err != nil || vv[0].(string) != "author" || vv[1] != nil {
+		t.Error("GetMulti ERROR", vv, err)
+	}
+	if err = bm.Delete(ctx, "astaxie"); err != nil {
+		t.Error("delete err", err)
+	}
+	if ok, _ := bm.IsExist(ctx, "astaxie"); ok {
+		t.Error("delete err")
+	}
+	if err = bm.Delete(ctx, "astaxie"); err != nil {
+		t.Error("delete of a missing key", err)
+	}
+
+	type user struct{ Name string }
+	if err = bm.PutStruct(ctx, "user", user{"astaxie"}, time.Minute); err != nil {
+		t.Error("PutStruct error", err)
+	}
+	var u user
+	if err = bm.GetInto(ctx, "user", &u); err != nil || u.Name != "astaxie" {
+		t.Error("GetInto error", u, err)
+	}
+	if err = bm.ClearAll(ctx); err != nil {
+		t.Error("clear all err", err)
+	}
+	if ok, _ := bm.IsExist(ctx, "name"); ok {
+		t.Error("clear all err")
+	}
+}
+
+func TestSqliteExpire(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	bm, closeCache := newTestSqlite(t, c, `,"interval":60`)
+	defer closeCache()
+	ctx := context.Background()
+	bm.Put(ctx, "astaxie", 1, time.Minute)
+	bm.Put(ctx, "forever", 1, 0)
+	c.Advance(30 * time.Second)
+	if ok, _ := bm.IsExist(ctx, "astaxie"); !ok {
+		t.Error("key expired too early")
+	}
+	c.Advance(time.Minute)
+	if _, err := bm.Get(ctx, "astaxie"); err != cache.ErrCacheMiss {
+		t.Error("expired key should return cache.ErrCacheMiss", err)
+	}
+
+	// the gc deletes the expired rows.
+	for c.Waiters() == 0 {
+		runtime.Gosched()
+	}
+	c.Advance(time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for {
+		var n int
+		bm.db.QueryRow("SELECT count(*) FROM " + bm.table).Scan(&n)
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("gc did not delete the expired row", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ok, _ := bm.IsExist(ctx, "forever"); !ok {
+		t.Error("gc deleted a key stored forever")
+	}
+}
+
+func TestSqliteConcurrent(t *testing.T) {
+	bm, closeCache := newTestSqlite(t, nil, "")
+	defer closeCache()
+	ctx := context.Background()
+	bm.Put(ctx, "counter", 0, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := bm.Put(ctx, "key"+strconv.Itoa(i), i, 0); err != nil {
+				t.Error("set Error", err)
+			}
+			if err := bm.Incr(ctx, "counter"); err != nil {
+				t.Error("Incr Error", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if v, _ := bm.Get(ctx, "counter"); v.(int64) != 50 {
+		t.Error("counter error", v)
+	}
+	for i := 0; i < 50; i++ {
+		if v, err := bm.Get(ctx, "key"+strconv.Itoa(i)); err != nil || v.(int64) != int64(i) {
+			t.Error("get err", v, err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package ssdb
+
+import (
+	"testing"
+
+	"libs/internal/ssdbtest"
+)
+
+// newFakeSSDB starts a fake ssdb server and returns an adapter connected to it.
+func newFakeSSDB(t *testing.T) (*SSDB, *ssdbtest.Server) {
+	fs, err := ssdbtest.NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := NewSSDB()
+	if err = sd.StartAndGC(fs.Config()); err != nil {
+		fs.Close()
+		t.Fatal("init err", err)
+	}
+	return sd, fs
+}
@@ -0,0 +1,93 @@
+package ssdb
+
+import "fmt"
+
+// Iterator walks the results of a scan command batch by batch.
+// usage:
+//	it := sd.ScanIterator("user:", "user:\xff", 100)
+//	for it.Next() {
+//		fmt.Println(it.Key(), it.Value())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	// fetch returns the key-value pairs after key and value.
+	fetch func(key, value string) ([]string, error)
+	limit int64
+
+	batch      []string
+	pos        int
+	key, value string
+	done       bool
+	err        error
+}
+
+// Next advances to the next pair, it returns false at the end or on error.
+func (it *Iterator) Next() bool {
+	if it.pos >= len(it.batch) {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.batch, it.err = it.fetch(it.key, it.value)
+		it.pos = 0
+		if it.err != nil || len(it.batch) < 2 {
+			it.done = true
+			return false
+		}
+		it.done = int64(len(it.batch)/2) < it.limit
+	}
+	it.key, it.value = it.batch[it.pos], it.batch[it.pos+1]
+	it.pos += 2
+	return true
+}
+
+// Key returns the current key.
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+// Value returns the current value, the score for ZScanIterator.
+func (it *Iterator) Value() string {
+	return it.value
+}
+
+// Err returns the error which stopped the iteration.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// ScanIterator iterates over the keys in (keyStart, keyEnd] and their values,
+// fetching limit pairs at a time. an empty keyEnd means no upper bound.
+func (sd *SSDB) ScanIterator(keyStart, keyEnd string, limit int64) *Iterator {
+	return &Iterator{
+		key:   keyStart,
+		limit: limit,
+		fetch: func(key, _ string) ([]string, error) {
+			return sd.call("scan", key, keyEnd, limit)
+		},
+	}
+}
+
+// HScanIterator iterates over the fields in (keyStart, keyEnd] of the hashmap setName.
+func (sd *SSDB) HScanIterator(setName, keyStart, keyEnd string, limit int64) *Iterator {
+	return &Iterator{
+		key:   keyStart,
+		limit: limit,
+		fetch: func(key, _ string) ([]string, error) {
+			return sd.call("hscan", setName, key, keyEnd, limit)
+		},
+	}
+}
+
+// ZScanIterator iterates over the members of the zset setName with a score
+// in [scoreStart, scoreEnd], by increasing score. an empty score is unbounded.
+func (sd *SSDB) ZScanIterator(setName string, scoreStart, scoreEnd interface{}, limit int64) *Iterator {
+	return &Iterator{
+		value: fmt.Sprint(scoreArg(scoreStart)),
+		limit: limit,
+		fetch: func(key, score string) ([]string, error) {
+			return sd.call("zscan", setName, key, score, scoreArg(scoreEnd), limit)
+		},
+	}
+}
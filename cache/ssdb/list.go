@@ -7,12 +7,7 @@ package ssdb
 //  返回 size，添加元素之后, 队列的长度
 //  返回 err，执行的错误，操作成功返回 nil
 func (sd *SSDB) QPushFront(name string, value interface{}) (int64, error) {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return 0, err
-	}
-	defer c.Close()
-	return c.QPushFront(name, value)
+	return sd.callInt("qpush_front", name, value)
 }
 
 //往队列的尾部添加一个或者多个元素
@@ -22,48 +17,39 @@ func (sd *SSDB) QPushFront(name string, value interface{}) (int64, error) {
 //  返回 size，添加元素之后, 队列的长度
 //  返回 err，执行的错误，操作成功返回 nil
 func (sd *SSDB) QPushBack(name string, value interface{}) (int64, error) {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return 0, err
-	}
-	defer c.Close()
-	return c.QPushBack(name, value)
+	return sd.callInt("qpush_back", name, value)
 }
 
 //从队列首部弹出最后一个元素.
 //
 //  name 队列的名字
-//  返回 v，返回一个元素，并在队列中删除 v；队列为空时返回空值
+//  返回 v，返回一个元素，并在队列中删除 v；队列为空时返回 ErrNotFound
 //  返回 err，执行的错误，操作成功返回 nil
 func (sd *SSDB) QPopFront(name string) (string, error) {
-	c, err := sd.spool.NewClient()
+	resp, err := sd.call("qpop_front", name)
 	if err != nil {
 		return "", err
 	}
-	defer c.Close()
-	val, err := c.QPopFront(name)
-	if err != nil {
-		return "", err
+	if len(resp) == 0 {
+		return "", ErrNotFound
 	}
-	return sd.getString(val), nil
+	return resp[0], nil
 }
 
 //从队列尾部弹出最后一个元素.
 //
 //  name 队列的名字
-//  返回 v，返回一个元素，并在队列中删除 v；队列为空时返回空值
+//  返回 v，返回一个元素，并在队列中删除 v；队列为空时返回 ErrNotFound
 //  返回 err，执行的错误，操作成功返回 nil
 func (sd *SSDB) QPopBack(name string) (string, error) {
-	c, err := sd.spool.NewClient()
+	resp, err := sd.call("qpop_back", name)
 	if err != nil {
 		return "", err
 	}
-	defer c.Close()
-	val, err := c.QPopBack(name)
-	if err != nil {
-		return "", err
+	if len(resp) == 0 {
+		return "", ErrNotFound
 	}
-	return sd.getString(val), nil
+	return resp[0], nil
 }
 
 //返回队列的长度.
@@ -72,12 +58,7 @@ func (sd *SSDB) QPopBack(name string) (string, error) {
 //  返回 size，队列的长度；
 //  返回 err，执行的错误，操作成功返回 nil
 func (sd *SSDB) QSize(name string) (int64, error) {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return 0, err
-	}
-	defer c.Close()
-	return c.QSize(name)
+	return sd.callInt("qsize", name)
 }
 
 //返回指定位置的元素. 0 表示第一个元素, 1 是第二个 ... -1 是最后一个.
@@ -85,16 +66,66 @@ func (sd *SSDB) QSize(name string) (int64, error) {
 //  key  队列的名字
 //  index 指定的位置，可传负数.
 //  返回 val，返回的值.
-//  返回 err，执行的错误，操作成功返回 nil
+//  返回 err，执行的错误，位置超出队列时返回 ErrNotFound
 func (sd *SSDB) QGet(name string, index int64) (string, error) {
-	c, err := sd.spool.NewClient()
+	resp, err := sd.call("qget", name, index)
 	if err != nil {
 		return "", err
 	}
-	defer c.Close()
-	val, err := c.QGet(name, index)
+	if len(resp) == 0 {
+		return "", ErrNotFound
+	}
+	return resp[0], nil
+}
+
+//返回下标处于区间 [offset, offset + limit) 的元素.
+//
+//  name  队列的名字
+//  offset 从此下标处开始返回, 可以是负数.
+//  limit 最多返回这么多个元素.
+//  返回 v，元素的数组
+//  返回 err，执行的错误，操作成功返回 nil
+func (sd *SSDB) QRange(name string, offset, limit int) ([]string, error) {
+	return sd.call("qrange", name, offset, limit)
+}
+
+//返回下标处于区间 [begin, end] 的元素. begin 和 end 可以是负数, -1 是最后一个.
+//
+//  name  队列的名字
+//  返回 v，元素的数组
+//  返回 err，执行的错误，操作成功返回 nil
+func (sd *SSDB) QSlice(name string, begin, end int) ([]string, error) {
+	return sd.call("qslice", name, begin, end)
+}
+
+//从队列首部删除最多 size 个元素.
+//
+//  name  队列的名字
+//  返回 n，删除的元素个数
+//  返回 err，执行的错误，操作成功返回 nil
+func (sd *SSDB) QTrimFront(name string, size int) (int64, error) {
+	resp, err := sd.call("qtrim_front", name, size)
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(resp)
+}
+
+//从队列尾部删除最多 size 个元素.
+//
+//  name  队列的名字
+//  返回 n，删除的元素个数
+//  返回 err，执行的错误，操作成功返回 nil
+func (sd *SSDB) QTrimBack(name string, size int) (int64, error) {
+	resp, err := sd.call("qtrim_back", name, size)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
-	return sd.getString(val), nil
+	return parseInt(resp)
+}
+
+//清空队列.
+func (sd *SSDB) QClear(name string) error {
+	_, err := sd.call("qclear", name)
+	return err
 }
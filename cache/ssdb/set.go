@@ -1,36 +1,35 @@
 package ssdb
 
+import "strconv"
+
+// ZMember is a key of a zset with its score.
+type ZMember struct {
+	Key   string
+	Score int64
+}
+
 //返回 zset 中的元素个数.
 func (sd *SSDB) ZSize(setName string) (int64, error) {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return 0, err
-	}
-	defer c.Close()
-
-	return c.ZSize(setName)
+	return sd.callInt("zsize", setName)
 }
 
 // 设置 zset 中指定 key 对应的权重值.
 func (sd *SSDB) ZSet(setName string, key string, score int64) error {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-
-	return c.ZSet(setName, key, score)
+	_, err := sd.call("zset", setName, key, score)
+	return err
 }
 
 //批量设置 zset 中的 key-score.
 func (sd *SSDB) MultiZSet(setName string, kvs map[string]int64) error {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return err
+	if len(kvs) == 0 {
+		return nil
 	}
-	defer c.Close()
-
-	return c.MultiZSet(setName, kvs)
+	args := []interface{}{"multi_zset", setName}
+	for k, v := range kvs {
+		args = append(args, k, v)
+	}
+	_, err := sd.call(args...)
+	return err
 }
 
 //批量获取 zset 中的 key-score.
@@ -39,13 +38,14 @@ func (sd *SSDB) MultiZSet(setName string, kvs map[string]int64) error {
 //  key 要获取key的列表，支持多个key
 //  返回 val 包含 key-score 的map
 func (sd *SSDB) MultiZGet(setName string, keys []string) (map[string]int64, error) {
-	c, err := sd.spool.NewClient()
+	if len(keys) == 0 {
+		return make(map[string]int64), nil
+	}
+	resp, err := sd.call("multi_zget", setName, keys)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
-
-	return c.MultiZGet(setName, keys...)
+	return scores(resp)
 }
 
 // 使 zset 中的 key 对应的值增加 num. 参数 num 可以为负数.
@@ -55,46 +55,27 @@ func (sd *SSDB) MultiZGet(setName string, keys []string) (map[string]int64, erro
 //  返回 int64 增加后的新权重值
 //  返回 err，可能的错误，操作成功返回 nil
 func (sd *SSDB) ZIncr(setName string, key string, num int64) (int64, error) {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return 0, err
-	}
-	defer c.Close()
-
-	return c.ZIncr(setName, key, num)
+	return sd.callInt("zincr", setName, key, num)
 }
 
-//获取 zset 中指定 key 对应的权重值.
+//获取 zset 中指定 key 对应的权重值. key 不存在时返回 ErrNotFound.
 func (sd *SSDB) ZGet(setName, key string) (int64, error) {
-	c, err := sd.spool.NewClient()
+	resp, err := sd.call("zget", setName, key)
 	if err != nil {
 		return 0, err
 	}
-	defer c.Close()
-
-	return c.ZGet(setName, key)
+	return parseInt(resp)
 }
 
 //删除 zset 中指定 key
 func (sd *SSDB) ZDel(setName, key string) error {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-
-	return c.ZDel(setName, key)
+	_, err := sd.call("zdel", setName, key)
+	return err
 }
 
 //判断指定的 key 是否存在于 zset 中.
 func (sd *SSDB) ZExists(setName, key string) (bool, error) {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return false, err
-	}
-	defer c.Close()
-
-	return c.ZExists(setName, key)
+	return sd.callBool("zexists", setName, key)
 }
 
 //根据下标索引区间 [offset, offset + limit) 获取 key-score 对, 下标从 0 开始.注意! 本方法在 offset 越来越大时, 会越慢!
@@ -105,13 +86,11 @@ func (sd *SSDB) ZExists(setName, key string) (bool, error) {
 //  返回 val 排名
 //  返回 err，可能的错误，操作成功返回 nil
 func (sd *SSDB) ZRange(setName string, offset, limit int64) (val map[string]int64, err error) {
-	c, err := sd.spool.NewClient()
+	resp, err := sd.call("zrange", setName, offset, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
-
-	return c.ZRange(setName, offset, limit)
+	return scores(resp)
 }
 
 //根据下标索引区间 [offset, offset + limit) 获取 key-score 对, 反向顺序获取.注意! 本方法在 offset 越来越大时, 会越慢!
@@ -122,11 +101,75 @@ func (sd *SSDB) ZRange(setName string, offset, limit int64) (val map[string]int6
 //  返回 val 排名
 //  返回 err，可能的错误，操作成功返回 nil
 func (sd *SSDB) ZRRange(setName string, offset, limit int64) (val map[string]int64, err error) {
-	c, err := sd.spool.NewClient()
+	resp, err := sd.call("zrrange", setName, offset, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
+	return scores(resp)
+}
+
+//列出 zset 中权重处于区间 (scoreStart+keyStart, scoreEnd] 的 key-score, 按权重升序.
+//
+//  setName zset名称
+//  keyStart scoreStart 对应的 key, 从它之后开始返回, 空字符串表示从头开始.
+//  scoreStart 最小权重值, 空字符串表示 -inf.
+//  scoreEnd 最大权重值(包含), 空字符串表示 +inf.
+//  limit 最多返回这么多个 key-score 对.
+//  返回 val 按顺序的 key-score
+//  返回 err，可能的错误，操作成功返回 nil
+func (sd *SSDB) ZScan(setName, keyStart string, scoreStart, scoreEnd interface{}, limit int64) ([]ZMember, error) {
+	return sd.zscan("zscan", setName, keyStart, scoreStart, scoreEnd, limit)
+}
+
+//列出 zset 中权重处于区间 [scoreEnd, scoreStart+keyStart) 的 key-score, 按权重降序.
+//参数同 ZScan, scoreStart 为最大权重值.
+func (sd *SSDB) ZRScan(setName, keyStart string, scoreStart, scoreEnd interface{}, limit int64) ([]ZMember, error) {
+	return sd.zscan("zrscan", setName, keyStart, scoreStart, scoreEnd, limit)
+}
+
+func (sd *SSDB) zscan(cmd, setName, keyStart string, scoreStart, scoreEnd interface{}, limit int64) ([]ZMember, error) {
+	resp, err := sd.call(cmd, setName, keyStart, scoreArg(scoreStart), scoreArg(scoreEnd), limit)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]ZMember, 0, len(resp)/2)
+	for i := 0; i+1 < len(resp); i += 2 {
+		score, err := strconv.ParseInt(resp[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ZMember{Key: resp[i], Score: score})
+	}
+	return members, nil
+}
 
-	return c.ZRRange(setName, offset, limit)
+//列出 zset 中权重处于区间 (scoreStart+keyStart, scoreEnd] 的 key, 参数同 ZScan.
+func (sd *SSDB) ZKeys(setName, keyStart string, scoreStart, scoreEnd interface{}, limit int64) ([]string, error) {
+	return sd.call("zkeys", setName, keyStart, scoreArg(scoreStart), scoreArg(scoreEnd), limit)
+}
+
+//返回 zset 中权重处于区间 [scoreStart, scoreEnd] 的 key 的数量, 空字符串表示不限.
+func (sd *SSDB) ZCount(setName string, scoreStart, scoreEnd interface{}) (int64, error) {
+	resp, err := sd.call("zcount", setName, scoreArg(scoreStart), scoreArg(scoreEnd))
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(resp)
+}
+
+//删除 zset 中权重处于区间 [scoreStart, scoreEnd] 的 key, 返回删除的数量.
+func (sd *SSDB) ZRemRangeByScore(setName string, scoreStart, scoreEnd interface{}) (int64, error) {
+	resp, err := sd.call("zremrangebyscore", setName, scoreArg(scoreStart), scoreArg(scoreEnd))
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(resp)
+}
+
+// scoreArg sends a nil score as an empty string, which is unbounded.
+func scoreArg(score interface{}) interface{} {
+	if score == nil {
+		return ""
+	}
+	return score
 }
@@ -1,14 +1,23 @@
 package ssdb
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
+
 	"github.com/seefan/gossdb"
 	gconf "github.com/seefan/gossdb/conf"
 	"github.com/seefan/gossdb/pool"
-	"time"
+
+	"libs/cache"
 )
 
+// ErrNotFound is returned when the key, field or element does not exist.
+// it is cache.ErrCacheMiss, so Get and the typed methods report a miss the same way.
+var ErrNotFound = cache.ErrCacheMiss
+
 //NewSSDB create new ssdb adapter.
 func NewSSDB() *SSDB {
 	return &SSDB{}
@@ -17,62 +26,86 @@ func NewSSDB() *SSDB {
 // SSDB adapter
 type SSDB struct {
 	spool    *pool.Connectors
-	conninfo map[string]interface{}
+	conninfo *ssdbConfig
+}
+
+// ssdbConfig is the json config accepted by StartAndGC.
+type ssdbConfig struct {
+	Host             string `json:"host"`
+	Port             int    `json:"port"`
+	HealthSecond     int    `json:"health_second"`
+	MaxWaitSize      int    `json:"max_wait_size"`
+	MinPoolSize      int    `json:"min_pool_size"`
+	MaxPoolSize      int    `json:"max_pool_size"`
+	GetClientTimeout int    `json:"get_client_timeout"`
+}
+
+// client checks ctx before borrowing a client from the pool.
+func (sd *SSDB) client(ctx context.Context) (*pool.Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sd.spool.NewClient()
 }
 
 // Get value from SSDB.
-func (sd *SSDB) Get(key string) (interface{}, error) {
-	c, err := sd.spool.NewClient()
+// if non-existed, return cache.ErrCacheMiss.
+func (sd *SSDB) Get(ctx context.Context, key string) (interface{}, error) {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer c.Close()
 
-	value, err := c.Get(key)
-	if err == nil {
-		return value, nil
+	resp, err := c.Do("get", key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 2 && resp[0] == "ok" {
+		return resp[1], nil
 	}
-	return nil, nil
+	if len(resp) > 0 && resp[0] == "not_found" {
+		return nil, cache.ErrCacheMiss
+	}
+	return nil, fmt.Errorf("bad response %v", resp)
 }
 
 // GetMulti get value from SSDB.
-func (sd *SSDB) GetMulti(keys []string) ([]interface{}, error) {
-	c, err := sd.spool.NewClient()
+// the result has the same length as keys, missing keys are nil.
+func (sd *SSDB) GetMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer c.Close()
-	size := len(keys)
-	var values []interface{}
-	res, err := c.Do("multi_get", keys)
-	resSize := len(res)
-	if err == nil {
-		for i := 1; i < resSize; i += 2 {
-			values = append(values, res[i+1])
-		}
+
+	values := make([]interface{}, len(keys))
+	if len(keys) == 0 {
 		return values, nil
 	}
-	for i := 0; i < size; i++ {
-		values = append(values, err)
+	resp, err := reply(c.Do(flatten("multi_get", keys)...))
+	if err != nil {
+		return nil, err
+	}
+	res := pairs(resp)
+	for i, key := range keys {
+		if v, ok := res[key]; ok {
+			values[i] = v
+		}
 	}
 	return values, nil
 }
 
-// DelMulti get value from memSSDB.
+// DelMulti delete values in memSSDB.
 func (sd *SSDB) DelMulti(keys []string) error {
-	c, err := sd.spool.NewClient()
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-
-	_, err = c.Do("multi_del", keys)
+	_, err := sd.call("multi_del", keys)
 	return err
 }
 
 // Put put value to memSSDB. only support string.
-func (sd *SSDB) Put(key string, value interface{}, timeout time.Duration) error {
-	c, err := sd.spool.NewClient()
+// a timeout of 0 or less means forever.
+func (sd *SSDB) Put(ctx context.Context, key string, value interface{}, timeout time.Duration) error {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return err
 	}
@@ -82,102 +115,105 @@ func (sd *SSDB) Put(key string, value interface{}, timeout time.Duration) error
 	if !ok {
 		return errors.New("value must string")
 	}
-	var resp []string
-	ttl := int(timeout / time.Second)
-	if ttl < 0 {
-		resp, err = c.Do("set", key, v)
-	} else {
-		resp, err = c.Do("setx", key, v, ttl)
-	}
-	if err != nil {
+	if timeout <= 0 {
+		_, err = reply(c.Do("set", key, v))
 		return err
 	}
-	if len(resp) == 2 && resp[0] == "ok" {
-		return nil
-	}
-	return errors.New("bad response")
+	// ssdb expires by seconds, round up so the key is not stored forever.
+	ttl := int((timeout + time.Second - 1) / time.Second)
+	_, err = reply(c.Do("setx", key, v, ttl))
+	return err
 }
 
 // Delete delete value in memSSDB.
-func (sd *SSDB) Delete(key string) error {
-	c, err := sd.spool.NewClient()
+func (sd *SSDB) Delete(ctx context.Context, key string) error {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
-	err = c.Del(key)
+	// ssdb replies ok to the del of a missing key, some versions not_found.
+	if _, err = reply(c.Do("del", key)); err == ErrNotFound {
+		return nil
+	}
 	return err
 }
 
 // Incr increase counter.
-func (sd *SSDB) Incr(key string) error {
-	c, err := sd.spool.NewClient()
+func (sd *SSDB) Incr(ctx context.Context, key string) error {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
-	_, err = c.Do("incr", key, 1)
+	_, err = reply(c.Do("incr", key, 1))
 	return err
 }
 
 // Decr decrease counter.
-func (sd *SSDB) Decr(key string) error {
-	c, err := sd.spool.NewClient()
+func (sd *SSDB) Decr(ctx context.Context, key string) error {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
-	_, err = c.Do("incr", key, -1)
+	_, err = reply(c.Do("incr", key, -1))
 	return err
 }
 
 // IsExist check value exists in memSSDB.
-func (sd *SSDB) IsExist(key string) (bool, error) {
-	c, err := sd.spool.NewClient()
+func (sd *SSDB) IsExist(ctx context.Context, key string) (bool, error) {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return false, err
 	}
 	defer c.Close()
 
-	resp, err := c.Do("exists", key)
+	resp, err := reply(c.Do("exists", key))
 	if err != nil {
 		return false, err
 	}
-	if len(resp) == 2 && resp[1] == "1" {
-		return true, nil
-	}
-	return false, nil
-
+	n, err := parseInt(resp)
+	return n == 1, err
 }
 
 // ClearAll clear all SSDBd in memSSDB.
-func (sd *SSDB) ClearAll() error {
-	c, err := sd.spool.NewClient()
+func (sd *SSDB) ClearAll(ctx context.Context) error {
+	return sd.deleteRange(ctx, "", "")
+}
+
+// deleteRange deletes the keys in (keyStart, keyEnd] in batches,
+// an empty keyEnd means no upper bound.
+func (sd *SSDB) deleteRange(ctx context.Context, keyStart, keyEnd string) error {
+	c, err := sd.client(ctx)
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
-	keyStart, keyEnd, limit := "", "", 50
-	resp, err := sd.Scan(keyStart, keyEnd, limit)
+	limit := 50
+	// the held client scans, a second one could wait forever on a pool of one.
+	resp, err := sd.scan(c, keyStart, keyEnd, limit)
 	for err == nil {
 		size := len(resp)
 		if size == 1 {
 			return nil
 		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
 		keys := []string{}
 		for i := 1; i < size; i += 2 {
 			keys = append(keys, resp[i])
 		}
-		_, e := c.Do("multi_del", keys)
-		if e != nil {
+		if _, e := reply(c.Do(flatten("multi_del", keys)...)); e != nil {
 			return e
 		}
 		keyStart = resp[size-2]
-		resp, err = sd.Scan(keyStart, keyEnd, limit)
+		resp, err = sd.scan(c, keyStart, keyEnd, limit)
 	}
 	return err
 }
@@ -189,12 +225,11 @@ func (sd *SSDB) Scan(keyStart string, keyEnd string, limit int) ([]string, error
 		return nil, err
 	}
 	defer c.Close()
+	return sd.scan(c, keyStart, keyEnd, limit)
+}
 
-	resp, err := c.Do("scan", keyStart, keyEnd, limit)
-	if err != nil {
-		return nil, err
-	}
-	return resp, nil
+func (sd *SSDB) scan(c *pool.Client, keyStart string, keyEnd string, limit int) ([]string, error) {
+	return c.Do("scan", keyStart, keyEnd, limit)
 }
 
 // actually do the ssdb cmds
@@ -216,22 +251,89 @@ func (sd *SSDB) do(c *pool.Client, commandName string, args ...interface{}) ([]s
 		return nil, errors.New("missing required arguments")
 	}
 	param := []interface{}{commandName}
-	for _, v := range args {
-		param = append(param, v)
+	param = append(param, args...)
+	return reply(c.Do(flatten(param...)...))
+}
+
+// call runs a command on a pooled client and returns the data of its reply.
+func (sd *SSDB) call(args ...interface{}) ([]string, error) {
+	c, err := sd.spool.NewClient()
+	if err != nil {
+		return nil, err
 	}
-	res, err := c.Do(param...)
-	if err != nil || len(res) == 0 {
+	defer c.Close()
+	return reply(c.Do(flatten(args...)...))
+}
+
+// reply checks the status of resp and returns the data after it.
+// not_found is ErrNotFound, any other status than ok is an error.
+func reply(resp []string, err error) ([]string, error) {
+	if err != nil {
 		return nil, err
 	}
-	if fmt.Sprintf("%v", res[0]) == "ok" {
-		return res[1:], nil
+	if len(resp) == 0 {
+		return nil, errors.New("ssdb: empty response")
 	}
-	return nil, nil
+	switch resp[0] {
+	case "ok":
+		return resp[1:], nil
+	case "not_found":
+		return nil, ErrNotFound
+	}
+	return nil, fmt.Errorf("ssdb: %s %v", resp[0], resp[1:])
+}
+
+// flatten expands the []string arguments, the client only sends scalars.
+func flatten(args ...interface{}) []interface{} {
+	param := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if list, ok := arg.([]string); ok {
+			for _, v := range list {
+				param = append(param, v)
+			}
+			continue
+		}
+		param = append(param, arg)
+	}
+	return param
+}
+
+// TTL returns the remaining time to live of key,
+// a negative ttl means that key does not exist or never expires.
+func (sd *SSDB) TTL(key string) (time.Duration, error) {
+	resp, err := sd.call("ttl", key)
+	if err != nil {
+		return 0, err
+	}
+	ttl, err := parseInt(resp)
+	if ttl < 0 {
+		return -1, err
+	}
+	return time.Duration(ttl) * time.Second, err
+}
+
+// Expire sets the time to live of key, rounded up to seconds like Put.
+// it returns false if key does not exist.
+func (sd *SSDB) Expire(key string, ttl time.Duration) (bool, error) {
+	return sd.callBool("expire", key, int64((ttl+time.Second-1)/time.Second))
+}
+
+// Keys returns up to limit keys in (keyStart, keyEnd], an empty keyEnd means no upper bound.
+func (sd *SSDB) Keys(keyStart, keyEnd string, limit int64) ([]string, error) {
+	return sd.call("keys", keyStart, keyEnd, limit)
 }
 
 // StartAndGC start memSSDB adapter.
-func (sd *SSDB) StartAndGC(config map[string]interface{}) error {
-	sd.conninfo = config
+// config is like {"host":"127.0.0.1","port":8888,"health_second":30,"max_wait_size":1000,"min_pool_size":20,"max_pool_size":100,"get_client_timeout":5}
+func (sd *SSDB) StartAndGC(config string) error {
+	var cf ssdbConfig
+	if err := json.Unmarshal([]byte(config), &cf); err != nil {
+		return err
+	}
+	if cf.Host == "" || cf.Port == 0 {
+		return errors.New("config has no host or port")
+	}
+	sd.conninfo = &cf
 	if err := sd.connectInit(); err != nil {
 		return err
 	}
@@ -242,16 +344,20 @@ func (sd *SSDB) StartAndGC(config map[string]interface{}) error {
 func (sd *SSDB) connectInit() error {
 	var err error
 	sd.spool, err = gossdb.NewPool(&gconf.Config{
-		Host:             sd.conninfo["host"].(string),
-		Port:             sd.conninfo["port"].(int),
-		HealthSecond:     sd.conninfo["health_second"].(int),
-		MaxWaitSize:      sd.conninfo["max_wait_size"].(int),
-		MinPoolSize:      sd.conninfo["min_pool_size"].(int),
-		MaxPoolSize:      sd.conninfo["max_pool_size"].(int),
-		GetClientTimeout: sd.conninfo["get_client_timeout"].(int),
+		Host:             sd.conninfo.Host,
+		Port:             sd.conninfo.Port,
+		HealthSecond:     sd.conninfo.HealthSecond,
+		MaxWaitSize:      sd.conninfo.MaxWaitSize,
+		MinPoolSize:      sd.conninfo.MinPoolSize,
+		MaxPoolSize:      sd.conninfo.MaxPoolSize,
+		GetClientTimeout: sd.conninfo.GetClientTimeout,
 	})
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func init() {
+	cache.Register("ssdb", func() cache.Cache { return NewSSDB() })
+}
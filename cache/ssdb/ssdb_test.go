@@ -0,0 +1,269 @@
+package ssdb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"libs/cache"
+)
+
+func TestSSDBCache(t *testing.T) {
+	sd, fs := newFakeSSDB(t)
+	defer fs.Close()
+	ctx := context.Background()
+
+	if _, err := sd.Get(ctx, "missing"); err != cache.ErrCacheMiss {
+		t.Error("Get of a missing key should return ErrCacheMiss", err)
+	}
+	if err := sd.Put(ctx, "a", "1", time.Minute); err != nil {
+		t.Fatal("Put err", err)
+	}
+	sd.Put(ctx, "b", "2", -1)
+	if v, err := sd.Get(ctx, "a"); v != "1" || err != nil {
+		t.Error("Get err", v, err)
+	}
+	values, err := sd.GetMulti(ctx, []string{"a", "missing", "b"})
+	if err != nil || !reflect.DeepEqual(values, []interface{}{"1", nil, "2"}) {
+		t.Error("GetMulti should keep the key order", values, err)
+	}
+	if err = sd.DelMulti([]string{"a", "b"}); err != nil {
+		t.Error("DelMulti err", err)
+	}
+	if ok, _ := sd.IsExist(ctx, "a"); ok {
+		t.Error("a should be deleted")
+	}
+	if _, err = sd.Do("no_such_command", "a"); err == nil {
+		t.Error("Do should return the error reply")
+	}
+}
+
+func TestSSDBKeys(t *testing.T) {
+	sd, fs := newFakeSSDB(t)
+	defer fs.Close()
+	ctx := context.Background()
+
+	if ttl, err := sd.TTL("missing"); ttl >= 0 || err != nil {
+		t.Error("TTL of a missing key should be negative", ttl, err)
+	}
+	sd.Put(ctx, "k", "v", -1)
+	if ok, err := sd.Expire("k", time.Minute); !ok || err != nil {
+		t.Error("Expire err", ok, err)
+	}
+	if ttl, _ := sd.TTL("k"); ttl != time.Minute {
+		t.Error("TTL should be a minute", ttl)
+	}
+	// a ttl under a second is rounded up, not to a ttl of 0.
+	if ok, err := sd.Expire("k", 10*time.Millisecond); !ok || err != nil {
+		t.Error("Expire err", ok, err)
+	}
+	if ttl, _ := sd.TTL("k"); ttl != time.Second {
+		t.Error("TTL should be rounded up to a second", ttl)
+	}
+	if ok, _ := sd.Expire("missing", time.Minute); ok {
+		t.Error("Expire of a missing key should return false")
+	}
+
+	for _, key := range []string{"user:1", "user:2", "user:3", "zzz"} {
+		sd.Put(ctx, key, key, -1)
+	}
+	if keys, _ := sd.Keys("user:", "user:\xff", 10); !reflect.DeepEqual(keys, []string{"user:1", "user:2", "user:3"}) {
+		t.Error("Keys got", keys)
+	}
+	var got []string
+	it := sd.ScanIterator("user:", "user:\xff", 2)
+	for it.Next() {
+		got = append(got, it.Key()+"="+it.Value())
+	}
+	if it.Err() != nil || !reflect.DeepEqual(got, []string{"user:1=user:1", "user:2=user:2", "user:3=user:3"}) {
+		t.Error("ScanIterator got", got, it.Err())
+	}
+
+	if err := sd.DeletePrefix(ctx, "user:"); err != nil {
+		t.Error("DeletePrefix err", err)
+	}
+	if keys, _ := sd.Keys("", "", 10); !reflect.DeepEqual(keys, []string{"k", "zzz"}) {
+		t.Error("DeletePrefix should only delete the prefix", keys)
+	}
+	if err := sd.ClearAll(ctx); err != nil {
+		t.Error("ClearAll err", err)
+	}
+	if keys, _ := sd.Keys("", "", 10); len(keys) != 0 {
+		t.Error("ClearAll should delete all keys", keys)
+	}
+}
+
+func TestSSDBTags(t *testing.T) {
+	sd, fs := newFakeSSDB(t)
+	defer fs.Close()
+	ctx := context.Background()
+
+	var tc cache.TagCache = sd
+	tc.PutWithTags(ctx, "profile:42", "p", time.Minute, "user:42")
+	tc.PutWithTags(ctx, "orders:42", "o", time.Minute, "user:42")
+	tc.Put(ctx, "profile:43", "p", time.Minute)
+	if err := tc.InvalidateTags(ctx, "user:42"); err != nil {
+		t.Error("InvalidateTags err", err)
+	}
+	if keys, _ := sd.Keys("", "", 10); !reflect.DeepEqual(keys, []string{"profile:43"}) {
+		t.Error("InvalidateTags should delete the tagged keys", keys)
+	}
+}
+
+func TestSSDBZSet(t *testing.T) {
+	sd, fs := newFakeSSDB(t)
+	defer fs.Close()
+
+	if _, err := sd.ZGet("z", "missing"); err != ErrNotFound {
+		t.Error("ZGet of a missing key should return ErrNotFound", err)
+	}
+	for key, score := range map[string]int64{"a": 1, "b": 2, "c": 2, "d": 3, "e": 5} {
+		sd.ZSet("z", key, score)
+	}
+	if n, err := sd.ZSize("z"); n != 5 || err != nil {
+		t.Error("ZSize got", n, err)
+	}
+	if ok, _ := sd.ZExists("z", "a"); !ok {
+		t.Error("a should exist")
+	}
+	if n, _ := sd.ZIncr("z", "a", 2); n != 3 {
+		t.Error("ZIncr got", n)
+	}
+	sd.ZIncr("z", "a", -2)
+	if v, _ := sd.ZRange("z", 1, 2); !reflect.DeepEqual(v, map[string]int64{"b": 2, "c": 2}) {
+		t.Error("ZRange got", v)
+	}
+	if v, _ := sd.ZRRange("z", 0, 1); !reflect.DeepEqual(v, map[string]int64{"e": 5}) {
+		t.Error("ZRRange got", v)
+	}
+	if v, _ := sd.MultiZGet("z", []string{"a", "missing"}); !reflect.DeepEqual(v, map[string]int64{"a": 1}) {
+		t.Error("MultiZGet got", v)
+	}
+	sd.MultiZSet("y", map[string]int64{"a": 1})
+	if err := sd.ZDel("y", "a"); err != nil {
+		t.Error("ZDel err", err)
+	}
+	if ok, _ := sd.ZExists("y", "a"); ok {
+		t.Error("a should be deleted")
+	}
+	members, err := sd.ZScan("z", "", 2, 3, 10)
+	want := []ZMember{{"b", 2}, {"c", 2}, {"d", 3}}
+	if err != nil || !reflect.DeepEqual(members, want) {
+		t.Error("ZScan got", members, err)
+	}
+	members, _ = sd.ZRScan("z", "", "", 2, 10)
+	want = []ZMember{{"e", 5}, {"d", 3}, {"c", 2}, {"b", 2}}
+	if !reflect.DeepEqual(members, want) {
+		t.Error("ZRScan got", members)
+	}
+	if keys, _ := sd.ZKeys("z", "b", 2, "", 10); !reflect.DeepEqual(keys, []string{"c", "d", "e"}) {
+		t.Error("ZKeys should continue after b", keys)
+	}
+	if n, _ := sd.ZCount("z", 2, 3); n != 3 {
+		t.Error("ZCount got", n)
+	}
+
+	var keys []string
+	it := sd.ZScanIterator("z", nil, 3, 2)
+	for it.Next() {
+		keys = append(keys, it.Key()+":"+it.Value())
+	}
+	if it.Err() != nil || !reflect.DeepEqual(keys, []string{"a:1", "b:2", "c:2", "d:3"}) {
+		t.Error("ZScanIterator got", keys, it.Err())
+	}
+
+	if n, _ := sd.ZRemRangeByScore("z", "", 2); n != 3 {
+		t.Error("ZRemRangeByScore got", n)
+	}
+	if n, _ := sd.ZCount("z", "", ""); n != 2 {
+		t.Error("ZCount after ZRemRangeByScore got", n)
+	}
+}
+
+func TestSSDBQueue(t *testing.T) {
+	sd, fs := newFakeSSDB(t)
+	defer fs.Close()
+
+	if _, err := sd.QPopFront("q"); err != ErrNotFound {
+		t.Error("QPopFront of an empty queue should return ErrNotFound", err)
+	}
+	for _, v := range []string{"1", "2", "3", "4", "5"} {
+		sd.QPushBack("q", v)
+	}
+	if n, err := sd.QPushFront("q", "0"); n != 6 || err != nil {
+		t.Error("QPushFront got", n, err)
+	}
+	sd.QPopFront("q")
+	if n, _ := sd.QSize("q"); n != 5 {
+		t.Error("QSize got", n)
+	}
+	if v, err := sd.QGet("q", -1); v != "5" || err != nil {
+		t.Error("QGet -1 should be the last element", v, err)
+	}
+	if _, err := sd.QGet("q", 10); err != ErrNotFound {
+		t.Error("QGet out of range should return ErrNotFound", err)
+	}
+	if v, _ := sd.QRange("q", 1, 2); !reflect.DeepEqual(v, []string{"2", "3"}) {
+		t.Error("QRange got", v)
+	}
+	if v, _ := sd.QSlice("q", 2, -1); !reflect.DeepEqual(v, []string{"3", "4", "5"}) {
+		t.Error("QSlice got", v)
+	}
+	if n, _ := sd.QTrimFront("q", 2); n != 2 {
+		t.Error("QTrimFront got", n)
+	}
+	if n, _ := sd.QTrimBack("q", 1); n != 1 {
+		t.Error("QTrimBack got", n)
+	}
+	if v, _ := sd.QSlice("q", 0, -1); !reflect.DeepEqual(v, []string{"3", "4"}) {
+		t.Error("queue after trims got", v)
+	}
+	sd.QClear("q")
+	if n, _ := sd.QSize("q"); n != 0 {
+		t.Error("QClear should empty the queue", n)
+	}
+}
+
+func TestSSDBHash(t *testing.T) {
+	sd, fs := newFakeSSDB(t)
+	defer fs.Close()
+
+	if _, err := sd.HGet("h", "missing"); err != ErrNotFound {
+		t.Error("HGet of a missing field should return ErrNotFound", err)
+	}
+	sd.HSet("h", "a", "1")
+	sd.HSet("h", "b", "2")
+	if v, err := sd.HGet("h", "a"); v != "1" || err != nil {
+		t.Error("HGet got", v, err)
+	}
+	if v, err := sd.HGetAll("h"); !reflect.DeepEqual(v, map[string]interface{}{"a": "1", "b": "2"}) || err != nil {
+		t.Error("HGetAll got", v, err)
+	}
+	if v, _ := sd.MultiHGet("h", "b", "missing"); !reflect.DeepEqual(v, map[string]interface{}{"b": "2"}) {
+		t.Error("MultiHGet got", v)
+	}
+	if n, err := sd.HSize("h"); n != 2 || err != nil {
+		t.Error("HSize got", n, err)
+	}
+	if ok, _ := sd.HExists("h", "a"); !ok {
+		t.Error("a should exist")
+	}
+	if v, _ := sd.HIncr("c", "n", 3); v != int64(3) {
+		t.Error("HIncr got", v)
+	}
+	sd.MultiHSet("g", map[string]interface{}{"a": "1", "b": "2"})
+	sd.HDel("g", "a")
+	sd.MultiHDel("g", "b")
+	if n, _ := sd.HSize("g"); n != 0 {
+		t.Error("HDel and MultiHDel should empty the hashmap", n)
+	}
+	var got []string
+	it := sd.HScanIterator("h", "", "", 1)
+	for it.Next() {
+		got = append(got, it.Key()+"="+it.Value())
+	}
+	if !reflect.DeepEqual(got, []string{"a=1", "b=2"}) {
+		t.Error("HScanIterator got", got)
+	}
+}
@@ -0,0 +1,71 @@
+package ssdb
+
+import (
+	"context"
+	"time"
+)
+
+// tagKeyPrefix starts the names of the hashmaps listing the keys of a tag.
+const tagKeyPrefix = "__tag:"
+
+// PutWithTags puts value like Put and records key in the hashmap of every tag.
+// ssdb hashmaps do not expire, the keys of a tag are kept until it is invalidated.
+func (sd *SSDB) PutWithTags(ctx context.Context, key string, value interface{}, timeout time.Duration, tags ...string) error {
+	if err := sd.Put(ctx, key, value, timeout); err != nil {
+		return err
+	}
+	c, err := sd.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, tag := range tags {
+		if _, err = reply(c.Do("hset", tagKeyPrefix+tag, key, "")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateTags deletes the keys having one of tags, in batches.
+func (sd *SSDB) InvalidateTags(ctx context.Context, tags ...string) error {
+	c, err := sd.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, tag := range tags {
+		name := tagKeyPrefix + tag
+		for {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			keys, err := reply(c.Do("hkeys", name, "", "", 1000))
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				break
+			}
+			if _, err = reply(c.Do(flatten("multi_del", keys)...)); err != nil {
+				return err
+			}
+			if _, err = reply(c.Do(flatten("multi_hdel", name, keys)...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeletePrefix deletes the keys starting with prefix, scanning only their range.
+func (sd *SSDB) DeletePrefix(ctx context.Context, prefix string) error {
+	if prefix == "" {
+		return sd.ClearAll(ctx)
+	}
+	// scan excludes its start, so the key equal to prefix is deleted apart.
+	if err := sd.Delete(ctx, prefix); err != nil {
+		return err
+	}
+	return sd.deleteRange(ctx, prefix, prefix+"\xff")
+}
@@ -1,6 +1,9 @@
 package ssdb
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
 func (sd *SSDB) getString(v interface{}) string {
 	switch result := v.(type) {
@@ -15,3 +18,51 @@ func (sd *SSDB) getString(v interface{}) string {
 	}
 	return ""
 }
+
+// callInt runs a command replying a single integer.
+func (sd *SSDB) callInt(args ...interface{}) (int64, error) {
+	resp, err := sd.call(args...)
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(resp)
+}
+
+// callBool runs a command replying 1 for true.
+func (sd *SSDB) callBool(args ...interface{}) (bool, error) {
+	n, err := sd.callInt(args...)
+	return n == 1, err
+}
+
+// pairs returns the key-value pairs of a reply, nil if there are none.
+func pairs(resp []string) map[string]interface{} {
+	if len(resp) < 2 {
+		return nil
+	}
+	value := make(map[string]interface{}, len(resp)/2)
+	for i := 0; i+1 < len(resp); i += 2 {
+		value[resp[i]] = resp[i+1]
+	}
+	return value
+}
+
+// scores returns the key-score pairs of a reply.
+func scores(resp []string) (map[string]int64, error) {
+	value := make(map[string]int64, len(resp)/2)
+	for i := 0; i+1 < len(resp); i += 2 {
+		score, err := strconv.ParseInt(resp[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		value[resp[i]] = score
+	}
+	return value, nil
+}
+
+// parseInt parses the single integer of a reply.
+func parseInt(resp []string) (int64, error) {
+	if len(resp) != 1 {
+		return 0, fmt.Errorf("ssdb: bad response %v", resp)
+	}
+	return strconv.ParseInt(resp[0], 10, 64)
+}
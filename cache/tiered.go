@@ -0,0 +1,393 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	// DefaultInvalidateChannel is the redis pub/sub channel of TieredCache invalidations.
+	DefaultInvalidateChannel = "cache:invalidate"
+	// DefaultL1TTL bounds how long a value read from redis is kept in memory.
+	DefaultL1TTL = 60 // 1 minute
+)
+
+// tieredStripes is the number of generation counters the keys are spread on.
+const tieredStripes = 256
+
+// TieredCache is a two-tier cache adapter.
+// a MemoryCache (L1) is put in front of a RedisCache (L2),
+// writes go through to both tiers and are published on a redis channel
+// so the other instances drop the key from their L1.
+// L1 keeps the values as L2 returns them, []byte with redis, so a Get
+// returns the same type whichever tier it hits.
+type TieredCache struct {
+	l1      *MemoryCache
+	l2      Cache
+	l1TTL   time.Duration
+	channel string
+	id      string // identifies this instance in invalidation messages
+
+	// the generations are moved on by every invalidation, a value read
+	// from L2 is only kept in L1 when its generation did not move meanwhile.
+	genMu sync.Mutex
+	gens  [tieredStripes]uint64
+	epoch uint64 // moved on by ClearAll
+
+	mu     sync.Mutex
+	psc    *redis.PubSubConn
+	closed bool
+}
+
+// tieredConfig is the json config accepted by TieredCache.StartAndGC.
+type tieredConfig struct {
+	L1      json.RawMessage `json:"l1"`
+	L2      json.RawMessage `json:"l2"`
+	L1TTL   *int            `json:"l1ttl"`
+	Channel string          `json:"channel"`
+}
+
+// invalidation is the message published after a write.
+type invalidation struct {
+	ID  string `json:"id"`
+	Key string `json:"key,omitempty"`
+	All bool   `json:"all,omitempty"`
+}
+
+// NewTieredCache returns a new TieredCache.
+func NewTieredCache() *TieredCache {
+	return &TieredCache{}
+}
+
+// Get cache from L1, or from L2 and keep it in L1.
+// if non-existed, return ErrCacheMiss.
+func (tc *TieredCache) Get(ctx context.Context, key string) (interface{}, error) {
+	if v, err := tc.l1.Get(ctx, key); err == nil {
+		return v, nil
+	}
+	gen := tc.generation(key)
+	v, err := tc.l2.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	tc.fill(ctx, key, v, gen)
+	return v, nil
+}
+
+// GetMulti gets caches from L1, the missing ones from L2.
+// missing keys are nil in the result.
+func (tc *TieredCache) GetMulti(ctx context.Context, keys []string) ([]interface{}, error) {
+	rc := make([]interface{}, len(keys))
+	var missKeys []string
+	var missIdx []int
+	for i, key := range keys {
+		v, err := tc.l1.Get(ctx, key)
+		if err == nil {
+			rc[i] = v
+			continue
+		}
+		missKeys = append(missKeys, key)
+		missIdx = append(missIdx, i)
+	}
+	if len(missKeys) == 0 {
+		return rc, nil
+	}
+	gens := make([]uint64, len(missKeys))
+	for j, key := range missKeys {
+		gens[j] = tc.generation(key)
+	}
+	values, err := tc.l2.GetMulti(ctx, missKeys)
+	if err != nil {
+		return nil, err
+	}
+	for j, v := range values {
+		if v == nil {
+			continue
+		}
+		rc[missIdx[j]] = v
+		tc.fill(ctx, missKeys[j], v, gens[j])
+	}
+	return rc, nil
+}
+
+// Put cache to both tiers and invalidate the key on other instances.
+func (tc *TieredCache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	if err := tc.l2.Put(ctx, key, val, timeout); err != nil {
+		return err
+	}
+	l1TTL := tc.l1TTL
+	if timeout > 0 && (l1TTL == 0 || timeout < l1TTL) {
+		l1TTL = timeout
+	}
+	tc.genMu.Lock()
+	tc.gens[tieredStripe(key)]++
+	tc.l1.Put(ctx, key, tc.stored(val), l1TTL)
+	tc.genMu.Unlock()
+	return tc.publish(ctx, invalidation{Key: key})
+}
+
+// Delete cache in both tiers.
+func (tc *TieredCache) Delete(ctx context.Context, key string) error {
+	if err := tc.l2.Delete(ctx, key); err != nil {
+		return err
+	}
+	tc.invalidate(ctx, key)
+	return tc.publish(ctx, invalidation{Key: key})
+}
+
+// Incr increase counter in L2, L1 drops the key.
+func (tc *TieredCache) Incr(ctx context.Context, key string) error {
+	if err := tc.l2.Incr(ctx, key); err != nil {
+		return err
+	}
+	tc.invalidate(ctx, key)
+	return tc.publish(ctx, invalidation{Key: key})
+}
+
+// Decr decrease counter in L2, L1 drops the key.
+func (tc *TieredCache) Decr(ctx context.Context, key string) error {
+	if err := tc.l2.Decr(ctx, key); err != nil {
+		return err
+	}
+	tc.invalidate(ctx, key)
+	return tc.publish(ctx, invalidation{Key: key})
+}
+
+// IsExist check cache's existence in L1, then in L2.
+func (tc *TieredCache) IsExist(ctx context.Context, key string) (bool, error) {
+	if ok, _ := tc.l1.IsExist(ctx, key); ok {
+		return true, nil
+	}
+	return tc.l2.IsExist(ctx, key)
+}
+
+// ClearAll clean all cache in both tiers and on other instances.
+func (tc *TieredCache) ClearAll(ctx context.Context) error {
+	if err := tc.l2.ClearAll(ctx); err != nil {
+		return err
+	}
+	tc.invalidateAll(ctx)
+	return tc.publish(ctx, invalidation{All: true})
+}
+
+// StartAndGC start tiered cache adapter.
+// config is like {"l1":{"interval":60,"maxentries":10000},"l2":{"conn":"127.0.0.1:6379","key":"app"},"l1ttl":60,"channel":"cache:invalidate"}
+// l1 is the MemoryCache config, l2 the RedisCache config,
+// l1ttl bounds in seconds how long L1 keeps a value, 0 means until invalidated.
+func (tc *TieredCache) StartAndGC(config string) error {
+	var cf tieredConfig
+	if err := json.Unmarshal([]byte(config), &cf); err != nil {
+		return err
+	}
+	if len(cf.L2) == 0 {
+		return errors.New("config has no l2 key")
+	}
+	l1 := NewMemoryCache()
+	if err := l1.StartAndGC(string(cf.L1)); err != nil {
+		return err
+	}
+	l2 := NewRedisCache()
+	if err := l2.StartAndGC(string(cf.L2)); err != nil {
+		return err
+	}
+	tc.l1 = l1
+	tc.l2 = l2
+	tc.l1TTL = time.Duration(DefaultL1TTL) * time.Second
+	if cf.L1TTL != nil {
+		tc.l1TTL = time.Duration(*cf.L1TTL) * time.Second
+	}
+	tc.channel = cf.Channel
+	if tc.channel == "" {
+		tc.channel = DefaultInvalidateChannel
+	}
+	tc.id = newInstanceID()
+	go tc.subscribe(l2)
+	return nil
+}
+
+// Close stops listening for invalidations.
+// the subscription ends with the reply to the unsubscribe.
+func (tc *TieredCache) Close() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.closed = true
+	if tc.psc != nil {
+		return tc.psc.Unsubscribe()
+	}
+	return nil
+}
+
+// publish sends an invalidation to the other instances.
+func (tc *TieredCache) publish(ctx context.Context, msg invalidation) error {
+	rc, ok := tc.l2.(*RedisCache)
+	if !ok {
+		return nil
+	}
+	msg.ID = tc.id
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c, err := rc.p.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = doContext(ctx, c, "PUBLISH", tc.channel, data)
+	return err
+}
+
+// subscribe receives invalidations until Close is called,
+// it reconnects after errors and then clears L1 as messages may have been lost.
+// the commands are sent under mu, Close unsubscribing on the same connection.
+func (tc *TieredCache) subscribe(rc *RedisCache) {
+	for retry := 0; ; retry++ {
+		psc := &redis.PubSubConn{Conn: rc.p.Get()}
+		tc.mu.Lock()
+		if tc.closed {
+			tc.mu.Unlock()
+			psc.Close()
+			return
+		}
+		tc.psc = psc
+		err := psc.Subscribe(tc.channel)
+		tc.mu.Unlock()
+
+		if err == nil {
+			if retry > 0 {
+				tc.invalidateAll(context.Background())
+			}
+		receive:
+			for {
+				switch v := psc.Receive().(type) {
+				case redis.Message:
+					tc.handle(v.Data)
+				case redis.Subscription:
+					if v.Count == 0 {
+						break receive
+					}
+				case error:
+					break receive
+				}
+			}
+		}
+		tc.mu.Lock()
+		tc.psc = nil
+		psc.Close()
+		closed := tc.closed
+		tc.mu.Unlock()
+		if closed {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// handle applies an invalidation published by another instance to L1.
+func (tc *TieredCache) handle(data []byte) {
+	var msg invalidation
+	if err := json.Unmarshal(data, &msg); err != nil || msg.ID == tc.id {
+		return
+	}
+	ctx := context.Background()
+	if msg.All {
+		tc.invalidateAll(ctx)
+		return
+	}
+	tc.invalidate(ctx, msg.Key)
+}
+
+// tieredStripe returns the generation counter of key.
+func tieredStripe(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % tieredStripes)
+}
+
+// generation returns the generation of key, read before L2.
+func (tc *TieredCache) generation(key string) uint64 {
+	tc.genMu.Lock()
+	defer tc.genMu.Unlock()
+	return tc.gens[tieredStripe(key)] + tc.epoch
+}
+
+// fill keeps v read from L2 in L1, unless key was invalidated since gen was read.
+func (tc *TieredCache) fill(ctx context.Context, key string, v interface{}, gen uint64) {
+	tc.genMu.Lock()
+	defer tc.genMu.Unlock()
+	if tc.gens[tieredStripe(key)]+tc.epoch == gen {
+		tc.l1.Put(ctx, key, v, tc.l1TTL)
+	}
+}
+
+// invalidate drops key from L1.
+func (tc *TieredCache) invalidate(ctx context.Context, key string) {
+	tc.genMu.Lock()
+	defer tc.genMu.Unlock()
+	tc.gens[tieredStripe(key)]++
+	tc.l1.Delete(ctx, key)
+}
+
+// invalidateAll clears L1.
+func (tc *TieredCache) invalidateAll(ctx context.Context) {
+	tc.genMu.Lock()
+	defer tc.genMu.Unlock()
+	tc.epoch++
+	tc.l1.ClearAll(ctx)
+}
+
+// stored returns val as L2 returns it, so both tiers return the same type.
+func (tc *TieredCache) stored(val interface{}) interface{} {
+	if _, ok := tc.l2.(*RedisCache); !ok {
+		return val
+	}
+	return redisBytes(val)
+}
+
+// redisBytes encodes val as redigo sends it, and redis returns it.
+func redisBytes(val interface{}) []byte {
+	switch v := val.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return append([]byte(nil), v...)
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(nil, v, 10)
+	case float64:
+		return strconv.AppendFloat(nil, v, 'g', -1, 64)
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	case nil:
+		return []byte{}
+	case redis.Argument:
+		return redisBytes(v.RedisArg())
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// newInstanceID returns a random id for this process.
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func init() {
+	Register("tiered", func() Cache { return NewTieredCache() })
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestTieredCache() *TieredCache {
+	return &TieredCache{
+		l1:    NewMemoryCache(),
+		l2:    NewMemoryCache(),
+		l1TTL: time.Minute,
+		id:    newInstanceID(),
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	tc := newTestTieredCache()
+	ctx := context.Background()
+
+	if err := tc.Put(ctx, "astaxie", "author", time.Minute); err != nil {
+		t.Error("set Error", err)
+	}
+	if v, _ := tc.l2.Get(ctx, "astaxie"); v != "author" {
+		t.Error("put should write through to l2")
+	}
+	if v, _ := tc.l1.Get(ctx, "astaxie"); v != "author" {
+		t.Error("put should write to l1")
+	}
+
+	// a value only in l2 is copied to l1 on read.
+	tc.l2.Put(ctx, "astaxie1", "author1", time.Minute)
+	if v, err := tc.Get(ctx, "astaxie1"); err != nil || v != "author1" {
+		t.Error("get err", err)
+	}
+	if ok, _ := tc.l1.IsExist(ctx, "astaxie1"); !ok {
+		t.Error("get should fill l1")
+	}
+
+	tc.l2.Put(ctx, "astaxie2", "author2", time.Minute)
+	vv, err := tc.GetMulti(ctx, []string{"astaxie", "astaxie2", "missing"})
+	if err != nil || vv[0] != "author" || vv[1] != "author2" || vv[2] != nil {
+		t.Error("GetMulti ERROR", vv, err)
+	}
+
+	tc.Delete(ctx, "astaxie")
+	if _, err = tc.Get(ctx, "astaxie"); err != ErrCacheMiss {
+		t.Error("delete err", err)
+	}
+
+	tc.Put(ctx, "counter", 1, time.Minute)
+	tc.Incr(ctx, "counter")
+	if v, _ := tc.Get(ctx, "counter"); v.(int) != 2 {
+		t.Error("Incr should not leave a stale l1 value")
+	}
+
+	if err = tc.ClearAll(ctx); err != nil {
+		t.Error("clear all err", err)
+	}
+	if ok, _ := tc.IsExist(ctx, "astaxie1"); ok {
+		t.Error("clear all err")
+	}
+}
+
+func TestTieredCacheInvalidation(t *testing.T) {
+	tc := newTestTieredCache()
+	ctx := context.Background()
+	tc.l1.Put(ctx, "astaxie", "stale", 0)
+	tc.l1.Put(ctx, "astaxie1", "stale", 0)
+
+	own, _ := json.Marshal(invalidation{ID: tc.id, Key: "astaxie"})
+	tc.handle(own)
+	if ok, _ := tc.l1.IsExist(ctx, "astaxie"); !ok {
+		t.Error("own invalidation should be ignored")
+	}
+
+	other, _ := json.Marshal(invalidation{ID: "other", Key: "astaxie"})
+	tc.handle(other)
+	if ok, _ := tc.l1.IsExist(ctx, "astaxie"); ok {
+		t.Error("invalidation from another instance should drop the key")
+	}
+
+	// a value read from l2 before an invalidation is not kept in l1.
+	gen := tc.generation("astaxie")
+	tc.handle(other)
+	tc.fill(ctx, "astaxie", "stale", gen)
+	if ok, _ := tc.l1.IsExist(ctx, "astaxie"); ok {
+		t.Error("a refill should not overwrite a newer invalidation")
+	}
+	gen = tc.generation("astaxie")
+	tc.fill(ctx, "astaxie", "fresh", gen)
+	if v, _ := tc.l1.Get(ctx, "astaxie"); v != "fresh" {
+		t.Error("refill err", v)
+	}
+
+	all, _ := json.Marshal(invalidation{ID: "other", All: true})
+	tc.handle(all)
+	if ok, _ := tc.l1.IsExist(ctx, "astaxie1"); ok {
+		t.Error("clear all invalidation should clear l1")
+	}
+}
+
+func TestTieredCacheRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	config := `{"l2":{"conn":"` + s.Addr() + `","key":"tiered"},"l1ttl":0}`
+	nodes := make([]Cache, 2)
+	for i := range nodes {
+		if nodes[i], err = NewCache("tiered", config); err != nil {
+			t.Fatal(err)
+		}
+		defer nodes[i].(*TieredCache).Close()
+	}
+	for deadline := time.Now().Add(time.Second); s.PubSubNumSub(DefaultInvalidateChannel)[DefaultInvalidateChannel] < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("nodes did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx := context.Background()
+	a, b := nodes[0], nodes[1]
+
+	// both tiers return the value as redis does.
+	if err = a.Put(ctx, "astaxie", "author", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range nodes {
+		if v, err := c.Get(ctx, "astaxie"); err != nil || string(v.([]byte)) != "author" {
+			t.Fatal("get err", v, err)
+		}
+	}
+
+	// a put on a drops the key from the l1 of b.
+	if err = a.Put(ctx, "astaxie", "author1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; {
+		v, _ := b.Get(ctx, "astaxie")
+		if string(v.([]byte)) == "author1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("b kept a stale value", string(v.([]byte)))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err = b.Delete(ctx, "astaxie"); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; {
+		if _, err = a.Get(ctx, "astaxie"); err == ErrCacheMiss {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("a kept a deleted value", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
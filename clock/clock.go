@@ -0,0 +1,120 @@
+// Package clock is the time source of the cache, session and logs packages,
+// replaced by a Fake in the tests of expiry, gc and rotation.
+//
+// Usage:
+//
+//	c := clock.NewFake(time.Now())
+//	bm := cache.NewMemoryCache()
+//	bm.SetClock(c)
+//	bm.Put(ctx, "astaxie", 1, time.Minute)
+//	c.Advance(2 * time.Minute) // astaxie is expired
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After waits for d to elapse and sends the current time on the channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the Clock of the system time.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Or returns c, or Real when c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type waiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// Fake is a Clock which only moves with Advance.
+type Fake struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []waiter
+	hooks   []func(d time.Duration)
+}
+
+// NewFake returns a Fake set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time of the clock.
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// After sends the time on the channel once the clock is advanced by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+	f.waiters = append(f.waiters, waiter{deadline: f.now.Add(d), c: c})
+	return c
+}
+
+// Advance moves the clock forward by d, fires the elapsed After channels
+// and calls the functions added with OnAdvance.
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	f.now = f.now.Add(d)
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(f.now) {
+			waiters = append(waiters, w)
+		} else {
+			w.c <- f.now
+		}
+	}
+	f.waiters = waiters
+	hooks := f.hooks
+	f.lock.Unlock()
+	for _, fn := range hooks {
+		fn(d)
+	}
+}
+
+// OnAdvance calls fn each time the clock is moved forward,
+// to move the time of a server such as miniredis with it.
+func (f *Fake) OnAdvance(fn func(d time.Duration)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.hooks = append(f.hooks, fn)
+}
+
+// Waiters returns the number of After channels waiting for the clock,
+// for the tests to know a goroutine is waiting before calling Advance.
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
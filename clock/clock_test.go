@@ -0,0 +1,40 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	c := f.After(time.Minute)
+	var advanced time.Duration
+	f.OnAdvance(func(d time.Duration) { advanced += d })
+
+	f.Advance(30 * time.Second)
+	select {
+	case <-c:
+		t.Fatal("fired before the deadline")
+	default:
+	}
+	if f.Waiters() != 1 {
+		t.Fatal("waiters error", f.Waiters())
+	}
+
+	f.Advance(30 * time.Second)
+	select {
+	case now := <-c:
+		if !now.Equal(start.Add(time.Minute)) {
+			t.Fatal("fired time error", now)
+		}
+	default:
+		t.Fatal("not fired at the deadline")
+	}
+	if f.Waiters() != 0 || advanced != time.Minute || !f.Now().Equal(start.Add(time.Minute)) {
+		t.Fatal("advance error", f.Waiters(), advanced, f.Now())
+	}
+	if Or(nil) != Real || Or(f) != f {
+		t.Fatal("or error")
+	}
+}
@@ -0,0 +1,175 @@
+// Package sqlitedb opens the sqlite databases of the cache and session
+// sqlite adapters with the pure-Go driver modernc.org/sqlite, known to the
+// orm as a sqlite driver, and commits their writes in batches.
+package sqlitedb
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+
+	"libs/orm"
+
+	// import the pure-Go sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+// DriverName is the database/sql name of the pure-Go driver.
+const DriverName = "sqlite"
+
+// ormPrefix starts the sources naming a database registered with the orm.
+const ormPrefix = "orm:"
+
+var (
+	// MaxBatch is the number of writes committed in one transaction.
+	MaxBatch = 128
+
+	// ErrClosed is returned by the writes queued after Close.
+	ErrClosed = errors.New("sqlite: database is closed")
+)
+
+// write is a function queued to run in the transaction of a batch.
+type write struct {
+	fn  func(tx *sql.Tx) error
+	err chan error
+}
+
+// DB is a sqlite database whose writes are queued and committed together
+// in one transaction, sqlite allowing one writer at a time.
+type DB struct {
+	*sql.DB
+	owned  bool
+	lock   sync.RWMutex
+	closed bool
+	writes chan write
+	done   chan struct{}
+}
+
+// Open opens the database file at source in WAL mode, created if missing.
+// a source like "orm:default" uses the sqlite database registered with
+// orm.RegisterDataBase under the alias default, which Close leaves open.
+func Open(source string) (*DB, error) {
+	var (
+		db  *sql.DB
+		err error
+	)
+	owned := !strings.HasPrefix(source, ormPrefix)
+	if owned {
+		db, err = sql.Open(DriverName, "file:"+source+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+		if err == nil {
+			if err = db.Ping(); err != nil {
+				db.Close()
+			}
+		}
+	} else {
+		db, err = orm.GetDB(strings.TrimPrefix(source, ormPrefix))
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &DB{DB: db, owned: owned, writes: make(chan write, MaxBatch), done: make(chan struct{})}
+	go d.loop()
+	return d, nil
+}
+
+// Write queues the statement and returns the number of rows it changed
+// once its batch is committed.
+func (d *DB) Write(query string, args ...interface{}) (int64, error) {
+	var n int64
+	err := d.WriteTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// WriteTx queues fn and returns its error once its batch is committed.
+// fn runs in a savepoint, rolled back alone when fn fails, so it does not
+// fail the other writes of the batch.
+func (d *DB) WriteTx(fn func(tx *sql.Tx) error) error {
+	w := write{fn: fn, err: make(chan error, 1)}
+	d.lock.RLock()
+	if d.closed {
+		d.lock.RUnlock()
+		return ErrClosed
+	}
+	d.writes <- w
+	d.lock.RUnlock()
+	return <-w.err
+}
+
+// Close commits the queued writes and closes the database it opened.
+func (d *DB) Close() error {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.writes)
+	d.lock.Unlock()
+	<-d.done
+	if !d.owned {
+		return nil
+	}
+	return d.DB.Close()
+}
+
+func (d *DB) loop() {
+	defer close(d.done)
+	for w := range d.writes {
+		batch := []write{w}
+	drain:
+		for len(batch) < MaxBatch {
+			select {
+			case w, ok := <-d.writes:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, w)
+			default:
+				break drain
+			}
+		}
+		d.commit(batch)
+	}
+}
+
+// commit runs the batch in one transaction.
+func (d *DB) commit(batch []write) {
+	errs := make([]error, len(batch))
+	tx, err := d.DB.Begin()
+	if err == nil {
+		for i, w := range batch {
+			if _, err = tx.Exec("SAVEPOINT write"); err != nil {
+				break
+			}
+			if errs[i] = w.fn(tx); errs[i] != nil {
+				_, err = tx.Exec("ROLLBACK TO write")
+			}
+			if err == nil {
+				_, err = tx.Exec("RELEASE write")
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+	for i, w := range batch {
+		if err != nil {
+			w.err <- err
+		} else {
+			w.err <- errs[i]
+		}
+	}
+}
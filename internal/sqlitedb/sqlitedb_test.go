@@ -0,0 +1,100 @@
+package sqlitedb
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"libs/orm"
+)
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlitedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("CREATE TABLE t (k TEXT PRIMARY KEY, v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent writes, one of them failing.
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = db.Write("INSERT INTO t (k, v) VALUES (?, ?)", strconv.Itoa(i%19), i)
+		}(i)
+	}
+	wg.Wait()
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM t").Scan(&n)
+	if failed != 1 || n != 19 {
+		t.Fatal("a failed write should only roll back itself", failed, n)
+	}
+
+	// a failed transaction is rolled back.
+	errFail := errors.New("fail")
+	err = db.WriteTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM t"); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if err != errFail {
+		t.Fatal("WriteTx error", err)
+	}
+	if n, err := db.Write("UPDATE t SET v = v + 1"); err != nil || n != 19 {
+		t.Fatal("rolled back rows error", n, err)
+	}
+
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Write("DELETE FROM t"); err != ErrClosed {
+		t.Fatal("write after close", err)
+	}
+}
+
+func TestOpenOrm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlitedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = orm.RegisterDataBase("sqlitedb_test", DriverName, filepath.Join(dir, "orm.db")); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open("orm:sqlitedb_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Write("CREATE TABLE t (k TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	ormdb, _ := orm.GetDB("sqlitedb_test")
+	if err = ormdb.Ping(); err != nil {
+		t.Fatal("the orm database should stay open", err)
+	}
+	if _, err = Open("orm:missing"); err == nil {
+		t.Fatal("open of a missing alias")
+	}
+}
@@ -0,0 +1,536 @@
+// Package ssdbtest runs an in-memory server speaking the ssdb protocol
+// for the tests of the ssdb cache adapter and of the ssdb locks.
+package ssdbtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"libs/clock"
+)
+
+// Server speaks the ssdb protocol and keeps its data in memory.
+// it implements the commands used by the adapters with the ssdb semantics.
+type Server struct {
+	ln    net.Listener
+	clock *clock.Fake
+
+	mu      sync.Mutex
+	kv      map[string]string
+	expires map[string]time.Time
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]int64
+	queues  map[string][]string
+}
+
+// member is a member of a zset and its score.
+type member struct {
+	Key   string
+	Score int64
+}
+
+// NewServer starts a Server on a local port, close it with Close.
+// the keys expire with the time of c, or the system time if c is nil.
+func NewServer(c *clock.Fake) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	fs := &Server{
+		ln:      ln,
+		clock:   c,
+		kv:      make(map[string]string),
+		expires: make(map[string]time.Time),
+		hashes:  make(map[string]map[string]string),
+		zsets:   make(map[string]map[string]int64),
+		queues:  make(map[string][]string),
+	}
+	go fs.serve()
+	return fs, nil
+}
+
+// Config returns the json config of the ssdb adapter connecting to the server.
+func (fs *Server) Config() string {
+	port := fs.ln.Addr().(*net.TCPAddr).Port
+	return fmt.Sprintf(`{"host":"127.0.0.1","port":%d,"min_pool_size":1,"max_pool_size":5}`, port)
+}
+
+// Close stops the server.
+func (fs *Server) Close() error {
+	return fs.ln.Close()
+}
+
+func (fs *Server) now() time.Time {
+	if fs.clock != nil {
+		return fs.clock.Now()
+	}
+	return time.Now()
+}
+
+func (fs *Server) serve() {
+	for {
+		conn, err := fs.ln.Accept()
+		if err != nil {
+			return
+		}
+		go fs.handle(conn)
+	}
+}
+
+func (fs *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		req, err := readRequest(r)
+		if err != nil {
+			return
+		}
+		fs.mu.Lock()
+		resp := fs.exec(req)
+		fs.mu.Unlock()
+		for _, block := range resp {
+			fmt.Fprintf(w, "%d\n%s\n", len(block), block)
+		}
+		w.WriteString("\n")
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// readRequest reads the blocks of a request up to the empty line.
+func readRequest(r *bufio.Reader) ([]string, error) {
+	var req []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = line[:len(line)-1]
+		if line == "" || line == "\r" {
+			if len(req) == 0 {
+				continue
+			}
+			return req, nil
+		}
+		size, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		block := make([]byte, size+1)
+		if _, err = io.ReadFull(r, block); err != nil {
+			return nil, err
+		}
+		req = append(req, string(block[:size]))
+	}
+}
+
+func ok(data ...string) []string {
+	return append([]string{"ok"}, data...)
+}
+
+func okInt(n int64) []string {
+	return ok(strconv.FormatInt(n, 10))
+}
+
+func atoi(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// inRange reports whether key is in (start, end], an empty end is unbounded.
+func inRange(key, start, end string) bool {
+	return key > start && (end == "" || key <= end)
+}
+
+func sortedKeys(m map[string]string, start, end string, limit int64) []string {
+	var keys []string
+	for k := range m {
+		if inRange(k, start, end) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if int64(len(keys)) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+func (fs *Server) expire(key string) {
+	if at, ok := fs.expires[key]; ok && !fs.now().Before(at) {
+		delete(fs.kv, key)
+		delete(fs.expires, key)
+	}
+}
+
+func (fs *Server) exec(req []string) []string {
+	args := req[1:]
+	for key := range fs.expires {
+		fs.expire(key)
+	}
+	switch req[0] {
+	case "version":
+		return ok("fake")
+	case "get":
+		if v, exist := fs.kv[args[0]]; exist {
+			return ok(v)
+		}
+		return []string{"not_found"}
+	case "setnx":
+		if _, exist := fs.kv[args[0]]; exist {
+			return ok("0")
+		}
+		fs.kv[args[0]] = args[1]
+		return ok("1")
+	case "set":
+		fs.kv[args[0]] = args[1]
+		delete(fs.expires, args[0])
+		return ok("1")
+	case "setx":
+		fs.kv[args[0]] = args[1]
+		fs.expires[args[0]] = fs.now().Add(time.Duration(atoi(args[2])) * time.Second)
+		return ok("1")
+	case "del":
+		delete(fs.kv, args[0])
+		delete(fs.expires, args[0])
+		return ok("1")
+	case "multi_del":
+		for _, key := range args {
+			delete(fs.kv, key)
+			delete(fs.expires, key)
+		}
+		return okInt(int64(len(args)))
+	case "multi_get":
+		resp := ok()
+		for _, key := range args {
+			if v, exist := fs.kv[key]; exist {
+				resp = append(resp, key, v)
+			}
+		}
+		return resp
+	case "exists":
+		if _, exist := fs.kv[args[0]]; exist {
+			return ok("1")
+		}
+		return ok("0")
+	case "incr":
+		n := atoi(fs.kv[args[0]]) + atoi(args[1])
+		fs.kv[args[0]] = strconv.FormatInt(n, 10)
+		return okInt(n)
+	case "ttl":
+		at, exist := fs.expires[args[0]]
+		if !exist {
+			return okInt(-1)
+		}
+		return okInt(int64(at.Sub(fs.now()).Seconds() + 0.5))
+	case "expire":
+		if _, exist := fs.kv[args[0]]; !exist {
+			return ok("0")
+		}
+		fs.expires[args[0]] = fs.now().Add(time.Duration(atoi(args[1])) * time.Second)
+		return ok("1")
+	case "keys":
+		return ok(sortedKeys(fs.kv, args[0], args[1], atoi(args[2]))...)
+	case "scan":
+		resp := ok()
+		for _, k := range sortedKeys(fs.kv, args[0], args[1], atoi(args[2])) {
+			resp = append(resp, k, fs.kv[k])
+		}
+		return resp
+	case "hset":
+		h, exist := fs.hashes[args[0]]
+		if !exist {
+			h = make(map[string]string)
+			fs.hashes[args[0]] = h
+		}
+		h[args[1]] = args[2]
+		return ok("1")
+	case "multi_hset":
+		h, exist := fs.hashes[args[0]]
+		if !exist {
+			h = make(map[string]string)
+			fs.hashes[args[0]] = h
+		}
+		for i := 1; i+1 < len(args); i += 2 {
+			h[args[i]] = args[i+1]
+		}
+		return okInt(int64((len(args) - 1) / 2))
+	case "multi_hget":
+		resp := ok()
+		for _, k := range args[1:] {
+			if v, exist := fs.hashes[args[0]][k]; exist {
+				resp = append(resp, k, v)
+			}
+		}
+		return resp
+	case "hgetall":
+		resp := ok()
+		for _, k := range sortedKeys(fs.hashes[args[0]], "", "", int64(len(fs.hashes[args[0]]))) {
+			resp = append(resp, k, fs.hashes[args[0]][k])
+		}
+		return resp
+	case "hexists":
+		if _, exist := fs.hashes[args[0]][args[1]]; exist {
+			return ok("1")
+		}
+		return ok("0")
+	case "hdel":
+		if _, exist := fs.hashes[args[0]][args[1]]; !exist {
+			return ok("0")
+		}
+		delete(fs.hashes[args[0]], args[1])
+		return ok("1")
+	case "hclear":
+		n := len(fs.hashes[args[0]])
+		delete(fs.hashes, args[0])
+		return okInt(int64(n))
+	case "hsize":
+		return okInt(int64(len(fs.hashes[args[0]])))
+	case "hincr":
+		h, exist := fs.hashes[args[0]]
+		if !exist {
+			h = make(map[string]string)
+			fs.hashes[args[0]] = h
+		}
+		n := atoi(h[args[1]]) + atoi(args[2])
+		h[args[1]] = strconv.FormatInt(n, 10)
+		return okInt(n)
+	case "hget":
+		if v, exist := fs.hashes[args[0]][args[1]]; exist {
+			return ok(v)
+		}
+		return []string{"not_found"}
+	case "multi_hdel":
+		for _, key := range args[1:] {
+			delete(fs.hashes[args[0]], key)
+		}
+		return okInt(int64(len(args) - 1))
+	case "hkeys":
+		return ok(sortedKeys(fs.hashes[args[0]], args[1], args[2], atoi(args[3]))...)
+	case "hscan":
+		resp := ok()
+		for _, k := range sortedKeys(fs.hashes[args[0]], args[1], args[2], atoi(args[3])) {
+			resp = append(resp, k, fs.hashes[args[0]][k])
+		}
+		return resp
+	case "zset":
+		z, exist := fs.zsets[args[0]]
+		if !exist {
+			z = make(map[string]int64)
+			fs.zsets[args[0]] = z
+		}
+		z[args[1]] = atoi(args[2])
+		return ok("1")
+	case "multi_zset":
+		z, exist := fs.zsets[args[0]]
+		if !exist {
+			z = make(map[string]int64)
+			fs.zsets[args[0]] = z
+		}
+		for i := 1; i+1 < len(args); i += 2 {
+			z[args[i]] = atoi(args[i+1])
+		}
+		return okInt(int64((len(args) - 1) / 2))
+	case "multi_zget":
+		resp := ok()
+		for _, k := range args[1:] {
+			if v, exist := fs.zsets[args[0]][k]; exist {
+				resp = append(resp, k, strconv.FormatInt(v, 10))
+			}
+		}
+		return resp
+	case "zincr":
+		z, exist := fs.zsets[args[0]]
+		if !exist {
+			z = make(map[string]int64)
+			fs.zsets[args[0]] = z
+		}
+		z[args[1]] += atoi(args[2])
+		return okInt(z[args[1]])
+	case "zexists":
+		if _, exist := fs.zsets[args[0]][args[1]]; exist {
+			return ok("1")
+		}
+		return ok("0")
+	case "zdel":
+		if _, exist := fs.zsets[args[0]][args[1]]; !exist {
+			return ok("0")
+		}
+		delete(fs.zsets[args[0]], args[1])
+		return ok("1")
+	case "zsize":
+		return okInt(int64(len(fs.zsets[args[0]])))
+	case "zrange", "zrrange":
+		members := fs.zrange(args[0], "", "", "", req[0] == "zrrange")
+		offset, limit := int(atoi(args[1])), int(atoi(args[2]))
+		if offset > len(members) {
+			offset = len(members)
+		}
+		members = members[offset:]
+		if limit < len(members) {
+			members = members[:limit]
+		}
+		resp := ok()
+		for _, m := range members {
+			resp = append(resp, m.Key, strconv.FormatInt(m.Score, 10))
+		}
+		return resp
+	case "zget":
+		if v, exist := fs.zsets[args[0]][args[1]]; exist {
+			return okInt(v)
+		}
+		return []string{"not_found"}
+	case "zscan", "zrscan", "zkeys":
+		members := fs.zrange(args[0], args[1], args[2], args[3], req[0] == "zrscan")
+		if limit := atoi(args[4]); int64(len(members)) > limit {
+			members = members[:limit]
+		}
+		resp := ok()
+		for _, m := range members {
+			if req[0] == "zkeys" {
+				resp = append(resp, m.Key)
+			} else {
+				resp = append(resp, m.Key, strconv.FormatInt(m.Score, 10))
+			}
+		}
+		return resp
+	case "zcount", "zremrangebyscore":
+		members := fs.zrange(args[0], "", args[1], args[2], false)
+		if req[0] == "zremrangebyscore" {
+			for _, m := range members {
+				delete(fs.zsets[args[0]], m.Key)
+			}
+		}
+		return okInt(int64(len(members)))
+	case "qpush_back", "qpush_front":
+		for _, v := range args[1:] {
+			if req[0] == "qpush_back" {
+				fs.queues[args[0]] = append(fs.queues[args[0]], v)
+			} else {
+				fs.queues[args[0]] = append([]string{v}, fs.queues[args[0]]...)
+			}
+		}
+		return okInt(int64(len(fs.queues[args[0]])))
+	case "qpop_front", "qpop_back":
+		q := fs.queues[args[0]]
+		if len(q) == 0 {
+			return []string{"not_found"}
+		}
+		if req[0] == "qpop_front" {
+			fs.queues[args[0]] = q[1:]
+			return ok(q[0])
+		}
+		fs.queues[args[0]] = q[:len(q)-1]
+		return ok(q[len(q)-1])
+	case "qsize":
+		return okInt(int64(len(fs.queues[args[0]])))
+	case "qclear":
+		delete(fs.queues, args[0])
+		return ok("1")
+	case "qget":
+		q := fs.queues[args[0]]
+		i := int(atoi(args[1]))
+		if i < 0 {
+			i += len(q)
+		}
+		if i < 0 || i >= len(q) {
+			return []string{"not_found"}
+		}
+		return ok(q[i])
+	case "qrange":
+		offset, limit := int(atoi(args[1])), int(atoi(args[2]))
+		return ok(fs.qslice(args[0], offset, offset+limit-1)...)
+	case "qslice":
+		return ok(fs.qslice(args[0], int(atoi(args[1])), int(atoi(args[2])))...)
+	case "qtrim_front", "qtrim_back":
+		q := fs.queues[args[0]]
+		n := int(atoi(args[1]))
+		if n > len(q) {
+			n = len(q)
+		}
+		if req[0] == "qtrim_front" {
+			fs.queues[args[0]] = q[n:]
+		} else {
+			fs.queues[args[0]] = q[:len(q)-n]
+		}
+		return okInt(int64(n))
+	}
+	return []string{"client_error", "Unknown Command: " + req[0]}
+}
+
+// zrange returns the members of a zset after scoreStart and keyStart up to scoreEnd.
+func (fs *Server) zrange(name, keyStart, scoreStart, scoreEnd string, reverse bool) []member {
+	var members []member
+	for k, v := range fs.zsets[name] {
+		members = append(members, member{Key: k, Score: v})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Key < members[j].Key
+	})
+	if reverse {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	var res []member
+	for _, m := range members {
+		if scoreStart != "" {
+			start := atoi(scoreStart)
+			after := m.Score > start
+			if reverse {
+				after = m.Score < start
+			}
+			if m.Score == start && keyStart != "" {
+				after = m.Key > keyStart
+				if reverse {
+					after = m.Key < keyStart
+				}
+			} else if m.Score == start {
+				after = true
+			}
+			if !after {
+				continue
+			}
+		}
+		if scoreEnd != "" {
+			end := atoi(scoreEnd)
+			if (!reverse && m.Score > end) || (reverse && m.Score < end) {
+				continue
+			}
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+// qslice returns the elements of a queue in [begin, end], negative indexes count from the end.
+func (fs *Server) qslice(name string, begin, end int) []string {
+	q := fs.queues[name]
+	if begin < 0 {
+		begin += len(q)
+	}
+	if end < 0 {
+		end += len(q)
+	}
+	if begin < 0 {
+		begin = 0
+	}
+	if end >= len(q) {
+		end = len(q) - 1
+	}
+	if begin > end {
+		return nil
+	}
+	return q[begin : end+1]
+}
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"libs/clock"
 )
 
 // fileLogWriter implements LoggerInterface.
@@ -45,6 +47,9 @@ type fileLogWriter struct {
 	RotatePerm string `json:"rotateperm"`
 
 	fileNameOnly, suffix string // like "project.log", project is fileNameOnly and .log is suffix
+
+	clockMu sync.Mutex // guards clock, read by the rotation goroutines
+	clock   clock.Clock
 }
 
 // newFileWriter create a FileLogWriter returning as LoggerInterface.
@@ -101,6 +106,23 @@ func (w *fileLogWriter) startLogger() error {
 	return w.initFd()
 }
 
+// SetClock sets the clock of the daily rotation, the system time by default.
+func (w *fileLogWriter) SetClock(c clock.Clock) {
+	w.clockMu.Lock()
+	w.clock = c
+	w.clockMu.Unlock()
+}
+
+func (w *fileLogWriter) getClock() clock.Clock {
+	w.clockMu.Lock()
+	defer w.clockMu.Unlock()
+	return clock.Or(w.clock)
+}
+
+func (w *fileLogWriter) now() time.Time {
+	return w.getClock().Now()
+}
+
 func (w *fileLogWriter) needRotate(size int, day int) bool {
 	return (w.MaxLines > 0 && w.maxLinesCurLines >= w.MaxLines) ||
 		(w.MaxSize > 0 && w.maxSizeCurSize >= w.MaxSize) ||
@@ -162,7 +184,7 @@ func (w *fileLogWriter) initFd() error {
 		return fmt.Errorf("get stat err: %s", err)
 	}
 	w.maxSizeCurSize = int(fInfo.Size())
-	w.dailyOpenTime = time.Now()
+	w.dailyOpenTime = w.now()
 	w.dailyOpenDate = w.dailyOpenTime.Day()
 	w.maxLinesCurLines = 0
 	if w.Daily {
@@ -181,11 +203,11 @@ func (w *fileLogWriter) initFd() error {
 func (w *fileLogWriter) dailyRotate(openTime time.Time) {
 	y, m, d := openTime.Add(24 * time.Hour).Date()
 	nextDay := time.Date(y, m, d, 0, 0, 0, 0, openTime.Location())
-	tm := time.NewTimer(time.Duration(nextDay.UnixNano() - openTime.UnixNano() + 100))
-	<-tm.C
+	<-w.getClock().After(time.Duration(nextDay.UnixNano() - openTime.UnixNano() + 100))
 	w.Lock()
-	if w.needRotate(0, time.Now().Day()) {
-		if err := w.doRotate(time.Now()); err != nil {
+	now := w.now()
+	if w.needRotate(0, now.Day()) {
+		if err := w.doRotate(now); err != nil {
 			fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.Filename, err)
 		}
 	}
@@ -294,7 +316,7 @@ func (w *fileLogWriter) deleteOldLog() {
 			return
 		}
 
-		if !info.IsDir() && info.ModTime().Add(24*time.Hour*time.Duration(w.MaxDays)).Before(time.Now()) {
+		if !info.IsDir() && info.ModTime().Add(24*time.Hour*time.Duration(w.MaxDays)).Before(w.now()) {
 			if strings.HasPrefix(filepath.Base(path), filepath.Base(w.fileNameOnly)) &&
 				strings.HasSuffix(filepath.Base(path), w.suffix) {
 				os.Remove(path)
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"libs/clock"
 )
 
 func TestFilePerm(t *testing.T) {
@@ -169,6 +173,40 @@ func TestFileRotate_06(t *testing.T) { //test file mode
 	os.Remove(rotateName)
 	os.Remove("test3.log")
 }
+func TestFileClock(t *testing.T) {
+	log := NewLogger(10000)
+	log.SetClock(clock.NewFake(time.Date(2020, 1, 2, 15, 4, 5, 0, time.Local)))
+	log.SetLogger("file", `{"filename":"test_clock.log"}`)
+	log.Info("info")
+	log.Close()
+	defer os.Remove("test_clock.log")
+	b, err := ioutil.ReadFile("test_clock.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "2020/01/02 15:04:05") {
+		t.Fatal("message time is not the clock time", string(b))
+	}
+}
+
+func TestFileSetClockConcurrent(t *testing.T) {
+	log := NewLogger(10000)
+	log.SetLogger("file", `{"filename":"test_clock_race.log"}`)
+	defer os.Remove("test_clock_race.log")
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			log.Info("info")
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		log.SetClock(clock.NewFake(time.Now()))
+	}
+	<-done
+	log.Close()
+}
+
 func testFileRotate(t *testing.T, fn1, fn2 string) {
 	fw := &fileLogWriter{
 		Daily:      true,
@@ -202,12 +240,24 @@ func testFileDailyRotate(t *testing.T, fn1, fn2 string) {
 		Perm:       "0660",
 		RotatePerm: "0440",
 	}
+	c := clock.NewFake(time.Now())
+	fw.SetClock(c)
 	fw.Init(fmt.Sprintf(`{"filename":"%v","maxdays":1}`, fn1))
-	fw.dailyOpenTime = time.Now().Add(-24 * time.Hour)
+	fw.dailyOpenTime = c.Now().Add(-24 * time.Hour)
 	fw.dailyOpenDate = fw.dailyOpenTime.Day()
-	today, _ := time.ParseInLocation("2006-01-02", time.Now().Format("2006-01-02"), fw.dailyOpenTime.Location())
+	today, _ := time.ParseInLocation("2006-01-02", c.Now().Format("2006-01-02"), fw.dailyOpenTime.Location())
 	today = today.Add(-1 * time.Second)
-	fw.dailyRotate(today)
+	done := make(chan struct{})
+	go func() {
+		fw.dailyRotate(today)
+		close(done)
+	}()
+	// the rotation started by Init and the one of today wait for the clock.
+	for c.Waiters() < 2 {
+		runtime.Gosched()
+	}
+	c.Advance(2 * time.Second)
+	<-done
 	for _, file := range []string{fn1, fn2} {
 		_, err := os.Stat(file)
 		if err != nil {
@@ -29,6 +29,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"libs/clock"
 )
 
 // RFC5424 log message levels.
@@ -77,6 +79,11 @@ type Logger interface {
 	Flush()
 }
 
+// clockLogger is implemented by the adapters rotating with the time, the file adapters.
+type clockLogger interface {
+	SetClock(c clock.Clock)
+}
+
 var adapters = make(map[string]newLoggerFunc)
 var levelPrefix = [LevelDebug + 1]string{"[M] ", "[A] ", "[C] ", "[E] ", "[W] ", "[N] ", "[I] ", "[D] "}
 
@@ -107,6 +114,7 @@ type BeeLogger struct {
 	signalChan          chan string
 	wg                  sync.WaitGroup
 	outputs             []*nameLogger
+	clock               clock.Clock
 }
 
 const defaultAsyncMsgLen = 1e3
@@ -178,6 +186,9 @@ func (bl *BeeLogger) setLogger(adapterName string, configs ...string) error {
 	}
 
 	lg := log()
+	if cl, ok := lg.(clockLogger); ok && bl.clock != nil {
+		cl.SetClock(bl.clock)
+	}
 	err := lg.Init(config)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "logs.BeeLogger.SetLogger: "+err.Error())
@@ -253,7 +264,7 @@ func (bl *BeeLogger) writeMsg(logLevel int, msg string, v ...interface{}) error
 	if len(v) > 0 {
 		msg = fmt.Sprintf(msg, v...)
 	}
-	when := time.Now()
+	when := bl.now()
 	if bl.enableFuncCallDepth {
 		_, file, line, ok := runtime.Caller(bl.loggerFuncCallDepth)
 		if !ok {
@@ -291,6 +302,27 @@ func (bl *BeeLogger) SetLevel(l int) {
 	bl.level = l
 }
 
+// now returns the time of a message, SetClock may be called meanwhile.
+func (bl *BeeLogger) now() time.Time {
+	bl.lock.Lock()
+	c := bl.clock
+	bl.lock.Unlock()
+	return clock.Or(c).Now()
+}
+
+// SetClock sets the clock of the message times and of the rotation of the
+// adapters, the system time by default. call it before SetLogger.
+func (bl *BeeLogger) SetClock(c clock.Clock) {
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+	bl.clock = c
+	for _, l := range bl.outputs {
+		if cl, ok := l.Logger.(clockLogger); ok {
+			cl.SetClock(c)
+		}
+	}
+}
+
 // SetLogFuncCallDepth set log funcCallDepth
 func (bl *BeeLogger) SetLogFuncCallDepth(d int) {
 	bl.loggerFuncCallDepth = d
@@ -3,6 +3,8 @@ package logs
 import (
 	"encoding/json"
 	"time"
+
+	"libs/clock"
 )
 
 // A filesLogWriter manages several fileLogWriter
@@ -14,6 +16,17 @@ type multiFileLogWriter struct {
 	writers       [LevelDebug + 1 + 1]*fileLogWriter // the last one for fullLogWriter
 	fullLogWriter *fileLogWriter
 	Separate      []string `json:"separate"`
+	clock         clock.Clock
+}
+
+// SetClock sets the clock of the daily rotation of the files, the system time by default.
+func (f *multiFileLogWriter) SetClock(c clock.Clock) {
+	f.clock = c
+	for _, w := range f.writers {
+		if w != nil {
+			w.SetClock(c)
+		}
+	}
 }
 
 var levelNames = [...]string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
@@ -33,6 +46,7 @@ var levelNames = [...]string{"emergency", "alert", "critical", "error", "warning
 
 func (f *multiFileLogWriter) Init(config string) error {
 	writer := newFileWriter().(*fileLogWriter)
+	writer.SetClock(f.clock)
 	err := writer.Init(config)
 	if err != nil {
 		return err
@@ -53,6 +67,7 @@ func (f *multiFileLogWriter) Init(config string) error {
 				jsonMap["level"] = i
 				bs, _ := json.Marshal(jsonMap)
 				writer = newFileWriter().(*fileLogWriter)
+				writer.SetClock(f.clock)
 				writer.Init(string(bs))
 				f.writers[i] = writer
 			}
@@ -44,6 +44,7 @@ var (
 		"mysql":    DRMySQL,
 		"postgres": DRPostgres,
 		"sqlite3":  DRSqlite,
+		"sqlite":   DRSqlite, // modernc.org/sqlite, pure go
 		"tidb":     DRTiDB,
 		"oracle":   DROracle,
 		"oci8":     DROracle, // github.com/mattn/go-oci8
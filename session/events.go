@@ -0,0 +1,79 @@
+package session
+
+import "time"
+
+// EventType is the kind of change in the life of a session.
+type EventType int
+
+// the session events passed to the hooks.
+const (
+	// EventCreated is sent when SessionStart or SessionRegenerateID starts a new session.
+	EventCreated EventType = iota + 1
+	// EventRegenerated is sent when SessionRegenerateID gives a session a new id.
+	EventRegenerated
+	// EventDestroyed is sent when a session is destroyed by the application,
+	// by the user limit or because it was used by another client.
+	EventDestroyed
+	// EventExpired is sent when a session passed its idle or absolute timeout,
+	// or was removed by the gc of a provider implementing ExpiryNotifier.
+	EventExpired
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventRegenerated:
+		return "regenerated"
+	case EventDestroyed:
+		return "destroyed"
+	case EventExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// Event describes a change in the life of a session.
+type Event struct {
+	Type      EventType
+	SessionID string
+	// OldSessionID is the previous id of a regenerated session.
+	OldSessionID string
+	// UserID is the user bound with BindUser, when it is known.
+	UserID string
+	Time   time.Time
+}
+
+// Hook is called synchronously on every session event, it must not block.
+type Hook func(e Event)
+
+// ExpiryNotifier is implemented by the providers able to report the sessions
+// removed by SessionGC, the memory, mysql and postgresql providers.
+type ExpiryNotifier interface {
+	Provider
+	SetExpiredFunc(fn func(sid string))
+}
+
+// AddHook registers h to be called on every session event.
+// usage:
+//	globalSessions.AddHook(func(e session.Event) {
+//		log.Println("session", e.SessionID, e.Type)
+//	})
+func (manager *Manager) AddHook(h Hook) {
+	manager.hooksLock.Lock()
+	defer manager.hooksLock.Unlock()
+	manager.hooks = append(manager.hooks, h)
+}
+
+func (manager *Manager) emit(t EventType, sid, oldsid, uid string) {
+	manager.hooksLock.RLock()
+	hooks := manager.hooks
+	manager.hooksLock.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+	e := Event{Type: t, SessionID: sid, OldSessionID: oldsid, UserID: uid, Time: manager.now()}
+	for _, h := range hooks {
+		h(e)
+	}
+}
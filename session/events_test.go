@@ -0,0 +1,127 @@
+package session
+
+import (
+	"container/list"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// recordEvents returns the events sent by m.
+func recordEvents(m *Manager) *[]Event {
+	var events []Event
+	m.AddHook(func(e Event) {
+		events = append(events, e)
+	})
+	return &events
+}
+
+func TestSessionEvents(t *testing.T) {
+	m, err := NewManager("memory", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, IdleTimeout: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := recordEvents(m)
+
+	sess := startSession(t, m, "", "", "10.0.0.1:1234")
+	sid := sess.SessionID()
+	if err = m.BindUser(sess, "user001"); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "gosessionid", Value: sid})
+	sess = m.SessionRegenerateID(httptest.NewRecorder(), r)
+	newsid := sess.SessionID()
+
+	sess.Set(accessedKey, time.Now().Unix()-120)
+	startSession(t, m, newsid, "", "10.0.0.1:1234")
+
+	want := []Event{
+		{Type: EventCreated, SessionID: sid},
+		{Type: EventRegenerated, SessionID: newsid, OldSessionID: sid, UserID: "user001"},
+		{Type: EventExpired, SessionID: newsid, UserID: "user001"},
+		{Type: EventCreated},
+	}
+	if len(*events) != len(want) {
+		t.Fatal("events error", *events)
+	}
+	for i, e := range *events {
+		w := want[i]
+		if e.Type != w.Type || (w.SessionID != "" && e.SessionID != w.SessionID) ||
+			e.OldSessionID != w.OldSessionID || e.UserID != w.UserID || e.Time.IsZero() {
+			t.Fatal("event error", i, e)
+		}
+	}
+
+	*events = nil
+	sid = startSession(t, m, "", "", "10.0.0.1:1234").SessionID()
+	if err = m.BindUser(mustStore(t, m, sid), "user002"); err != nil {
+		t.Fatal(err)
+	}
+	sids, err := m.UserSessions("user002")
+	if err != nil || len(sids) != 1 || sids[0] != sid {
+		t.Fatal("user sessions error", sids, err)
+	}
+	if err = m.LogoutUser("user002"); err != nil {
+		t.Fatal(err)
+	}
+	last := (*events)[len(*events)-1]
+	if last.Type != EventDestroyed || last.SessionID != sid || last.UserID != "user002" {
+		t.Fatal("destroyed event error", last)
+	}
+	if sids, _ = m.UserSessions("user002"); len(sids) != 0 {
+		t.Fatal("revoked session listed", sids)
+	}
+}
+
+func TestSessionExpiredByGC(t *testing.T) {
+	p := &MemProvider{list: list.New(), sessions: make(map[string]*list.Element)}
+	Register("memory_events_test", p)
+	m, err := NewManager("memory_events_test", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, Maxlifetime: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := recordEvents(m)
+	sess := startSession(t, m, "", "", "10.0.0.1:1234")
+	sess.(*MemSessionStore).timeAccessed = time.Now().Add(-time.Hour)
+	p.SessionGC()
+	if len(*events) != 2 || (*events)[1].Type != EventExpired || (*events)[1].SessionID != sess.SessionID() {
+		t.Fatal("expired event error", *events)
+	}
+}
+
+func TestProviderUserIndex(t *testing.T) {
+	if _, err := NewManager("memory", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, ProviderUserIndex: true}); err == nil {
+		t.Fatal("memory provider has no user index")
+	}
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m, err := NewManager("redis", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, Maxlifetime: 3600,
+		ProviderConfig: s.Addr(), ProviderUserIndex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := m.index
+	defer index.Remove("user001", "sid1")
+	defer index.Remove("user001", "sid2")
+	index.Add("user001", "sid1")
+	time.Sleep(2 * time.Millisecond)
+	index.Add("user001", "sid2")
+	if sids, err := index.Sessions("user001"); err != nil || len(sids) != 2 || sids[0] != "sid1" {
+		t.Fatal("redis user index error", sids, err)
+	}
+}
+
+func mustStore(t *testing.T, m *Manager, sid string) Store {
+	sess, err := m.GetSessionStore(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type contextKey struct{}
+
+// sessionHolder holds the session of a request in its context.
+// the manager replaces it on SessionRegenerateID and drops it on SessionDestroy.
+type sessionHolder struct {
+	mu       sync.Mutex
+	store    Store
+	released bool
+}
+
+func (h *sessionHolder) get() Store {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.store
+}
+
+func (h *sessionHolder) set(store Store) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.store = store
+}
+
+// release saves the session once, unless it was destroyed.
+func (h *sessionHolder) release(w http.ResponseWriter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.released {
+		return
+	}
+	h.released = true
+	if h.store != nil {
+		h.store.SessionRelease(w)
+	}
+}
+
+// NewContext returns a copy of ctx holding store.
+func NewContext(ctx context.Context, store Store) context.Context {
+	return context.WithValue(ctx, contextKey{}, &sessionHolder{store: store})
+}
+
+// FromContext returns the session stored in ctx by Middleware or NewContext.
+func FromContext(ctx context.Context) (Store, bool) {
+	h := holderFromContext(ctx)
+	if h == nil {
+		return nil, false
+	}
+	store := h.get()
+	return store, store != nil
+}
+
+func holderFromContext(ctx context.Context) *sessionHolder {
+	h, _ := ctx.Value(contextKey{}).(*sessionHolder)
+	return h
+}
+
+// Middleware starts the session of the request and puts it in the request
+// context, get it in the handler with FromContext.
+// the session is released after the handler returns, the handler gets w
+// itself so http.Hijacker, http.Flusher and the like are kept.
+// a provider saving the session in a header, as the cookie provider, can't
+// set it once the response is written: call Release before writing then.
+//	http.Handle("/", globalSessions.Middleware(handler))
+func (manager *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := manager.SessionStart(w, r)
+		if err != nil {
+			SLogger.Println("session: start", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		h := &sessionHolder{store: sess}
+		defer h.release(w)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, h)))
+	})
+}
+
+// Release saves the session of ctx now instead of after the handler,
+// the values set afterwards are not saved.
+func Release(ctx context.Context, w http.ResponseWriter) {
+	if h := holderFromContext(ctx); h != nil {
+		h.release(w)
+	}
+}
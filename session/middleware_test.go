@@ -0,0 +1,138 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	globalSessions, err := NewManager("memory", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 10, EnableSetCookie: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := globalSessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := FromContext(r.Context())
+		if !ok {
+			t.Fatal("no session in context")
+		}
+		if started, _ := globalSessions.SessionStart(w, r); started != sess {
+			t.Fatal("SessionStart must return the session of the context")
+		}
+		if v := sess.Get("count"); v != nil {
+			sess.Set("count", v.(int)+1)
+		} else {
+			sess.Set("count", 1)
+		}
+		io.WriteString(w, "ok")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("setcookie error")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	sess, err := globalSessions.GetSessionStore(cookies[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Get("count") != 2 {
+		t.Fatal("session not kept between requests", sess.Get("count"))
+	}
+
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatal("FromContext must fail without session")
+	}
+}
+
+func TestMiddlewareRelease(t *testing.T) {
+	config := &ManagerConfig{
+		CookieName:     "gosessionid",
+		Gclifetime:     3600,
+		ProviderConfig: `{"cookieName":"gosessionid","securityKey":"cookiehashkey"}`,
+	}
+	globalSessions, err := NewManager("cookie", config)
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+
+	// the session is released after the handler, values set late are kept.
+	handler := globalSessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := FromContext(r.Context())
+		sess.Set("username", "user001")
+		sess.Set("late", true)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Header().Get("Set-Cookie"), "gosessionid=") {
+		t.Fatal("session not released after the handler")
+	}
+
+	// the cookie provider saves the session in a header,
+	// a handler writing the body releases it first.
+	handler = globalSessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := FromContext(r.Context())
+		sess.Set("username", "user001")
+		Release(r.Context(), w)
+		io.WriteString(w, "ok")
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(w.Result().Header["Set-Cookie"]) != 1 {
+		t.Fatal("session should be released once, before the body", w.Result().Header["Set-Cookie"])
+	}
+
+	handler = globalSessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := FromContext(r.Context())
+		sess.Set("username", "user001")
+		globalSessions.SessionDestroy(w, r)
+		if _, ok := FromContext(r.Context()); ok {
+			t.Fatal("destroyed session still in context")
+		}
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Header().Get("Set-Cookie") != "" {
+		t.Fatal("destroyed session must not be released")
+	}
+}
+
+// hijackRecorder is a ResponseRecorder implementing http.Hijacker.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestMiddlewareWriter(t *testing.T) {
+	globalSessions, err := NewManager("memory", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the handler gets the writer of the server, a websocket upgrade can hijack it.
+	w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	globalSessions.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatal("the writer should implement http.Hijacker")
+		}
+		hj.Hijack()
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !w.hijacked {
+		t.Fatal("the connection was not hijacked")
+	}
+}
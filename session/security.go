@@ -0,0 +1,247 @@
+package session
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+// the keys of the values the manager keeps in a session.
+const (
+	createdKey     = "_session_created"
+	accessedKey    = "_session_accessed"
+	fingerprintKey = "_session_fingerprint"
+	userKey        = "_session_user"
+)
+
+// ipv6FingerprintPrefix is the prefix length an IPv6 address is bound to.
+const ipv6FingerprintPrefix = 64
+
+// checksSessions reports whether the sessions need the timeout or fingerprint checks.
+func (manager *Manager) checksSessions() bool {
+	cf := manager.config
+	return cf.IdleTimeout > 0 || cf.AbsoluteTimeout > 0 || cf.FingerprintUserAgent || cf.FingerprintIPPrefix > 0
+}
+
+// fingerprint returns the fingerprint of the client of r, empty if it is disabled.
+func (manager *Manager) fingerprint(r *http.Request) string {
+	cf := manager.config
+	if !cf.FingerprintUserAgent && cf.FingerprintIPPrefix <= 0 {
+		return ""
+	}
+	h := sha256.New()
+	if cf.FingerprintUserAgent {
+		h.Write([]byte(r.UserAgent()))
+	}
+	h.Write([]byte{0})
+	if cf.FingerprintIPPrefix > 0 {
+		h.Write([]byte(ipPrefix(r.RemoteAddr, cf.FingerprintIPPrefix)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ipPrefix returns the network of the ip address in addr, the first bits of
+// an IPv4 address or the /64 network of an IPv6 address.
+func ipPrefix(addr string, bits int) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if bits > 32 {
+			bits = 32
+		}
+		return ip4.Mask(net.CIDRMask(bits, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(ipv6FingerprintPrefix, 128)).String()
+}
+
+// initSession records the creation of a session started by r.
+func (manager *Manager) initSession(session Store, r *http.Request) {
+	if !manager.checksSessions() {
+		return
+	}
+	now := manager.now().Unix()
+	session.Set(createdKey, now)
+	session.Set(accessedKey, now)
+	if fp := manager.fingerprint(r); fp != "" {
+		session.Set(fingerprintKey, fp)
+	}
+}
+
+// checkSession returns 0 if session can still be used by r, EventExpired if it
+// passed its idle or absolute timeout and EventDestroyed if another client uses it.
+// the last access time of a valid session is updated.
+func (manager *Manager) checkSession(session Store, r *http.Request) EventType {
+	if !manager.checksSessions() {
+		return 0
+	}
+	cf := manager.config
+	created, ok := toUnix(session.Get(createdKey))
+	if !ok {
+		// a session started before the checks were enabled.
+		manager.initSession(session, r)
+		return 0
+	}
+	now := manager.now().Unix()
+	if cf.AbsoluteTimeout > 0 && now-created > cf.AbsoluteTimeout {
+		return EventExpired
+	}
+	if accessed, ok := toUnix(session.Get(accessedKey)); ok && cf.IdleTimeout > 0 && now-accessed > cf.IdleTimeout {
+		return EventExpired
+	}
+	if fp := manager.fingerprint(r); fp != "" {
+		saved, _ := session.Get(fingerprintKey).(string)
+		if subtle.ConstantTimeCompare([]byte(saved), []byte(fp)) != 1 {
+			return EventDestroyed
+		}
+	}
+	session.Set(accessedKey, now)
+	return 0
+}
+
+// toUnix reads a unix time saved in a session, the serializers other than gob
+// read it back as another number type.
+func toUnix(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// invalidate destroys session and sends t.
+func (manager *Manager) invalidate(session Store, t EventType) {
+	uid, _ := UserOf(session)
+	if err := manager.destroySession(session.SessionID(), uid, t); err != nil {
+		SLogger.Println("session: invalidate", err)
+	}
+}
+
+// SetUserIndex replaces the in-memory index of the user sessions,
+// share one between the servers of a cluster.
+func (manager *Manager) SetUserIndex(index UserIndex) {
+	manager.index = index
+}
+
+// BindUser records session as a session of the user uid, call it on login.
+// when the user has more than ManagerConfig.MaxSessionsPerUser sessions,
+// the oldest ones are destroyed.
+func (manager *Manager) BindUser(session Store, uid string) error {
+	if err := session.Set(userKey, uid); err != nil {
+		return err
+	}
+	sid := session.SessionID()
+	if err := manager.index.Add(uid, sid); err != nil {
+		return err
+	}
+	max := manager.config.MaxSessionsPerUser
+	if max <= 0 {
+		return nil
+	}
+	sids, err := manager.liveSessions(uid, sid)
+	if err != nil {
+		return err
+	}
+	excess := len(sids) - max
+	for _, s := range sids {
+		if excess <= 0 {
+			break
+		}
+		if s == sid {
+			continue
+		}
+		if err = manager.destroySession(s, uid, EventDestroyed); err != nil {
+			return err
+		}
+		excess--
+	}
+	return nil
+}
+
+// UserOf returns the user bound to session with BindUser.
+func UserOf(session Store) (string, bool) {
+	uid, ok := session.Get(userKey).(string)
+	return uid, ok
+}
+
+// LogoutOtherDevices destroys the sessions of the user bound to session,
+// except session itself.
+func (manager *Manager) LogoutOtherDevices(session Store) error {
+	uid, ok := UserOf(session)
+	if !ok {
+		return nil
+	}
+	return manager.logoutUser(uid, session.SessionID())
+}
+
+// LogoutUser destroys all the sessions of the user uid.
+func (manager *Manager) LogoutUser(uid string) error {
+	return manager.logoutUser(uid, "")
+}
+
+func (manager *Manager) logoutUser(uid, keep string) error {
+	sids, err := manager.index.Sessions(uid)
+	if err != nil {
+		return err
+	}
+	for _, sid := range sids {
+		if sid == keep {
+			continue
+		}
+		if err = manager.destroySession(sid, uid, EventDestroyed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveSessions returns the sessions of uid still existing, the index forgets the others.
+// the session current may not be saved yet and is always kept.
+func (manager *Manager) liveSessions(uid, current string) ([]string, error) {
+	sids, err := manager.index.Sessions(uid)
+	if err != nil {
+		return nil, err
+	}
+	live := sids[:0]
+	for _, sid := range sids {
+		if sid == current || manager.provider.SessionExist(sid) {
+			live = append(live, sid)
+		} else if err = manager.index.Remove(uid, sid); err != nil {
+			return nil, err
+		}
+	}
+	return live, nil
+}
+
+// destroySession destroys sid, removes it from the sessions of uid, if any, and sends t.
+func (manager *Manager) destroySession(sid, uid string, t EventType) error {
+	if err := manager.provider.SessionDestroy(sid); err != nil {
+		return err
+	}
+	if uid != "" {
+		if err := manager.index.Remove(uid, sid); err != nil {
+			return err
+		}
+	}
+	manager.emit(t, sid, "", uid)
+	return nil
+}
+
+// UserSessions returns the live sessions of the user uid, the oldest first.
+// revoke one with SessionDestroyBySessionId, or all with LogoutUser.
+func (manager *Manager) UserSessions(uid string) ([]string, error) {
+	return manager.liveSessions(uid, "")
+}
@@ -0,0 +1,122 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startSession runs SessionStart for a request with the cookie of sid, if any.
+func startSession(t *testing.T, m *Manager, sid, userAgent, remoteAddr string) Store {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", userAgent)
+	r.RemoteAddr = remoteAddr
+	if sid != "" {
+		r.AddCookie(&http.Cookie{Name: "gosessionid", Value: sid})
+	}
+	sess, err := m.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	m, err := NewManager("memory", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, IdleTimeout: 60, AbsoluteTimeout: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := startSession(t, m, "", "", "10.0.0.1:1234")
+	sid := sess.SessionID()
+	if got := startSession(t, m, sid, "", "10.0.0.1:1234"); got.SessionID() != sid {
+		t.Fatal("valid session replaced")
+	}
+
+	now := time.Now().Unix()
+	sess.Set(accessedKey, now-120)
+	if got := startSession(t, m, sid, "", "10.0.0.1:1234"); got.SessionID() == sid {
+		t.Fatal("idle session kept")
+	}
+	if m.provider.SessionExist(sid) {
+		t.Fatal("idle session not destroyed")
+	}
+
+	sess = startSession(t, m, "", "", "10.0.0.1:1234")
+	sid = sess.SessionID()
+	sess.Set(createdKey, now-7200)
+	if got := startSession(t, m, sid, "", "10.0.0.1:1234"); got.SessionID() == sid {
+		t.Fatal("session past absolute timeout kept")
+	}
+
+	// the serializers other than gob read numbers back as float64.
+	sess = startSession(t, m, "", "", "10.0.0.1:1234")
+	sid = sess.SessionID()
+	sess.Set(accessedKey, float64(now-120))
+	if got := startSession(t, m, sid, "", "10.0.0.1:1234"); got.SessionID() == sid {
+		t.Fatal("idle session kept")
+	}
+}
+
+func TestSessionFingerprint(t *testing.T) {
+	m, err := NewManager("memory", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, FingerprintUserAgent: true, FingerprintIPPrefix: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid := startSession(t, m, "", "firefox", "10.0.0.1:1234").SessionID()
+	if got := startSession(t, m, sid, "firefox", "10.0.0.200:4321"); got.SessionID() != sid {
+		t.Fatal("session rejected in the same network")
+	}
+	if got := startSession(t, m, sid, "firefox", "10.0.1.1:1234"); got.SessionID() == sid {
+		t.Fatal("session kept from another network")
+	}
+
+	sid = startSession(t, m, "", "firefox", "[2001:db8::1]:1234").SessionID()
+	if got := startSession(t, m, sid, "firefox", "[2001:db8::2]:1234"); got.SessionID() != sid {
+		t.Fatal("session rejected in the same /64")
+	}
+	if got := startSession(t, m, sid, "curl", "[2001:db8::2]:1234"); got.SessionID() == sid {
+		t.Fatal("session kept with another user agent")
+	}
+}
+
+func TestMaxSessionsPerUser(t *testing.T) {
+	m, err := NewManager("memory", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, MaxSessionsPerUser: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sids []string
+	for i := 0; i < 3; i++ {
+		sess := startSession(t, m, "", "", "10.0.0.1:1234")
+		if err = m.BindUser(sess, "user001"); err != nil {
+			t.Fatal(err)
+		}
+		sids = append(sids, sess.SessionID())
+	}
+	if m.provider.SessionExist(sids[0]) {
+		t.Fatal("oldest session not destroyed")
+	}
+	if !m.provider.SessionExist(sids[1]) || !m.provider.SessionExist(sids[2]) {
+		t.Fatal("recent sessions destroyed")
+	}
+
+	current, _ := m.GetSessionStore(sids[2])
+	if uid, _ := UserOf(current); uid != "user001" {
+		t.Fatal("user not bound", uid)
+	}
+	if err = m.LogoutOtherDevices(current); err != nil {
+		t.Fatal(err)
+	}
+	if m.provider.SessionExist(sids[1]) || !m.provider.SessionExist(sids[2]) {
+		t.Fatal("logout other devices error")
+	}
+	if err = m.LogoutUser("user001"); err != nil {
+		t.Fatal(err)
+	}
+	if m.provider.SessionExist(sids[2]) {
+		t.Fatal("logout user error")
+	}
+	if sids, _ := m.index.Sessions("user001"); len(sids) != 0 {
+		t.Fatal("user index not cleaned", sids)
+	}
+}
@@ -1,12 +1,13 @@
 package session
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"sync"
+
+	"libs/clock"
 )
 
 var cookiepder = &CookieProvider{}
@@ -58,9 +59,11 @@ func (st *CookieSessionStore) SessionID() string {
 	return st.sid
 }
 
-// SessionRelease Write cookie session to http response cookie
+// SessionRelease Write cookie session to http response cookie.
+// the cookie is always encrypted with the newest key, so a cookie read with
+// an older key of the keyring is re-issued.
 func (st *CookieSessionStore) SessionRelease(w http.ResponseWriter) {
-	encodedCookie, err := encodeCookie(cookiepder.block, cookiepder.config.SecurityKey, cookiepder.config.SecurityName, st.values)
+	encodedCookie, err := encodeCookie(cookiepder.keys[0], cookiepder.config.SecurityName, st.values, clock.Or(cookiepder.clock).Now())
 	if err == nil {
 		cookie := &http.Cookie{Name: cookiepder.config.CookieName,
 			Value:    url.QueryEscape(encodedCookie),
@@ -73,19 +76,32 @@ func (st *CookieSessionStore) SessionRelease(w http.ResponseWriter) {
 }
 
 type cookieConfig struct {
-	SecurityKey  string `json:"securityKey"`
-	BlockKey     string `json:"blockKey"`
-	SecurityName string `json:"securityName"`
-	CookieName   string `json:"cookieName"`
-	Secure       bool   `json:"secure"`
-	Maxage       int    `json:"maxage"`
+	SecurityKey  string          `json:"securityKey"`
+	BlockKey     string          `json:"blockKey"`
+	OldKeys      []cookieKeyPair `json:"oldKeys"`
+	SecurityName string          `json:"securityName"`
+	CookieName   string          `json:"cookieName"`
+	Secure       bool            `json:"secure"`
+	Maxage       int             `json:"maxage"`
+}
+
+// cookieKeyPair is a retired pair of keys still used to read the cookies.
+type cookieKeyPair struct {
+	SecurityKey string `json:"securityKey"`
+	BlockKey    string `json:"blockKey"`
 }
 
 // CookieProvider Cookie session provider
 type CookieProvider struct {
 	maxlifetime int64
 	config      *cookieConfig
-	block       cipher.Block
+	keys        []*cookieKey // the newest first
+	clock       clock.Clock
+}
+
+// SetClock sets the clock the cookies are dated and expire with, the system time by default.
+func (pder *CookieProvider) SetClock(c clock.Clock) {
+	pder.clock = c
 }
 
 // SessionInit Init cookie session provider with max lifetime and config json.
@@ -93,6 +109,9 @@ type CookieProvider struct {
 // json config:
 // 	securityKey - hash string
 // 	blockKey - gob encode hash string. it's saved as aes crypto.
+// 	oldKeys - the previous securityKey and blockKey pairs, the newest first.
+// 	the cookies are encrypted with securityKey and blockKey and read with
+// 	any of the keys, so the keys can be rotated without ending the sessions.
 // 	securityName - recognized name in encoded cookie string
 // 	cookieName - cookie name
 // 	maxage - cookie max life time.
@@ -108,9 +127,17 @@ func (pder *CookieProvider) SessionInit(maxlifetime int64, config string) error
 	if pder.config.SecurityName == "" {
 		pder.config.SecurityName = string(generateRandomKey(20))
 	}
-	pder.block, err = aes.NewCipher([]byte(pder.config.BlockKey))
-	if err != nil {
-		return err
+	pder.keys = pder.keys[:0]
+	pairs := append([]cookieKeyPair{{SecurityKey: pder.config.SecurityKey, BlockKey: pder.config.BlockKey}}, pder.config.OldKeys...)
+	for i, pair := range pairs {
+		if i > 0 && pair.BlockKey == "" {
+			return errors.New("cookie session: old key without blockKey")
+		}
+		key, err := newCookieKey(pair.BlockKey, pair.SecurityKey)
+		if err != nil {
+			return err
+		}
+		pder.keys = append(pder.keys, key)
 	}
 	pder.maxlifetime = maxlifetime
 	return nil
@@ -119,10 +146,9 @@ func (pder *CookieProvider) SessionInit(maxlifetime int64, config string) error
 // SessionRead Get SessionStore in cooke.
 // decode cooke string to map and put into SessionStore with sid.
 func (pder *CookieProvider) SessionRead(sid string) (Store, error) {
-	maps, _ := decodeCookie(pder.block,
-		pder.config.SecurityKey,
+	maps, _ := decodeCookie(pder.keys,
 		pder.config.SecurityName,
-		sid, pder.maxlifetime)
+		sid, pder.maxlifetime, clock.Or(pder.clock).Now())
 	if maps == nil {
 		maps = make(map[interface{}]interface{})
 	}
@@ -1,11 +1,18 @@
 package session
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCookie(t *testing.T) {
@@ -89,3 +96,66 @@ func TestDestorySessionCookie(t *testing.T) {
 		t.Fatal("after destroy session and reqeust again ,get cookie session id is same.")
 	}
 }
+
+// cookieProviderConfig returns the provider config of the cookie provider with keys.
+func cookieProviderConfig(keys string) string {
+	return `{"cookieName":"gosessionid","securityName":"gosession",` + keys + `}`
+}
+
+func TestCookieKeyRotation(t *testing.T) {
+	if err := cookiepder.SessionInit(3600, cookieProviderConfig(`"securityKey":"oldhashkey","blockKey":"0123456789abcdef"`)); err != nil {
+		t.Fatal(err)
+	}
+	value, err := encodeCookie(cookiepder.keys[0], "gosession", map[interface{}]interface{}{"username": "user001"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cookiepder.SessionInit(3600, cookieProviderConfig(`"securityKey":"newhashkey","blockKey":"fedcba9876543210",`+
+		`"oldKeys":[{"securityKey":"oldhashkey","blockKey":"0123456789abcdef"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := cookiepder.SessionRead(value)
+	if sess.Get("username") != "user001" {
+		t.Fatal("cookie of the old key not read")
+	}
+	w := httptest.NewRecorder()
+	sess.SessionRelease(w)
+	cookie := w.Result().Cookies()[0]
+	reissued, _ := url.QueryUnescape(cookie.Value)
+	if m, err := decodeCookie(cookiepder.keys[:1], "gosession", reissued, 3600, time.Now()); err != nil || m["username"] != "user001" {
+		t.Fatal("cookie not re-issued with the newest key", err)
+	}
+
+	if err = cookiepder.SessionInit(3600, cookieProviderConfig(`"securityKey":"newhashkey","blockKey":"fedcba9876543210"`)); err != nil {
+		t.Fatal(err)
+	}
+	if sess, _ = cookiepder.SessionRead(value); sess.Get("username") != nil {
+		t.Fatal("cookie of a retired key read")
+	}
+}
+
+func TestLegacyCookie(t *testing.T) {
+	if err := cookiepder.SessionInit(3600, cookieProviderConfig(`"securityKey":"cookiehashkey","blockKey":"0123456789abcdef"`)); err != nil {
+		t.Fatal(err)
+	}
+	// a cookie encrypted in counter mode and signed with hmac-sha1.
+	b, _ := EncodeGob(map[interface{}]interface{}{"username": "user001"})
+	block, _ := aes.NewCipher([]byte("0123456789abcdef"))
+	iv := generateRandomKey(block.BlockSize())
+	cipher.NewCTR(block, iv).XORKeyStream(b, b)
+	b = []byte(fmt.Sprintf("gosession|%d|%s|", time.Now().Unix(), encode(append(iv, b...))))
+	h := hmac.New(sha1.New, []byte("cookiehashkey"))
+	h.Write(b)
+	value := string(encode(append(b, h.Sum(nil)...)[len("gosession|"):]))
+
+	if sess, _ := cookiepder.SessionRead(value); sess.Get("username") != "user001" {
+		t.Fatal("legacy cookie not read")
+	}
+	tampered := []byte(value)
+	tampered[10] ^= 1
+	if sess, _ := cookiepder.SessionRead(string(tampered)); sess.Get("username") != nil {
+		t.Fatal("tampered legacy cookie read")
+	}
+}
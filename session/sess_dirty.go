@@ -0,0 +1,174 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	rediss "github.com/go-redis/redis"
+)
+
+// DirtyTrackingProvider is implemented by the providers able to save only the
+// keys changed by a request instead of rewriting the whole session,
+// see ManagerConfig.DirtyTracking.
+// in this mode the redis providers store a session as a hash with one field
+// per key, and the mysql provider checks a version column before saving.
+type DirtyTrackingProvider interface {
+	Provider
+	SetDirtyTracking(enable bool)
+}
+
+// dirtyKeys records the changes made to a session since it was read.
+type dirtyKeys struct {
+	set     map[interface{}]struct{}
+	deleted map[interface{}]struct{}
+	flushed bool
+}
+
+func (d *dirtyKeys) markSet(key interface{}) {
+	if d.set == nil {
+		d.set = make(map[interface{}]struct{})
+	}
+	d.set[key] = struct{}{}
+	delete(d.deleted, key)
+}
+
+func (d *dirtyKeys) markDelete(key interface{}) {
+	if d.deleted == nil {
+		d.deleted = make(map[interface{}]struct{})
+	}
+	d.deleted[key] = struct{}{}
+	delete(d.set, key)
+}
+
+func (d *dirtyKeys) markFlush() {
+	d.set, d.deleted, d.flushed = nil, nil, true
+}
+
+func (d *dirtyKeys) isDirty() bool {
+	return d.flushed || len(d.set) > 0 || len(d.deleted) > 0
+}
+
+func (d *dirtyKeys) reset() {
+	d.set, d.deleted, d.flushed = nil, nil, false
+}
+
+// merge applies the changes made on values to latest, the values saved by
+// another request in the meantime, and returns the result.
+func (d *dirtyKeys) merge(values, latest map[interface{}]interface{}) map[interface{}]interface{} {
+	if d.flushed || latest == nil {
+		latest = make(map[interface{}]interface{})
+	}
+	for key := range d.deleted {
+		delete(latest, key)
+	}
+	for key := range d.set {
+		latest[key] = values[key]
+	}
+	return latest
+}
+
+// hashMetaField is always set in a session hash, so an empty session still exists.
+const hashMetaField = "__session"
+
+// hashField returns the name of the hash field holding key.
+func hashField(key interface{}) string {
+	return fmt.Sprintf("%T:%v", key, key)
+}
+
+// hashChanges returns the fields to set and the fields to delete to save the
+// changes made on values. each field holds its key and value encoded by s.
+func hashChanges(s serializerOption, d *dirtyKeys, values map[interface{}]interface{}) (map[string]interface{}, []string, error) {
+	fields := map[string]interface{}{hashMetaField: 1}
+	set := d.set
+	if d.flushed {
+		set = make(map[interface{}]struct{}, len(values))
+		for key := range values {
+			set[key] = struct{}{}
+		}
+	}
+	for key := range set {
+		b, err := s.encode(map[interface{}]interface{}{key: values[key]})
+		if err != nil {
+			return nil, nil, err
+		}
+		fields[hashField(key)] = b
+	}
+	del := make([]string, 0, len(d.deleted))
+	for key := range d.deleted {
+		del = append(del, hashField(key))
+	}
+	return fields, del, nil
+}
+
+// decodeHash decodes the fields of a session hash.
+func decodeHash(s serializerOption, fields map[string]string) (map[interface{}]interface{}, error) {
+	kv := make(map[interface{}]interface{}, len(fields))
+	for name, field := range fields {
+		if name == hashMetaField {
+			continue
+		}
+		m, err := s.decode([]byte(field))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range m {
+			kv[k] = v
+		}
+	}
+	return kv, nil
+}
+
+// isWrongType reports whether err is returned because the session is still
+// saved as a single value, before dirty tracking was enabled.
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// readRedisHash reads the session sid saved as a hash by the go-redis clients.
+// a session saved as a single value is decoded and marked as flushed,
+// so it is rewritten as a hash on release.
+func readRedisHash(s serializerOption, c rediss.Cmdable, sid string) (map[interface{}]interface{}, *dirtyKeys, error) {
+	d := &dirtyKeys{}
+	fields, err := c.HGetAll(sid).Result()
+	if isWrongType(err) {
+		kvs, err := c.Get(sid).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		d.flushed = true
+		if len(kvs) == 0 {
+			return make(map[interface{}]interface{}), d, nil
+		}
+		kv, err := s.decode([]byte(kvs))
+		return kv, d, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	kv, err := decodeHash(s, fields)
+	return kv, d, err
+}
+
+// releaseRedisHash saves the changes made on values to the session hash sid
+// in a transaction with the go-redis clients.
+func releaseRedisHash(c rediss.Cmdable, sid string, values map[interface{}]interface{}, d *dirtyKeys, s serializerOption, maxlifetime int64) error {
+	fields, del, err := hashChanges(s, d, values)
+	if err != nil {
+		return err
+	}
+	pipe := c.TxPipeline()
+	if d.flushed {
+		pipe.Del(sid)
+	}
+	if len(del) > 0 {
+		pipe.HDel(sid, del...)
+	}
+	pipe.HMSet(sid, fields)
+	pipe.Expire(sid, time.Duration(maxlifetime)*time.Second)
+	if _, err = pipe.Exec(); err != nil {
+		return err
+	}
+	d.reset()
+	return nil
+}
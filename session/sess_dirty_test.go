@@ -0,0 +1,128 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestDirtyKeysMerge(t *testing.T) {
+	values := map[interface{}]interface{}{"a": 1, "b": 2}
+	d := &dirtyKeys{}
+	d.markSet("a")
+	d.markDelete("c")
+	latest := map[interface{}]interface{}{"a": 0, "c": 3, "d": 4}
+	got := d.merge(values, latest)
+	if len(got) != 2 || got["a"] != 1 || got["d"] != 4 {
+		t.Fatal("merge error", got)
+	}
+
+	d.markFlush()
+	d.markSet("b")
+	got = d.merge(values, map[interface{}]interface{}{"d": 4})
+	if len(got) != 1 || got["b"] != 2 {
+		t.Fatal("merge after flush error", got)
+	}
+	d.reset()
+	if d.isDirty() {
+		t.Fatal("reset error")
+	}
+}
+
+func TestHashChanges(t *testing.T) {
+	values := map[interface{}]interface{}{"username": "user001", 12: 234}
+	d := &dirtyKeys{}
+	d.markSet("username")
+	d.markSet(12)
+	d.markDelete("password")
+	fields, del, err := hashChanges(serializerOption{}, d, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(del) != 1 || del[0] != hashField("password") {
+		t.Fatal("deleted fields error", del)
+	}
+	raw := make(map[string]string)
+	for name, v := range fields {
+		if b, ok := v.([]byte); ok {
+			raw[name] = string(b)
+		}
+	}
+	raw[hashMetaField] = "1"
+	kv, err := decodeHash(serializerOption{}, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kv) != 2 || kv["username"] != "user001" || kv[12] != 234 {
+		t.Fatal("decode hash error", kv)
+	}
+}
+
+func TestRedisDirtyTracking(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	rp := &RedisProvider{}
+	rp.SetDirtyTracking(true)
+	if err := rp.SessionInit(60, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	sid := "dirty-tracking-test"
+	defer rp.SessionDestroy(sid)
+	rp.SessionDestroy(sid)
+
+	first, err := rp.SessionRead(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rp.SessionRead(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Set("cart", 3)
+	second.Set("theme", "dark")
+	first.SessionRelease(httptest.NewRecorder())
+	second.SessionRelease(httptest.NewRecorder())
+
+	sess, err := rp.SessionRead(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Get("cart") != 3 || sess.Get("theme") != "dark" {
+		t.Fatal("concurrent writes lost", sess.Get("cart"), sess.Get("theme"))
+	}
+	sess.Delete("cart")
+	sess.SessionRelease(httptest.NewRecorder())
+	if sess, _ = rp.SessionRead(sid); sess.Get("cart") != nil || sess.Get("theme") != "dark" {
+		t.Fatal("delete error")
+	}
+}
+
+func TestRedisDirtyTrackingExecError(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	rp := &RedisProvider{}
+	rp.SetDirtyTracking(true)
+	if err := rp.SessionInit(60, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	sess, err := rp.SessionRead("exec-error-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key turns into a string after the read, so HMSET fails inside EXEC.
+	s.Set("exec-error-test", "value")
+	sess.Set("cart", 3)
+	if err = sess.(*RedisSessionStore).releaseHash(); err == nil {
+		t.Fatal("a failed command of the transaction should be returned")
+	}
+	if !sess.(*RedisSessionStore).dirty.isDirty() {
+		t.Fatal("the dirty keys should be kept after a failed release")
+	}
+}
@@ -19,9 +19,10 @@ var (
 
 // FileSessionStore File session store
 type FileSessionStore struct {
-	sid    string
-	lock   sync.RWMutex
-	values map[interface{}]interface{}
+	sid        string
+	lock       sync.RWMutex
+	values     map[interface{}]interface{}
+	serializer serializerOption
 }
 
 // Set value to file session
@@ -67,7 +68,7 @@ func (fs *FileSessionStore) SessionID() string {
 func (fs *FileSessionStore) SessionRelease(w http.ResponseWriter) {
 	filepder.lock.Lock()
 	defer filepder.lock.Unlock()
-	b, err := EncodeGob(fs.values)
+	b, err := fs.serializer.encode(fs.values)
 	if err != nil {
 		SLogger.Println(err)
 		return
@@ -97,6 +98,7 @@ func (fs *FileSessionStore) SessionRelease(w http.ResponseWriter) {
 
 // FileProvider File session provider
 type FileProvider struct {
+	serializerOption
 	lock        sync.RWMutex
 	maxlifetime int64
 	savePath    string
@@ -145,13 +147,13 @@ func (fp *FileProvider) SessionRead(sid string) (Store, error) {
 	if len(b) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = DecodeGob(b)
+		kv, err = fp.decode(b)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	ss := &FileSessionStore{sid: sid, values: kv}
+	ss := &FileSessionStore{sid: sid, values: kv, serializer: fp.serializerOption}
 	return ss, nil
 }
 
@@ -234,7 +236,7 @@ func (fp *FileProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 		if len(b) == 0 {
 			kv = make(map[interface{}]interface{})
 		} else {
-			kv, err = DecodeGob(b)
+			kv, err = fp.decode(b)
 			if err != nil {
 				return nil, err
 			}
@@ -243,7 +245,7 @@ func (fp *FileProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 		ioutil.WriteFile(newSidFile, b, 0777)
 		os.Remove(oldSidFile)
 		os.Chtimes(newSidFile, time.Now(), time.Now())
-		ss := &FileSessionStore{sid: sid, values: kv}
+		ss := &FileSessionStore{sid: sid, values: kv, serializer: fp.serializerOption}
 		return ss, nil
 	}
 
@@ -253,7 +255,7 @@ func (fp *FileProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 		return nil, err
 	}
 	newf.Close()
-	ss := &FileSessionStore{sid: sid, values: make(map[interface{}]interface{})}
+	ss := &FileSessionStore{sid: sid, values: make(map[interface{}]interface{}), serializer: fp.serializerOption}
 	return ss, nil
 }
 
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"libs/clock"
 )
 
 var mempder = &MemProvider{list: list.New(), sessions: make(map[string]*list.Element)}
@@ -68,6 +70,18 @@ type MemProvider struct {
 	list        *list.List               // for gc
 	maxlifetime int64
 	savePath    string
+	expired     func(sid string)
+	clock       clock.Clock
+}
+
+// SetExpiredFunc sets the function called with the sessions removed by SessionGC.
+func (pder *MemProvider) SetExpiredFunc(fn func(sid string)) {
+	pder.expired = fn
+}
+
+// SetClock sets the clock the sessions expire with, the system time by default.
+func (pder *MemProvider) SetClock(c clock.Clock) {
+	pder.clock = c
 }
 
 // SessionInit init memory session
@@ -87,7 +101,7 @@ func (pder *MemProvider) SessionRead(sid string) (Store, error) {
 	}
 	pder.lock.RUnlock()
 	pder.lock.Lock()
-	newsess := &MemSessionStore{sid: sid, timeAccessed: time.Now(), value: make(map[interface{}]interface{})}
+	newsess := &MemSessionStore{sid: sid, timeAccessed: clock.Or(pder.clock).Now(), value: make(map[interface{}]interface{})}
 	element := pder.list.PushFront(newsess)
 	pder.sessions[sid] = element
 	pder.lock.Unlock()
@@ -119,7 +133,7 @@ func (pder *MemProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 	}
 	pder.lock.RUnlock()
 	pder.lock.Lock()
-	newsess := &MemSessionStore{sid: sid, timeAccessed: time.Now(), value: make(map[interface{}]interface{})}
+	newsess := &MemSessionStore{sid: sid, timeAccessed: clock.Or(pder.clock).Now(), value: make(map[interface{}]interface{})}
 	element := pder.list.PushFront(newsess)
 	pder.sessions[sid] = element
 	pder.lock.Unlock()
@@ -140,17 +154,19 @@ func (pder *MemProvider) SessionDestroy(sid string) error {
 
 // SessionGC clean expired session stores in memory session
 func (pder *MemProvider) SessionGC() {
+	var expired []string
 	pder.lock.RLock()
 	for {
 		element := pder.list.Back()
 		if element == nil {
 			break
 		}
-		if (element.Value.(*MemSessionStore).timeAccessed.Unix() + pder.maxlifetime) < time.Now().Unix() {
+		if (element.Value.(*MemSessionStore).timeAccessed.Unix() + pder.maxlifetime) < clock.Or(pder.clock).Now().Unix() {
 			pder.lock.RUnlock()
 			pder.lock.Lock()
 			pder.list.Remove(element)
 			delete(pder.sessions, element.Value.(*MemSessionStore).sid)
+			expired = append(expired, element.Value.(*MemSessionStore).sid)
 			pder.lock.Unlock()
 			pder.lock.RLock()
 		} else {
@@ -158,6 +174,11 @@ func (pder *MemProvider) SessionGC() {
 		}
 	}
 	pder.lock.RUnlock()
+	if pder.expired != nil {
+		for _, sid := range expired {
+			pder.expired(sid)
+		}
+	}
 }
 
 // SessionAll get count number of memory session
@@ -170,7 +191,7 @@ func (pder *MemProvider) SessionUpdate(sid string) error {
 	pder.lock.Lock()
 	defer pder.lock.Unlock()
 	if element, ok := pder.sessions[sid]; ok {
-		element.Value.(*MemSessionStore).timeAccessed = time.Now()
+		element.Value.(*MemSessionStore).timeAccessed = clock.Or(pder.clock).Now()
 		pder.list.MoveToFront(element)
 		return nil
 	}
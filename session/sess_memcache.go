@@ -27,6 +27,7 @@ type MemcacheSessionStore struct {
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
 	maxlifetime int64
+	serializer  serializerOption
 }
 
 // Set value in memcache session
@@ -70,7 +71,7 @@ func (rs *MemcacheSessionStore) SessionID() string {
 
 // SessionRelease save session values to memcache
 func (rs *MemcacheSessionStore) SessionRelease(w http.ResponseWriter) {
-	b, err := EncodeGob(rs.values)
+	b, err := rs.serializer.encode(rs.values)
 	if err != nil {
 		return
 	}
@@ -80,6 +81,7 @@ func (rs *MemcacheSessionStore) SessionRelease(w http.ResponseWriter) {
 
 // MemcacheProvider memcache session provider
 type MemcacheProvider struct {
+	serializerOption
 	maxlifetime int64
 	conninfo    []string
 	poolsize    int
@@ -106,7 +108,7 @@ func (rp *MemcacheProvider) SessionRead(sid string) (Store, error) {
 	item, err := client.Get(sid)
 	if err != nil {
 		if err == memcache.ErrCacheMiss {
-			rs := &MemcacheSessionStore{sid: sid, values: make(map[interface{}]interface{}), maxlifetime: rp.maxlifetime}
+			rs := &MemcacheSessionStore{sid: sid, values: make(map[interface{}]interface{}), maxlifetime: rp.maxlifetime, serializer: rp.serializerOption}
 			return rs, nil
 		}
 		return nil, err
@@ -115,12 +117,12 @@ func (rp *MemcacheProvider) SessionRead(sid string) (Store, error) {
 	if len(item.Value) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = DecodeGob(item.Value)
+		kv, err = rp.decode(item.Value)
 		if err != nil {
 			return nil, err
 		}
 	}
-	rs := &MemcacheSessionStore{sid: sid, values: kv, maxlifetime: rp.maxlifetime}
+	rs := &MemcacheSessionStore{sid: sid, values: kv, maxlifetime: rp.maxlifetime, serializer: rp.serializerOption}
 	return rs, nil
 }
 
@@ -145,14 +147,11 @@ func (rp *MemcacheProvider) SessionRegenerate(oldsid, sid string) (Store, error)
 		}
 	}
 	var contain []byte
-	if item, err := client.Get(sid); err != nil || len(item.Value) == 0 {
+	if item, err := client.Get(oldsid); err != nil || len(item.Value) == 0 {
 		// oldsid doesn't exists, set the new sid directly
 		// ignore error here, since if it return error
 		// the existed value will be 0
-		item.Key = sid
-		item.Value = []byte("")
-		item.Expiration = int32(rp.maxlifetime)
-		client.Set(item)
+		client.Set(&memcache.Item{Key: sid, Value: []byte(""), Expiration: int32(rp.maxlifetime)})
 	} else {
 		client.Delete(oldsid)
 		item.Key = sid
@@ -166,13 +165,13 @@ func (rp *MemcacheProvider) SessionRegenerate(oldsid, sid string) (Store, error)
 		kv = make(map[interface{}]interface{})
 	} else {
 		var err error
-		kv, err = DecodeGob(contain)
+		kv, err = rp.decode(contain)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	rs := &MemcacheSessionStore{sid: sid, values: kv, maxlifetime: rp.maxlifetime}
+	rs := &MemcacheSessionStore{sid: sid, values: kv, maxlifetime: rp.maxlifetime, serializer: rp.serializerOption}
 	return rs, nil
 }
 
@@ -5,7 +5,21 @@
 //	`session_data` blob,
 //	`session_expiry` int(11) unsigned NOT NULL,
 //	PRIMARY KEY (`session_key`)
-//	) ENGINE=MyISAM DEFAULT CHARSET=utf8;
+//	) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+//
+// the gc locks the expired sessions in a transaction, which needs InnoDB.
+//
+// with ManagerConfig.ProviderUserIndex the sessions of the users are kept in:
+//	CREATE TABLE `session_user` (
+//	`user_id` varchar(64) NOT NULL,
+//	`session_key` char(64) NOT NULL,
+//	`created` bigint NOT NULL,
+//	PRIMARY KEY (`user_id`, `session_key`)
+//	) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+//
+// with ManagerConfig.DirtyTracking the sessions are saved with optimistic versioning,
+// which needs a version column:
+//	ALTER TABLE `session` ADD `session_version` int(11) unsigned NOT NULL DEFAULT 0;
 //
 // Usage:
 // import(
@@ -21,7 +35,9 @@ package session
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,7 +48,17 @@ import (
 var (
 	// TableName store the session in MySQL
 	TableName = "session"
-	mysqlpder = &MysqlProvider{}
+	// UserTableName store the sessions of the users in MySQL
+	UserTableName = "session_user"
+	// MysqlMaxRetries is the number of times a versioned session is merged
+	// with the values saved by a concurrent request before giving up.
+	MysqlMaxRetries = 3
+	// MysqlDriverName is the database/sql driver the sessions are stored with,
+	// for the drivers wrapping the mysql driver.
+	MysqlDriverName = "mysql"
+	mysqlpder       = &MysqlProvider{}
+
+	errVersionConflict = errors.New("mysql: session modified concurrently")
 )
 
 // MysqlSessionStore mysql session store
@@ -41,6 +67,10 @@ type MysqlSessionStore struct {
 	sid    string
 	lock   sync.RWMutex
 	values map[interface{}]interface{}
+	// version is the session_version read, set when the session is versioned.
+	version    int64
+	dirty      *dirtyKeys
+	serializer serializerOption
 }
 
 // Set value in mysql session.
@@ -49,6 +79,9 @@ func (st *MysqlSessionStore) Set(key, value interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	st.values[key] = value
+	if st.dirty != nil {
+		st.dirty.markSet(key)
+	}
 	return nil
 }
 
@@ -67,6 +100,9 @@ func (st *MysqlSessionStore) Delete(key interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	delete(st.values, key)
+	if st.dirty != nil {
+		st.dirty.markDelete(key)
+	}
 	return nil
 }
 
@@ -75,6 +111,9 @@ func (st *MysqlSessionStore) Flush() error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	st.values = make(map[interface{}]interface{})
+	if st.dirty != nil {
+		st.dirty.markFlush()
+	}
 	return nil
 }
 
@@ -87,7 +126,13 @@ func (st *MysqlSessionStore) SessionID() string {
 // must call this method to save values to database.
 func (st *MysqlSessionStore) SessionRelease(w http.ResponseWriter) {
 	defer st.c.Close()
-	b, err := EncodeGob(st.values)
+	if st.dirty != nil {
+		if err := st.releaseVersioned(); err != nil {
+			SLogger.Println("mysql: save session", st.sid, err)
+		}
+		return
+	}
+	b, err := st.serializer.encode(st.values)
 	if err != nil {
 		return
 	}
@@ -95,15 +140,83 @@ func (st *MysqlSessionStore) SessionRelease(w http.ResponseWriter) {
 		b, time.Now().Unix(), st.sid)
 }
 
+// releaseVersioned saves the session if nobody saved it since it was read.
+// otherwise the changes are applied to the values saved by the other request
+// and saved again, so concurrent requests do not overwrite each other.
+func (st *MysqlSessionStore) releaseVersioned() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if !st.dirty.isDirty() {
+		_, err := st.c.Exec("UPDATE "+TableName+" set `session_expiry`=? where session_key=?",
+			time.Now().Unix(), st.sid)
+		return err
+	}
+	for i := 0; i < MysqlMaxRetries; i++ {
+		b, err := st.serializer.encode(st.values)
+		if err != nil {
+			return err
+		}
+		res, err := st.c.Exec("UPDATE "+TableName+" set `session_data`=?, `session_expiry`=?, `session_version`=`session_version`+1 where session_key=? and `session_version`=?",
+			b, time.Now().Unix(), st.sid, st.version)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 1 {
+			st.version++
+			st.dirty.reset()
+			return nil
+		}
+		latest, version, err := readVersioned(st.serializer, st.c, st.sid)
+		if err != nil {
+			return err
+		}
+		st.values, st.version = st.dirty.merge(st.values, latest), version
+	}
+	return errVersionConflict
+}
+
 // MysqlProvider mysql session provider
 type MysqlProvider struct {
+	serializerOption
 	maxlifetime int64
 	savePath    string
+	versioned   bool
+	expired     func(sid string)
+}
+
+// SetExpiredFunc sets the function called with the sessions removed by SessionGC.
+func (mp *MysqlProvider) SetExpiredFunc(fn func(sid string)) {
+	mp.expired = fn
+}
+
+// SetDirtyTracking saves the sessions with optimistic versioning,
+// the table needs the session_version column.
+func (mp *MysqlProvider) SetDirtyTracking(enable bool) {
+	mp.versioned = enable
+}
+
+// readVersioned reads the values and the version of the session sid.
+func readVersioned(s serializerOption, c *sql.DB, sid string) (map[interface{}]interface{}, int64, error) {
+	var sessiondata []byte
+	var version int64
+	err := c.QueryRow("select session_data, session_version from "+TableName+" where session_key=?", sid).Scan(&sessiondata, &version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(sessiondata) == 0 {
+		return make(map[interface{}]interface{}), version, nil
+	}
+	kv, err := s.decode(sessiondata)
+	return kv, version, err
 }
 
 // connect to mysql
 func (mp *MysqlProvider) connectInit() *sql.DB {
-	db, e := sql.Open("mysql", mp.savePath)
+	db, e := sql.Open(MysqlDriverName, mp.savePath)
 	if e != nil {
 		return nil
 	}
@@ -121,6 +234,9 @@ func (mp *MysqlProvider) SessionInit(maxlifetime int64, savePath string) error {
 // SessionRead get mysql session by sid
 func (mp *MysqlProvider) SessionRead(sid string) (Store, error) {
 	c := mp.connectInit()
+	if mp.versioned {
+		return mp.sessionReadVersioned(c, sid)
+	}
 	row := c.QueryRow("select session_data from "+TableName+" where session_key=?", sid)
 	var sessiondata []byte
 	err := row.Scan(&sessiondata)
@@ -132,15 +248,30 @@ func (mp *MysqlProvider) SessionRead(sid string) (Store, error) {
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = DecodeGob(sessiondata)
+		kv, err = mp.decode(sessiondata)
 		if err != nil {
 			return nil, err
 		}
 	}
-	rs := &MysqlSessionStore{c: c, sid: sid, values: kv}
+	rs := &MysqlSessionStore{c: c, sid: sid, values: kv, serializer: mp.serializerOption}
 	return rs, nil
 }
 
+// sessionReadVersioned reads the session and its version, it is created if missing.
+func (mp *MysqlProvider) sessionReadVersioned(c *sql.DB, sid string) (Store, error) {
+	kv, version, err := readVersioned(mp.serializerOption, c, sid)
+	if err == sql.ErrNoRows {
+		_, err = c.Exec("insert into "+TableName+"(`session_key`,`session_data`,`session_expiry`,`session_version`) values(?,?,?,0)",
+			sid, "", time.Now().Unix())
+		kv = make(map[interface{}]interface{})
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &MysqlSessionStore{c: c, sid: sid, values: kv, version: version, dirty: &dirtyKeys{}, serializer: mp.serializerOption}, nil
+}
+
 // SessionExist check mysql session exist
 func (mp *MysqlProvider) SessionExist(sid string) bool {
 	c := mp.connectInit()
@@ -161,16 +292,19 @@ func (mp *MysqlProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 		c.Exec("insert into "+TableName+"(`session_key`,`session_data`,`session_expiry`) values(?,?,?)", oldsid, "", time.Now().Unix())
 	}
 	c.Exec("update "+TableName+" set `session_key`=? where session_key=?", sid, oldsid)
+	if mp.versioned {
+		return mp.sessionReadVersioned(c, sid)
+	}
 	var kv map[interface{}]interface{}
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = DecodeGob(sessiondata)
+		kv, err = mp.decode(sessiondata)
 		if err != nil {
 			return nil, err
 		}
 	}
-	rs := &MysqlSessionStore{c: c, sid: sid, values: kv}
+	rs := &MysqlSessionStore{c: c, sid: sid, values: kv, serializer: mp.serializerOption}
 	return rs, nil
 }
 
@@ -182,11 +316,64 @@ func (mp *MysqlProvider) SessionDestroy(sid string) error {
 	return nil
 }
 
-// SessionGC delete expired values in mysql session
+// SessionGC delete expired values in mysql session.
+// the expired sessions are selected for update and deleted in one transaction,
+// so a session saved again meanwhile is neither deleted nor reported as expired.
 func (mp *MysqlProvider) SessionGC() {
 	c := mp.connectInit()
-	c.Exec("DELETE from "+TableName+" where session_expiry < ?", time.Now().Unix()-mp.maxlifetime)
-	c.Close()
+	defer c.Close()
+	before := time.Now().Unix() - mp.maxlifetime
+	if mp.expired == nil {
+		if _, err := c.Exec("DELETE from "+TableName+" where session_expiry < ?", before); err != nil {
+			SLogger.Println("mysql: gc", err)
+		}
+		return
+	}
+	tx, err := c.Begin()
+	if err != nil {
+		SLogger.Println("mysql: gc", err)
+		return
+	}
+	expired, err := expiredSessions(tx, "select session_key from "+TableName+" where session_expiry < ? for update", before)
+	if err == nil {
+		_, err = tx.Exec("DELETE from "+TableName+" where session_expiry < ?", before)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		SLogger.Println("mysql: gc", err)
+		return
+	}
+	for _, sid := range expired {
+		mp.expired(sid)
+	}
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// expiredSessions returns the session keys returned by query.
+// the keys are trimmed of the padding of the tables created with char columns.
+func expiredSessions(q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sids []string
+	for rows.Next() {
+		var sid string
+		if err = rows.Scan(&sid); err != nil {
+			return nil, err
+		}
+		sids = append(sids, strings.TrimRight(sid, " "))
+	}
+	return sids, rows.Err()
 }
 
 // SessionAll count values in mysql session
@@ -201,6 +388,53 @@ func (mp *MysqlProvider) SessionAll() int {
 	return total
 }
 
+// MysqlUserIndex keeps the sessions of each user in the UserTableName table.
+type MysqlUserIndex struct {
+	mp *MysqlProvider
+}
+
+// UserIndex returns the index of the user sessions in mysql.
+func (mp *MysqlProvider) UserIndex() UserIndex {
+	return &MysqlUserIndex{mp: mp}
+}
+
+// Add records the session sid of the user uid.
+func (mi *MysqlUserIndex) Add(uid, sid string) error {
+	c := mi.mp.connectInit()
+	defer c.Close()
+	_, err := c.Exec("insert ignore into "+UserTableName+"(`user_id`,`session_key`,`created`) values(?,?,?)",
+		uid, sid, time.Now().UnixNano())
+	return err
+}
+
+// Remove forgets the session sid of the user uid.
+func (mi *MysqlUserIndex) Remove(uid, sid string) error {
+	c := mi.mp.connectInit()
+	defer c.Close()
+	_, err := c.Exec("DELETE FROM "+UserTableName+" where user_id=? and session_key=?", uid, sid)
+	return err
+}
+
+// Sessions returns the sessions of the user uid, the oldest first.
+func (mi *MysqlUserIndex) Sessions(uid string) ([]string, error) {
+	c := mi.mp.connectInit()
+	defer c.Close()
+	rows, err := c.Query("select session_key from "+UserTableName+" where user_id=? order by created", uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sids []string
+	for rows.Next() {
+		var sid string
+		if err = rows.Scan(&sid); err != nil {
+			return nil, err
+		}
+		sids = append(sids, sid)
+	}
+	return sids, rows.Err()
+}
+
 func init() {
 	Register("mysql", mysqlpder)
 }
@@ -0,0 +1,33 @@
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMysqlVersionedInsertError(t *testing.T) {
+	db, mock, err := sqlmock.NewWithDSN("mysql-versioned-insert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer func(name string) { MysqlDriverName = name }(MysqlDriverName)
+	MysqlDriverName = "sqlmock"
+
+	mock.ExpectQuery("select session_data, session_version from session where session_key=\\?").
+		WithArgs("sid").
+		WillReturnRows(sqlmock.NewRows([]string{"session_data", "session_version"}))
+	mock.ExpectExec("insert into session").
+		WithArgs("sid", "", sqlmock.AnyArg()).
+		WillReturnError(errors.New("insert failed"))
+
+	mp := &MysqlProvider{maxlifetime: 3600, savePath: "mysql-versioned-insert", versioned: true}
+	if _, err = mp.SessionRead("sid"); err == nil {
+		t.Fatal("the insert error of a new session should be returned")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
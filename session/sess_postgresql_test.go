@@ -0,0 +1,77 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockPostgresql(t *testing.T, versioned bool) (*PostgresqlProvider, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &PostgresqlProvider{db: db, maxlifetime: 3600, versioned: versioned}, mock
+}
+
+func TestPostgresqlUpsert(t *testing.T) {
+	p, mock := newMockPostgresql(t, false)
+	defer p.db.Close()
+
+	mock.ExpectQuery("SELECT session_data, session_expiry, session_version FROM session WHERE session_key = \\$1").
+		WithArgs("sid").
+		WillReturnRows(sqlmock.NewRows([]string{"session_data", "session_expiry", "session_version"}))
+	mock.ExpectExec("INSERT INTO session \\(session_key, session_data, session_expiry\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(session_key\\) DO UPDATE").
+		WithArgs("sid", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM session WHERE session_expiry < \\$1").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	sess, err := p.SessionRead("sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Set("username", "user001")
+	sess.SessionRelease(httptest.NewRecorder())
+	p.SessionGC()
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresqlVersionConflict(t *testing.T) {
+	p, mock := newMockPostgresql(t, true)
+	defer p.db.Close()
+
+	saved, err := EncodeGob(map[interface{}]interface{}{"theme": "dark"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []string{"session_data", "session_expiry", "session_version"}
+	mock.ExpectQuery("SELECT session_data").WithArgs("sid").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow([]byte{}, int64(1<<40), 1))
+	// another request saved version 2 in the meantime.
+	mock.ExpectExec("INSERT INTO session .* WHERE session.session_version = \\$4").
+		WithArgs("sid", sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT session_data").WithArgs("sid").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(saved, int64(1<<40), 2))
+	mock.ExpectExec("INSERT INTO session .* WHERE session.session_version = \\$4").
+		WithArgs("sid", sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sess, err := p.SessionRead("sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Set("username", "user001")
+	sess.SessionRelease(httptest.NewRecorder())
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if sess.Get("theme") != "dark" || sess.Get("username") != "user001" {
+		t.Fatal("merge error", sess.Get("theme"), sess.Get("username"))
+	}
+}
@@ -32,6 +32,9 @@ type RedisSessionStore struct {
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
 	maxlifetime int64
+	hash        bool // saved as a hash, only the dirty keys are written
+	dirty       *dirtyKeys
+	serializer  serializerOption
 }
 
 // Set value in redis session
@@ -39,6 +42,9 @@ func (rs *RedisSessionStore) Set(key, value interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values[key] = value
+	if rs.dirty != nil {
+		rs.dirty.markSet(key)
+	}
 	return nil
 }
 
@@ -57,6 +63,9 @@ func (rs *RedisSessionStore) Delete(key interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	delete(rs.values, key)
+	if rs.dirty != nil {
+		rs.dirty.markDelete(key)
+	}
 	return nil
 }
 
@@ -65,6 +74,9 @@ func (rs *RedisSessionStore) Flush() error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values = make(map[interface{}]interface{})
+	if rs.dirty != nil {
+		rs.dirty.markFlush()
+	}
 	return nil
 }
 
@@ -75,7 +87,13 @@ func (rs *RedisSessionStore) SessionID() string {
 
 // SessionRelease save session values to redis
 func (rs *RedisSessionStore) SessionRelease(w http.ResponseWriter) {
-	b, err := EncodeGob(rs.values)
+	if rs.hash {
+		if err := rs.releaseHash(); err != nil {
+			SLogger.Println("redis: save session", rs.sid, err)
+		}
+		return
+	}
+	b, err := rs.serializer.encode(rs.values)
 	if err != nil {
 		return
 	}
@@ -84,14 +102,62 @@ func (rs *RedisSessionStore) SessionRelease(w http.ResponseWriter) {
 	c.Do("SETEX", rs.sid, rs.maxlifetime, string(b))
 }
 
+// releaseHash writes the dirty keys to the session hash in a transaction.
+func (rs *RedisSessionStore) releaseHash() error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	fields, del, err := hashChanges(rs.serializer, rs.dirty, rs.values)
+	if err != nil {
+		return err
+	}
+	c := rs.p.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	if rs.dirty.flushed {
+		c.Send("DEL", rs.sid)
+	}
+	if len(del) > 0 {
+		c.Send("HDEL", redis.Args{}.Add(rs.sid).AddFlat(del)...)
+	}
+	c.Send("HMSET", redis.Args{}.Add(rs.sid).AddFlat(fields)...)
+	c.Send("EXPIRE", rs.sid, rs.maxlifetime)
+	if err = execError(c.Do("EXEC")); err != nil {
+		return err
+	}
+	rs.dirty.reset()
+	return nil
+}
+
+// execError returns the error of EXEC or of the first command of the
+// transaction that failed, EXEC itself succeeding when a command fails.
+func execError(reply interface{}, err error) error {
+	replies, err := redis.Values(reply, err)
+	if err != nil {
+		return err
+	}
+	for _, r := range replies {
+		if e, ok := r.(redis.Error); ok {
+			return e
+		}
+	}
+	return nil
+}
+
 // RedisProvider redis session provider
 type RedisProvider struct {
+	serializerOption
 	maxlifetime int64
 	savePath    string
 	poolsize    int
 	password    string
 	dbNum       int
 	poollist    *redis.Pool
+	hash        bool
+}
+
+// SetDirtyTracking saves the sessions as hashes and writes only the changed keys.
+func (rp *RedisProvider) SetDirtyTracking(enable bool) {
+	rp.hash = enable
 }
 
 // SessionInit init redis session
@@ -165,6 +231,9 @@ func (rp *RedisProvider) SessionInit(maxlifetime int64, savePath string) error {
 
 // SessionRead read redis session by sid
 func (rp *RedisProvider) SessionRead(sid string) (Store, error) {
+	if rp.hash {
+		return rp.sessionReadHash(sid)
+	}
 	c := rp.poollist.Get()
 	defer c.Close()
 
@@ -177,12 +246,42 @@ func (rp *RedisProvider) SessionRead(sid string) (Store, error) {
 	if len(kvs) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		if kv, err = DecodeGob([]byte(kvs)); err != nil {
+		if kv, err = rp.decode([]byte(kvs)); err != nil {
 			return nil, err
 		}
 	}
 
-	rs := &RedisSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime}
+	rs := &RedisSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime, serializer: rp.serializerOption}
+	return rs, nil
+}
+
+// sessionReadHash reads a session saved as a hash.
+// a session saved as a single value is rewritten as a hash on release.
+func (rp *RedisProvider) sessionReadHash(sid string) (Store, error) {
+	c := rp.poollist.Get()
+	defer c.Close()
+
+	rs := &RedisSessionStore{p: rp.poollist, sid: sid, maxlifetime: rp.maxlifetime, hash: true, dirty: &dirtyKeys{}, serializer: rp.serializerOption}
+	fields, err := redis.StringMap(c.Do("HGETALL", sid))
+	if isWrongType(err) {
+		rs.dirty.flushed = true
+		kvs, err := redis.String(c.Do("GET", sid))
+		if err != nil {
+			return nil, err
+		}
+		if len(kvs) == 0 {
+			rs.values = make(map[interface{}]interface{})
+		} else if rs.values, err = rp.decode([]byte(kvs)); err != nil {
+			return nil, err
+		}
+		return rs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rs.values, err = decodeHash(rp.serializerOption, fields); err != nil {
+		return nil, err
+	}
 	return rs, nil
 }
 
@@ -206,7 +305,12 @@ func (rp *RedisProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 		// oldsid doesn't exists, set the new sid directly
 		// ignore error here, since if it return error
 		// the existed value will be 0
-		c.Do("SET", sid, "", "EX", rp.maxlifetime)
+		if rp.hash {
+			c.Do("HSET", sid, hashMetaField, 1)
+			c.Do("EXPIRE", sid, rp.maxlifetime)
+		} else {
+			c.Do("SET", sid, "", "EX", rp.maxlifetime)
+		}
 	} else {
 		c.Do("RENAME", oldsid, sid)
 		c.Do("EXPIRE", sid, rp.maxlifetime)
@@ -235,3 +339,45 @@ func (rp *RedisProvider) SessionAll() int {
 func init() {
 	Register("redis", redispder)
 }
+
+// RedisUserIndexPrefix prefixes the keys of the user index in redis.
+var RedisUserIndexPrefix = "session_user:"
+
+// RedisUserIndex keeps the sessions of each user in a sorted set,
+// scored by the time they were added.
+type RedisUserIndex struct {
+	p           *redis.Pool
+	maxlifetime int64
+}
+
+// UserIndex returns the index of the user sessions in redis.
+func (rp *RedisProvider) UserIndex() UserIndex {
+	return &RedisUserIndex{p: rp.poollist, maxlifetime: rp.maxlifetime}
+}
+
+// Add records the session sid of the user uid.
+// the index of a user expires with the last session added.
+func (ri *RedisUserIndex) Add(uid, sid string) error {
+	c := ri.p.Get()
+	defer c.Close()
+	key := RedisUserIndexPrefix + uid
+	c.Send("MULTI")
+	c.Send("ZADD", key, time.Now().UnixNano()/int64(time.Millisecond), sid)
+	c.Send("EXPIRE", key, ri.maxlifetime)
+	return execError(c.Do("EXEC"))
+}
+
+// Remove forgets the session sid of the user uid.
+func (ri *RedisUserIndex) Remove(uid, sid string) error {
+	c := ri.p.Get()
+	defer c.Close()
+	_, err := c.Do("ZREM", RedisUserIndexPrefix+uid, sid)
+	return err
+}
+
+// Sessions returns the sessions of the user uid, the oldest first.
+func (ri *RedisUserIndex) Sessions(uid string) ([]string, error) {
+	c := ri.p.Get()
+	defer c.Close()
+	return redis.Strings(c.Do("ZRANGE", RedisUserIndexPrefix+uid, 0, -1))
+}
@@ -34,6 +34,9 @@ type RedisClusterSessionStore struct {
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
 	maxlifetime int64
+	hash        bool // saved as a hash, only the dirty keys are written
+	dirty       *dirtyKeys
+	serializer  serializerOption
 }
 
 // Set value in redis_cluster session
@@ -41,6 +44,9 @@ func (rs *RedisClusterSessionStore) Set(key, value interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values[key] = value
+	if rs.dirty != nil {
+		rs.dirty.markSet(key)
+	}
 	return nil
 }
 
@@ -59,6 +65,9 @@ func (rs *RedisClusterSessionStore) Delete(key interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	delete(rs.values, key)
+	if rs.dirty != nil {
+		rs.dirty.markDelete(key)
+	}
 	return nil
 }
 
@@ -67,6 +76,9 @@ func (rs *RedisClusterSessionStore) Flush() error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values = make(map[interface{}]interface{})
+	if rs.dirty != nil {
+		rs.dirty.markFlush()
+	}
 	return nil
 }
 
@@ -77,7 +89,15 @@ func (rs *RedisClusterSessionStore) SessionID() string {
 
 // SessionRelease save session values to redis_cluster
 func (rs *RedisClusterSessionStore) SessionRelease(w http.ResponseWriter) {
-	b, err := EncodeGob(rs.values)
+	if rs.hash {
+		rs.lock.Lock()
+		defer rs.lock.Unlock()
+		if err := releaseRedisHash(rs.p, rs.sid, rs.values, rs.dirty, rs.serializer, rs.maxlifetime); err != nil {
+			SLogger.Println("redis_cluster: save session", rs.sid, err)
+		}
+		return
+	}
+	b, err := rs.serializer.encode(rs.values)
 	if err != nil {
 		return
 	}
@@ -87,12 +107,19 @@ func (rs *RedisClusterSessionStore) SessionRelease(w http.ResponseWriter) {
 
 // RedisClusterProvider redis_cluster session provider
 type RedisClusterProvider struct {
+	serializerOption
 	maxlifetime int64
 	savePath    string
 	poolsize    int
 	password    string
 	dbNum       int
 	poollist    *rediss.ClusterClient
+	hash        bool
+}
+
+// SetDirtyTracking saves the sessions as hashes and writes only the changed keys.
+func (rp *RedisClusterProvider) SetDirtyTracking(enable bool) {
+	rp.hash = enable
 }
 
 // SessionInit init redis_cluster session
@@ -138,6 +165,13 @@ func (rp *RedisClusterProvider) SessionInit(maxlifetime int64, savePath string)
 
 // SessionRead read redis_cluster session by sid
 func (rp *RedisClusterProvider) SessionRead(sid string) (Store, error) {
+	if rp.hash {
+		kv, dirty, err := readRedisHash(rp.serializerOption, rp.poollist, sid)
+		if err != nil {
+			return nil, err
+		}
+		return &RedisClusterSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime, hash: true, dirty: dirty, serializer: rp.serializerOption}, nil
+	}
 	var kv map[interface{}]interface{}
 	kvs, err := rp.poollist.Get(sid).Result()
 	if err != nil && err != rediss.Nil {
@@ -146,12 +180,12 @@ func (rp *RedisClusterProvider) SessionRead(sid string) (Store, error) {
 	if len(kvs) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		if kv, err = DecodeGob([]byte(kvs)); err != nil {
+		if kv, err = rp.decode([]byte(kvs)); err != nil {
 			return nil, err
 		}
 	}
 
-	rs := &RedisClusterSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime}
+	rs := &RedisClusterSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime, serializer: rp.serializerOption}
 	return rs, nil
 }
 
@@ -172,7 +206,12 @@ func (rp *RedisClusterProvider) SessionRegenerate(oldsid, sid string) (Store, er
 		// oldsid doesn't exists, set the new sid directly
 		// ignore error here, since if it return error
 		// the existed value will be 0
-		c.Set(sid, "", time.Duration(rp.maxlifetime)*time.Second)
+		if rp.hash {
+			c.HSet(sid, hashMetaField, 1)
+			c.Expire(sid, time.Duration(rp.maxlifetime)*time.Second)
+		} else {
+			c.Set(sid, "", time.Duration(rp.maxlifetime)*time.Second)
+		}
 	} else {
 		c.Rename(oldsid, sid)
 		c.Expire(sid, time.Duration(rp.maxlifetime)*time.Second)
@@ -187,6 +226,11 @@ func (rp *RedisClusterProvider) SessionDestroy(sid string) error {
 	return nil
 }
 
+// UserIndex returns the index of the user sessions in redis.
+func (rp *RedisClusterProvider) UserIndex() UserIndex {
+	return &goRedisUserIndex{c: rp.poollist, maxlifetime: rp.maxlifetime}
+}
+
 // SessionGC Impelment method, no used.
 func (rp *RedisClusterProvider) SessionGC() {
 }
@@ -32,6 +32,9 @@ type RedisSentinelSessionStore struct {
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
 	maxlifetime int64
+	hash        bool // saved as a hash, only the dirty keys are written
+	dirty       *dirtyKeys
+	serializer  serializerOption
 }
 
 // Set value in redis_sentinel session
@@ -39,6 +42,9 @@ func (rs *RedisSentinelSessionStore) Set(key, value interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values[key] = value
+	if rs.dirty != nil {
+		rs.dirty.markSet(key)
+	}
 	return nil
 }
 
@@ -57,6 +63,9 @@ func (rs *RedisSentinelSessionStore) Delete(key interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	delete(rs.values, key)
+	if rs.dirty != nil {
+		rs.dirty.markDelete(key)
+	}
 	return nil
 }
 
@@ -65,6 +74,9 @@ func (rs *RedisSentinelSessionStore) Flush() error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values = make(map[interface{}]interface{})
+	if rs.dirty != nil {
+		rs.dirty.markFlush()
+	}
 	return nil
 }
 
@@ -75,7 +87,15 @@ func (rs *RedisSentinelSessionStore) SessionID() string {
 
 // SessionRelease save session values to redis_sentinel
 func (rs *RedisSentinelSessionStore) SessionRelease(w http.ResponseWriter) {
-	b, err := EncodeGob(rs.values)
+	if rs.hash {
+		rs.lock.Lock()
+		defer rs.lock.Unlock()
+		if err := releaseRedisHash(rs.p, rs.sid, rs.values, rs.dirty, rs.serializer, rs.maxlifetime); err != nil {
+			SLogger.Println("redis_sentinel: save session", rs.sid, err)
+		}
+		return
+	}
+	b, err := rs.serializer.encode(rs.values)
 	if err != nil {
 		return
 	}
@@ -85,15 +105,22 @@ func (rs *RedisSentinelSessionStore) SessionRelease(w http.ResponseWriter) {
 
 // RedisSentinelProvider redis_sentinel session provider
 type RedisSentinelProvider struct {
+	serializerOption
 	maxlifetime int64
 	savePath    string
 	poolsize    int
 	password    string
 	dbNum       int
 	poollist    *redis.Client
+	hash        bool
 	masterName  string
 }
 
+// SetDirtyTracking saves the sessions as hashes and writes only the changed keys.
+func (rp *RedisSentinelProvider) SetDirtyTracking(enable bool) {
+	rp.hash = enable
+}
+
 // SessionInit init redis_sentinel session
 // savepath like redis sentinel addr,pool size,password,dbnum,masterName
 // e.g. 127.0.0.1:26379;127.0.0.2:26379,100,1qaz2wsx,0,mymaster
@@ -149,6 +176,13 @@ func (rp *RedisSentinelProvider) SessionInit(maxlifetime int64, savePath string)
 
 // SessionRead read redis_sentinel session by sid
 func (rp *RedisSentinelProvider) SessionRead(sid string) (Store, error) {
+	if rp.hash {
+		kv, dirty, err := readRedisHash(rp.serializerOption, rp.poollist, sid)
+		if err != nil {
+			return nil, err
+		}
+		return &RedisSentinelSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime, hash: true, dirty: dirty, serializer: rp.serializerOption}, nil
+	}
 	var kv map[interface{}]interface{}
 	kvs, err := rp.poollist.Get(sid).Result()
 	if err != nil && err != redis.Nil {
@@ -157,12 +191,12 @@ func (rp *RedisSentinelProvider) SessionRead(sid string) (Store, error) {
 	if len(kvs) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		if kv, err = DecodeGob([]byte(kvs)); err != nil {
+		if kv, err = rp.decode([]byte(kvs)); err != nil {
 			return nil, err
 		}
 	}
 
-	rs := &RedisSentinelSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime}
+	rs := &RedisSentinelSessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime, serializer: rp.serializerOption}
 	return rs, nil
 }
 
@@ -183,7 +217,12 @@ func (rp *RedisSentinelProvider) SessionRegenerate(oldsid, sid string) (Store, e
 		// oldsid doesn't exists, set the new sid directly
 		// ignore error here, since if it return error
 		// the existed value will be 0
-		c.Set(sid, "", time.Duration(rp.maxlifetime)*time.Second)
+		if rp.hash {
+			c.HSet(sid, hashMetaField, 1)
+			c.Expire(sid, time.Duration(rp.maxlifetime)*time.Second)
+		} else {
+			c.Set(sid, "", time.Duration(rp.maxlifetime)*time.Second)
+		}
 	} else {
 		c.Rename(oldsid, sid)
 		c.Expire(sid, time.Duration(rp.maxlifetime)*time.Second)
@@ -203,6 +242,11 @@ func (rp *RedisSentinelProvider) SessionAll() int {
 	return 0
 }
 
+// UserIndex returns the index of the user sessions in redis.
+func (rp *RedisSentinelProvider) UserIndex() UserIndex {
+	return &goRedisUserIndex{c: rp.poollist, maxlifetime: rp.maxlifetime}
+}
+
 // SessionGC Impelment method, no used.
 func (rp *RedisSentinelProvider) SessionGC() {
 }
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Serializer encodes the values of a session before a provider saves them.
+// the payloads are saved as the serializer writes them, without tag,
+// so the sessions saved with json or msgpack are read by other languages.
+// usage:
+//	session.RegisterSerializer("yaml", yamlSerializer{}) // run in init.
+//	globalSessions, _ = session.NewManager("redis", &session.ManagerConfig{Serializer: "yaml", ...})
+type Serializer interface {
+	Serialize(values map[interface{}]interface{}) ([]byte, error)
+	Deserialize(data []byte) (map[interface{}]interface{}, error)
+}
+
+// SerializerProvider is implemented by the providers able to save the sessions
+// with the serializer chosen in ManagerConfig.Serializer.
+// the cookie and memory providers always use gob.
+type SerializerProvider interface {
+	Provider
+	SetSerializer(name string) error
+}
+
+var serializers = make(map[string]Serializer)
+
+// RegisterSerializer makes a serializer available by the provided name.
+// If RegisterSerializer is called twice with the same name or if s is nil,
+// it panics.
+func RegisterSerializer(name string, s Serializer) {
+	if s == nil {
+		panic("session: RegisterSerializer serializer is nil")
+	}
+	if _, dup := serializers[name]; dup {
+		panic("session: RegisterSerializer called twice for serializer " + name)
+	}
+	serializers[name] = s
+}
+
+// GetSerializer returns the serializer registered with name.
+func GetSerializer(name string) (Serializer, error) {
+	s, ok := serializers[name]
+	if !ok {
+		return nil, fmt.Errorf("session: unknown serializer %q", name)
+	}
+	return s, nil
+}
+
+// serializerOption is embedded by the providers to implement SerializerProvider,
+// and copied to their stores to encode the values on release.
+type serializerOption struct {
+	serializer Serializer
+}
+
+// SetSerializer saves the sessions with the serializer registered with name,
+// an empty name keeps gob.
+func (o *serializerOption) SetSerializer(name string) error {
+	if name == "" {
+		o.serializer = nil
+		return nil
+	}
+	s, ok := serializers[name]
+	if !ok {
+		return fmt.Errorf("session: unknown serializer %q", name)
+	}
+	o.serializer = s
+	return nil
+}
+
+func (o serializerOption) encode(values map[interface{}]interface{}) ([]byte, error) {
+	if o.serializer == nil {
+		return EncodeGob(values)
+	}
+	return o.serializer.Serialize(values)
+}
+
+// decode decodes a payload written by the serializer of o. the gob payloads
+// saved before the serializer was configured are still read, so a running
+// site can switch.
+func (o serializerOption) decode(data []byte) (map[interface{}]interface{}, error) {
+	if o.serializer == nil {
+		return DecodeGob(data)
+	}
+	values, err := o.serializer.Deserialize(data)
+	if err != nil {
+		if kv, gobErr := DecodeGob(data); gobErr == nil {
+			return kv, nil
+		}
+	}
+	return values, err
+}
+
+// gobSerializer writes gob payloads.
+type gobSerializer struct{}
+
+func (gobSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	return EncodeGob(values)
+}
+
+func (gobSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	return DecodeGob(data)
+}
+
+// jsonSerializer writes the values as a json object.
+// the keys are formatted as strings, numbers are read back as float64
+// and structs as map[string]interface{}.
+type jsonSerializer struct{}
+
+func (jsonSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		m[fmt.Sprint(k)] = v
+	}
+	return json.Marshal(m)
+}
+
+func (jsonSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	values := make(map[interface{}]interface{}, len(m))
+	for k, v := range m {
+		values[k] = v
+	}
+	return values, nil
+}
+
+// msgpackSerializer writes the values as a msgpack map, the struct fields
+// are named after their json tags. integers are read back as int64 or uint64
+// and structs as maps.
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).UseJSONTag(true).Encode(values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	var values map[interface{}]interface{}
+	dec := msgpack.NewDecoder(bytes.NewReader(data)).UseDecodeInterfaceLoose(true).UseJSONTag(true)
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = make(map[interface{}]interface{})
+	}
+	return values, nil
+}
+
+func init() {
+	RegisterSerializer("gob", gobSerializer{})
+	RegisterSerializer("json", jsonSerializer{})
+	RegisterSerializer("msgpack", msgpackSerializer{})
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSerializers(t *testing.T) {
+	values := map[interface{}]interface{}{"username": "user001", "count": 3}
+	for _, name := range []string{"gob", "json", "msgpack"} {
+		var o serializerOption
+		if err := o.SetSerializer(name); err != nil {
+			t.Fatal(err)
+		}
+		b, err := o.encode(values)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		kv, err := o.decode(b)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if kv["username"] != "user001" {
+			t.Fatal(name, "decode string error", kv)
+		}
+		switch count := kv["count"].(type) {
+		case int, int64, float64:
+		default:
+			t.Fatalf("%s: decode int error %T", name, count)
+		}
+	}
+
+	// the sessions saved before the serializer was configured are still gob.
+	var o serializerOption
+	if err := o.SetSerializer("json"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncodeGob(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv, err := o.decode(b); err != nil || kv["count"] != 3 {
+		t.Fatal("decode gob error", err)
+	}
+	if err = o.SetSerializer("xml"); err == nil {
+		t.Fatal("unknown serializer must fail")
+	}
+}
+
+func TestFileJSONSerializer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer filepder.SetSerializer("")
+
+	globalSessions, err := NewManager("file", &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, ProviderConfig: dir, Serializer: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid := "0123456789abcdef"
+	sess, err := globalSessions.GetSessionStore(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Set("username", "user001")
+	sess.SessionRelease(httptest.NewRecorder())
+
+	b, err := ioutil.ReadFile(path.Join(dir, "0", "1", sid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte(`{"username":"user001"}`)) {
+		t.Fatalf("json payload error %q", b)
+	}
+	if sess, _ = globalSessions.GetSessionStore(sid); sess.Get("username") != "user001" {
+		t.Fatal("read json session error")
+	}
+
+	if _, err = NewManager("file", &ManagerConfig{CookieName: "gosessionid", ProviderConfig: dir, Serializer: "xml"}); err == nil {
+		t.Fatal("unknown serializer must fail")
+	}
+}
@@ -0,0 +1,243 @@
+//
+// sqlite session support stores the sessions in a single file, for the
+// deployments running one node. the table is created as:
+//	CREATE TABLE IF NOT EXISTS session (
+//	session_key TEXT NOT NULL PRIMARY KEY,
+//	session_data BLOB,
+//	session_expiry INTEGER NOT NULL
+//	);
+//	CREATE INDEX IF NOT EXISTS session_expiry_idx ON session (session_expiry);
+//
+// the database is opened in WAL mode with the pure-Go driver modernc.org/sqlite,
+// and the writes of concurrent requests are committed together in one transaction.
+// a ProviderConfig like "orm:default" uses the sqlite database registered
+// with orm.RegisterDataBase under the alias default.
+//
+// Usage:
+// import(
+//   "libs/session"
+// )
+//
+//	func init() {
+//		globalSessions, _ = session.NewManager("sqlite", &session.ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, ProviderConfig: "./data/session.db"})
+//		go globalSessions.GC()
+//	}
+//
+package session
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+
+	"libs/clock"
+	"libs/internal/sqlitedb"
+)
+
+var (
+	// SqliteTableName store the session in sqlite
+	SqliteTableName = "session"
+	sqlitepder     = &SqliteProvider{}
+)
+
+// SqliteSessionStore sqlite session store
+type SqliteSessionStore struct {
+	p          *SqliteProvider
+	sid        string
+	lock       sync.RWMutex
+	values     map[interface{}]interface{}
+	serializer serializerOption
+}
+
+// Set value in sqlite session.
+// it is temp value in map.
+func (st *SqliteSessionStore) Set(key, value interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values[key] = value
+	return nil
+}
+
+// Get value from sqlite session
+func (st *SqliteSessionStore) Get(key interface{}) interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if v, ok := st.values[key]; ok {
+		return v
+	}
+	return nil
+}
+
+// Delete value in sqlite session
+func (st *SqliteSessionStore) Delete(key interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.values, key)
+	return nil
+}
+
+// Flush clear all values in sqlite session
+func (st *SqliteSessionStore) Flush() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values = make(map[interface{}]interface{})
+	return nil
+}
+
+// SessionID get session id of this sqlite session store
+func (st *SqliteSessionStore) SessionID() string {
+	return st.sid
+}
+
+// SessionRelease save sqlite session values to database.
+// it waits for the batch holding the write to be committed.
+func (st *SqliteSessionStore) SessionRelease(w http.ResponseWriter) {
+	st.lock.RLock()
+	b, err := st.serializer.encode(st.values)
+	st.lock.RUnlock()
+	if err == nil {
+		_, err = st.p.db.Write("INSERT INTO "+SqliteTableName+" (session_key, session_data, session_expiry) VALUES (?, ?, ?) "+
+			"ON CONFLICT (session_key) DO UPDATE SET session_data = excluded.session_data, session_expiry = excluded.session_expiry",
+			st.sid, b, st.p.now()+st.p.maxlifetime)
+	}
+	if err != nil {
+		SLogger.Println("sqlite: save session", st.sid, err)
+	}
+}
+
+// SqliteProvider sqlite session provider
+type SqliteProvider struct {
+	serializerOption
+	maxlifetime int64
+	savePath    string
+	db          *sqlitedb.DB
+	expired     func(sid string)
+	clock       clock.Clock
+}
+
+// SetExpiredFunc sets the function called with the sessions removed by SessionGC.
+func (sp *SqliteProvider) SetExpiredFunc(fn func(sid string)) {
+	sp.expired = fn
+}
+
+// SetClock sets the clock the sessions expire with, the system time by default.
+func (sp *SqliteProvider) SetClock(c clock.Clock) {
+	sp.clock = c
+}
+
+func (sp *SqliteProvider) now() int64 {
+	return clock.Or(sp.clock).Now().Unix()
+}
+
+// SessionInit init sqlite session.
+// savepath is the path of the database file, created with the table if missing,
+// or orm:alias for a database registered with the orm.
+func (sp *SqliteProvider) SessionInit(maxlifetime int64, savePath string) error {
+	sp.maxlifetime = maxlifetime
+	sp.savePath = savePath
+	db, err := sqlitedb.Open(savePath)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + SqliteTableName + ` (
+		session_key TEXT NOT NULL PRIMARY KEY,
+		session_data BLOB,
+		session_expiry INTEGER NOT NULL)`)
+	if err == nil {
+		_, err = db.Exec("CREATE INDEX IF NOT EXISTS " + SqliteTableName + "_expiry_idx ON " + SqliteTableName + " (session_expiry)")
+	}
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if sp.db != nil {
+		sp.db.Close()
+	}
+	sp.db = db
+	return nil
+}
+
+// SessionRead get sqlite session by sid
+func (sp *SqliteProvider) SessionRead(sid string) (Store, error) {
+	var sessiondata []byte
+	err := sp.db.QueryRow("SELECT session_data FROM "+SqliteTableName+" WHERE session_key = ? AND session_expiry >= ?",
+		sid, sp.now()).Scan(&sessiondata)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	kv := make(map[interface{}]interface{})
+	if len(sessiondata) > 0 {
+		if kv, err = sp.decode(sessiondata); err != nil {
+			return nil, err
+		}
+	}
+	return &SqliteSessionStore{p: sp, sid: sid, values: kv, serializer: sp.serializerOption}, nil
+}
+
+// SessionExist check sqlite session exist
+func (sp *SqliteProvider) SessionExist(sid string) bool {
+	var n int
+	err := sp.db.QueryRow("SELECT 1 FROM "+SqliteTableName+" WHERE session_key = ? AND session_expiry >= ?",
+		sid, sp.now()).Scan(&n)
+	return err == nil
+}
+
+// SessionRegenerate generate new sid for sqlite session
+func (sp *SqliteProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
+	if _, err := sp.db.Write("UPDATE "+SqliteTableName+" SET session_key = ? WHERE session_key = ?", sid, oldsid); err != nil {
+		return nil, err
+	}
+	return sp.SessionRead(sid)
+}
+
+// SessionDestroy delete sqlite session by sid
+func (sp *SqliteProvider) SessionDestroy(sid string) error {
+	_, err := sp.db.Write("DELETE FROM "+SqliteTableName+" WHERE session_key = ?", sid)
+	return err
+}
+
+// SessionGC delete expired sessions in sqlite, with the session_expiry index.
+// the deleted sessions are returned by the delete, so a session saved
+// again meanwhile is not reported as expired.
+func (sp *SqliteProvider) SessionGC() {
+	var expired []string
+	err := sp.db.WriteTx(func(tx *sql.Tx) error {
+		expired = expired[:0]
+		rows, err := tx.Query("DELETE FROM "+SqliteTableName+" WHERE session_expiry < ? RETURNING session_key", sp.now())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sid string
+			if err = rows.Scan(&sid); err != nil {
+				return err
+			}
+			expired = append(expired, sid)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		SLogger.Println("sqlite: gc", err)
+		return
+	}
+	if sp.expired != nil {
+		for _, sid := range expired {
+			sp.expired(sid)
+		}
+	}
+}
+
+// SessionAll count the active sessions in sqlite
+func (sp *SqliteProvider) SessionAll() int {
+	var total int
+	err := sp.db.QueryRow("SELECT count(*) FROM "+SqliteTableName+" WHERE session_expiry >= ?", sp.now()).Scan(&total)
+	if err != nil {
+		return 0
+	}
+	return total
+}
+
+func init() {
+	Register("sqlite", sqlitepder)
+}
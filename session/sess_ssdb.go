@@ -14,6 +14,7 @@ var ssdbProvider = &SsdbProvider{}
 
 // SsdbProvider holds ssdb client and configs
 type SsdbProvider struct {
+	serializerOption
 	client      *ssdb.Client
 	host        string
 	port        int
@@ -57,12 +58,12 @@ func (p *SsdbProvider) SessionRead(sid string) (Store, error) {
 	if value == nil || len(value.(string)) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = DecodeGob([]byte(value.(string)))
+		kv, err = p.decode([]byte(value.(string)))
 		if err != nil {
 			return nil, err
 		}
 	}
-	rs := &SsdbSessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, client: p.client}
+	rs := &SsdbSessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, client: p.client, serializer: p.serializerOption}
 	return rs, nil
 }
 
@@ -99,7 +100,7 @@ func (p *SsdbProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 	if value == nil || len(value.(string)) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = DecodeGob([]byte(value.(string)))
+		kv, err = p.decode([]byte(value.(string)))
 		if err != nil {
 			return nil, err
 		}
@@ -112,7 +113,7 @@ func (p *SsdbProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 	if e != nil {
 		return nil, e
 	}
-	rs := &SsdbSessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, client: p.client}
+	rs := &SsdbSessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, client: p.client, serializer: p.serializerOption}
 	return rs, nil
 }
 
@@ -143,6 +144,7 @@ type SsdbSessionStore struct {
 	values      map[interface{}]interface{}
 	maxLifetime int64
 	client      *ssdb.Client
+	serializer  serializerOption
 }
 
 // Set the key and value
@@ -186,7 +188,7 @@ func (s *SsdbSessionStore) SessionID() string {
 
 // SessionRelease Store the keyvalues into ssdb
 func (s *SsdbSessionStore) SessionRelease(w http.ResponseWriter) {
-	b, err := EncodeGob(s.values)
+	b, err := s.serializer.encode(s.values)
 	if err != nil {
 		return
 	}
@@ -1,9 +1,11 @@
 package session
 
 import (
-	"crypto/aes"
 	"encoding/json"
 	"testing"
+	"time"
+
+	"libs/clock"
 )
 
 func Test_gob(t *testing.T) {
@@ -46,21 +48,21 @@ func TestGenerate(t *testing.T) {
 }
 
 func TestCookieEncodeDecode(t *testing.T) {
-	hashKey := "testhashKey"
-	blockkey := generateRandomKey(16)
-	block, err := aes.NewCipher(blockkey)
+	key, err := newCookieKey(string(generateRandomKey(16)), "testhashKey")
 	if err != nil {
-		t.Fatal("NewCipher:", err)
+		t.Fatal("newCookieKey:", err)
 	}
 	securityName := string(generateRandomKey(20))
 	val := make(map[interface{}]interface{})
 	val["name"] = "user001"
 	val["gender"] = "male"
-	str, err := encodeCookie(block, hashKey, securityName, val)
+	c := clock.NewFake(time.Now())
+	str, err := encodeCookie(key, securityName, val, c.Now())
 	if err != nil {
 		t.Fatal("encodeCookie:", err)
 	}
-	dst, err := decodeCookie(block, hashKey, securityName, str, 3600)
+	c.Advance(time.Hour)
+	dst, err := decodeCookie([]*cookieKey{key}, securityName, str, 3600, c.Now())
 	if err != nil {
 		t.Fatal("decodeCookie", err)
 	}
@@ -70,6 +72,10 @@ func TestCookieEncodeDecode(t *testing.T) {
 	if dst["gender"] != "male" {
 		t.Fatal("dst get map error")
 	}
+	c.Advance(time.Second)
+	if _, err = decodeCookie([]*cookieKey{key}, securityName, str, 3600, c.Now()); err == nil {
+		t.Fatal("expired cookie decoded")
+	}
 }
 
 func TestParseConfig(t *testing.T) {
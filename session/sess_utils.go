@@ -2,15 +2,16 @@ package session
 
 import (
 	"bytes"
+	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/gob"
 	"errors"
-	"fmt"
 	"io"
 	"strconv"
 	"time"
@@ -64,20 +65,32 @@ func generateRandomKey(strength int) []byte {
 
 // Encryption -----------------------------------------------------------------
 
-// encrypt encrypts a value using the given block in counter mode.
-//
-// A random initialization vector (http://goo.gl/zF67k) with the length of the
-// block size is prepended to the resulting ciphertext.
-func encrypt(block cipher.Block, value []byte) ([]byte, error) {
-	iv := generateRandomKey(block.BlockSize())
-	if iv == nil {
-		return nil, errors.New("encrypt: failed to generate random iv")
-	}
-	// Encrypt it.
-	stream := cipher.NewCTR(block, iv)
-	stream.XORKeyStream(value, value)
-	// Return iv + ciphertext.
-	return append(iv, value...), nil
+// cookieKey is a key of the cookie keyring.
+type cookieKey struct {
+	aead cipher.AEAD
+	// block and hashKey read the cookies encrypted in counter mode
+	// and signed with hmac-sha1 before aes-gcm was used.
+	block   cipher.Block
+	hashKey string
+}
+
+// newCookieKey returns the key made of blockKey and hashKey.
+// the aes-256-gcm key is the hmac-sha256 of blockKey with hashKey.
+func newCookieKey(blockKey, hashKey string) (*cookieKey, error) {
+	h := hmac.New(sha256.New, []byte(hashKey))
+	h.Write([]byte(blockKey))
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k := &cookieKey{aead: aead, hashKey: hashKey}
+	// blockKey is not always a valid aes key, such a key only reads aes-gcm cookies.
+	k.block, _ = aes.NewCipher([]byte(blockKey))
+	return k, nil
 }
 
 // decrypt decrypts a value using the given block in counter mode.
@@ -99,76 +112,114 @@ func decrypt(block cipher.Block, value []byte) ([]byte, error) {
 	return nil, errors.New("decrypt: the value could not be decrypted")
 }
 
-func encodeCookie(block cipher.Block, hashKey, name string, value map[interface{}]interface{}) (string, error) {
+// encodeCookie encrypts value with key in aes-gcm, authenticating name and the date.
+// the cookie is base64("date|" + base64(nonce + ciphertext)).
+func encodeCookie(key *cookieKey, name string, value map[interface{}]interface{}, now time.Time) (string, error) {
 	var err error
 	var b []byte
 	// 1. EncodeGob.
 	if b, err = EncodeGob(value); err != nil {
 		return "", err
 	}
-	// 2. Encrypt (optional).
-	if b, err = encrypt(block, b); err != nil {
-		return "", err
-	}
-	b = encode(b)
-	// 3. Create MAC for "name|date|value". Extra pipe to be used later.
-	b = []byte(fmt.Sprintf("%s|%d|%s|", name, time.Now().UTC().Unix(), b))
-	h := hmac.New(sha1.New, []byte(hashKey))
-	h.Write(b)
-	sig := h.Sum(nil)
-	// Append mac, remove name.
-	b = append(b, sig...)[len(name)+1:]
-	// 4. Encode to base64.
-	b = encode(b)
+	// 2. Seal "name|date|" as additional data.
+	date := strconv.FormatInt(now.UTC().Unix(), 10)
+	nonce := generateRandomKey(key.aead.NonceSize())
+	b = key.aead.Seal(nonce, nonce, b, []byte(name+"|"+date+"|"))
+	// 3. Encode to base64.
+	b = encode(append([]byte(date+"|"), encode(b)...))
 	// Done.
 	return string(b), nil
 }
 
-func decodeCookie(block cipher.Block, hashKey, name, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
+// decodeCookie decodes value with the first key of keys able to open it,
+// keys are the keyring ordered from the newest, now is the time the cookie expires against.
+func decodeCookie(keys []*cookieKey, name, value string, gcmaxlifetime int64, now time.Time) (map[interface{}]interface{}, error) {
 	// 1. Decode from base64.
 	b, err := decode([]byte(value))
 	if err != nil {
 		return nil, err
 	}
-	// 2. Verify MAC. Value is "date|value|mac".
 	parts := bytes.SplitN(b, []byte("|"), 3)
-	if len(parts) != 3 {
+	if len(parts) == 3 {
+		return decodeLegacyCookie(keys, name, b, parts, gcmaxlifetime, now)
+	}
+	if len(parts) != 2 {
 		return nil, errors.New("Decode: invalid value format")
 	}
+	// 2. Verify date ranges.
+	if err = checkCookieDate(parts[0], gcmaxlifetime, now); err != nil {
+		return nil, err
+	}
+	// 3. Open with the keyring.
+	sealed, err := decode(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	ad := []byte(name + "|" + string(parts[0]) + "|")
+	for _, key := range keys {
+		size := key.aead.NonceSize()
+		if len(sealed) < size {
+			break
+		}
+		if b, err = key.aead.Open(nil, sealed[:size], sealed[size:], ad); err == nil {
+			// 4. DecodeGob.
+			return DecodeGob(b)
+		}
+	}
+	return nil, errors.New("Decode: the value is not valid")
+}
 
+// decodeLegacyCookie decodes a cookie encrypted in counter mode and signed with hmac-sha1,
+// b is the base64 decoded cookie "date|value|mac" split in parts.
+func decodeLegacyCookie(keys []*cookieKey, name string, b []byte, parts [][]byte, gcmaxlifetime int64, now time.Time) (map[interface{}]interface{}, error) {
+	// 1. Verify MAC.
 	b = append([]byte(name+"|"), b[:len(b)-len(parts[2])]...)
-	h := hmac.New(sha1.New, []byte(hashKey))
-	h.Write(b)
-	sig := h.Sum(nil)
-	if len(sig) != len(parts[2]) || subtle.ConstantTimeCompare(sig, parts[2]) != 1 {
+	var key *cookieKey
+	for _, k := range keys {
+		if k.block == nil {
+			continue
+		}
+		h := hmac.New(sha1.New, []byte(k.hashKey))
+		h.Write(b)
+		sig := h.Sum(nil)
+		if len(sig) == len(parts[2]) && subtle.ConstantTimeCompare(sig, parts[2]) == 1 {
+			key = k
+			break
+		}
+	}
+	if key == nil {
 		return nil, errors.New("Decode: the value is not valid")
 	}
-	// 3. Verify date ranges.
-	var t1 int64
-	if t1, err = strconv.ParseInt(string(parts[0]), 10, 64); err != nil {
-		return nil, errors.New("Decode: invalid timestamp")
-	}
-	t2 := time.Now().UTC().Unix()
-	if t1 > t2 {
-		return nil, errors.New("Decode: timestamp is too new")
-	}
-	if t1 < t2-gcmaxlifetime {
-		return nil, errors.New("Decode: expired timestamp")
+	// 2. Verify date ranges.
+	if err := checkCookieDate(parts[0], gcmaxlifetime, now); err != nil {
+		return nil, err
 	}
-	// 4. Decrypt (optional).
-	b, err = decode(parts[1])
+	// 3. Decrypt.
+	b, err := decode(parts[1])
 	if err != nil {
 		return nil, err
 	}
-	if b, err = decrypt(block, b); err != nil {
+	if b, err = decrypt(key.block, b); err != nil {
 		return nil, err
 	}
-	// 5. DecodeGob.
-	dst, err := DecodeGob(b)
+	// 4. DecodeGob.
+	return DecodeGob(b)
+}
+
+// checkCookieDate verifies the date of a cookie is in the gcmaxlifetime seconds before now.
+func checkCookieDate(date []byte, gcmaxlifetime int64, now time.Time) error {
+	t1, err := strconv.ParseInt(string(date), 10, 64)
 	if err != nil {
-		return nil, err
+		return errors.New("Decode: invalid timestamp")
+	}
+	t2 := now.UTC().Unix()
+	if t1 > t2 {
+		return errors.New("Decode: timestamp is too new")
+	}
+	if t1 < t2-gcmaxlifetime {
+		return errors.New("Decode: expired timestamp")
 	}
-	return dst, nil
+	return nil
 }
 
 // Encoding -------------------------------------------------------------------
@@ -22,7 +22,10 @@ import (
 	"net/textproto"
 	"net/url"
 	"os"
+	"sync"
 	"time"
+
+	"libs/clock"
 )
 
 // Store contains all data for one session process with specific id.
@@ -90,12 +93,39 @@ type ManagerConfig struct {
 	SessionNameInHTTPHeader string `json:"SessionNameInHTTPHeader"`
 	EnableSidInURLQuery     bool   `json:"EnableSidInURLQuery"`
 	SessionIDPrefix         string `json:"sessionIDPrefix"`
+	// DirtyTracking saves only the keys changed by a request with the providers
+	// implementing DirtyTrackingProvider, so concurrent requests keep each other's writes.
+	DirtyTracking bool `json:"dirtyTracking"`
+	// Serializer names the serializer used by the providers implementing
+	// SerializerProvider: gob, json, msgpack or one added with RegisterSerializer.
+	// the sessions saved with another serializer or with plain gob are still read.
+	Serializer string `json:"serializer"`
+	// IdleTimeout invalidates a session not used for this many seconds, 0 disables it.
+	IdleTimeout int64 `json:"idleTimeout"`
+	// AbsoluteTimeout invalidates a session this many seconds after it started, 0 disables it.
+	AbsoluteTimeout int64 `json:"absoluteTimeout"`
+	// FingerprintUserAgent invalidates a session used with another User-Agent.
+	FingerprintUserAgent bool `json:"fingerprintUserAgent"`
+	// FingerprintIPPrefix invalidates a session used from another network, given
+	// as the number of bits of the IPv4 address, IPv6 addresses are bound to their /64.
+	// the client address is the one of the connection. 0 disables it.
+	FingerprintIPPrefix int `json:"fingerprintIPPrefix"`
+	// MaxSessionsPerUser limits the sessions of a user bound with BindUser,
+	// the oldest ones are destroyed. 0 disables it.
+	MaxSessionsPerUser int `json:"maxSessionsPerUser"`
+	// ProviderUserIndex keeps the sessions of the users in the provider,
+	// shared by all the servers, instead of memory. see UserIndexProvider.
+	ProviderUserIndex bool `json:"providerUserIndex"`
 }
 
 // Manager contains Provider and its configuration.
 type Manager struct {
-	provider Provider
-	config   *ManagerConfig
+	provider  Provider
+	config    *ManagerConfig
+	index     UserIndex
+	hooksLock sync.RWMutex
+	hooks     []Hook
+	clock     clock.Clock
 }
 
 // NewManager Create new Manager with provider name and json config string.
@@ -132,6 +162,17 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 		}
 	}
 
+	if dp, ok := provider.(DirtyTrackingProvider); ok {
+		dp.SetDirtyTracking(cf.DirtyTracking)
+	}
+	if sp, ok := provider.(SerializerProvider); ok {
+		if err := sp.SetSerializer(cf.Serializer); err != nil {
+			return nil, err
+		}
+	} else if _, err := GetSerializer(cf.Serializer); cf.Serializer != "" && err != nil {
+		return nil, err
+	}
+
 	err := provider.SessionInit(cf.Maxlifetime, cf.ProviderConfig)
 	if err != nil {
 		return nil, err
@@ -141,10 +182,24 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 		cf.SessionIDLength = 16
 	}
 
-	return &Manager{
-		provider,
-		cf,
-	}, nil
+	manager := &Manager{
+		provider: provider,
+		config:   cf,
+		index:    NewMemoryUserIndex(),
+	}
+	if cf.ProviderUserIndex {
+		ip, ok := provider.(UserIndexProvider)
+		if !ok {
+			return nil, fmt.Errorf("session: provider %q has no user index", provideName)
+		}
+		manager.index = ip.UserIndex()
+	}
+	if en, ok := provider.(ExpiryNotifier); ok {
+		en.SetExpiredFunc(func(sid string) {
+			manager.emit(EventExpired, sid, "", "")
+		})
+	}
+	return manager, nil
 }
 
 // GetProvider return current manager's provider
@@ -189,14 +244,27 @@ func (manager *Manager) getSid(r *http.Request) (string, error) {
 
 // SessionStart generate or read the session id from http request.
 // if session id exists, return SessionStore with this id.
+// in a handler wrapped by Middleware it returns the session of the request.
 func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (session Store, err error) {
+	if store, ok := FromContext(r.Context()); ok {
+		return store, nil
+	}
 	sid, errs := manager.getSid(r)
 	if errs != nil {
 		return nil, errs
 	}
 
 	if sid != "" && manager.provider.SessionExist(sid) {
-		return manager.provider.SessionRead(sid)
+		session, err = manager.provider.SessionRead(sid)
+		if err != nil {
+			return nil, err
+		}
+		t := manager.checkSession(session, r)
+		if t == 0 {
+			return session, nil
+		}
+		// expired or used by another client, start a new session.
+		manager.invalidate(session, t)
 	}
 
 	// Generate a new session
@@ -209,6 +277,8 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 	if err != nil {
 		return nil, err
 	}
+	manager.initSession(session, r)
+	manager.emit(EventCreated, sid, "", "")
 	cookie := &http.Cookie{
 		Name:     manager.config.CookieName,
 		Value:    url.QueryEscape(sid),
@@ -247,7 +317,15 @@ func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sid, _ := url.QueryUnescape(cookie.Value)
-	manager.provider.SessionDestroy(sid)
+	var uid string
+	if h := holderFromContext(r.Context()); h != nil {
+		if store := h.get(); store != nil {
+			uid, _ = UserOf(store)
+		}
+		// the destroyed session must not be saved by Middleware.
+		h.set(nil)
+	}
+	manager.destroySession(sid, uid, EventDestroyed)
 	if manager.config.EnableSetCookie {
 		expiration := time.Now()
 		cookie = &http.Cookie{Name: manager.config.CookieName,
@@ -260,9 +338,15 @@ func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// SessionDestroy Destroy session by its id in http request cookie.
+// SessionDestroyBySessionId Destroy session by its id, it is removed from the sessions of its user.
 func (manager *Manager) SessionDestroyBySessionId(sid string) error {
-	return manager.provider.SessionDestroy(sid)
+	var uid string
+	if manager.provider.SessionExist(sid) {
+		if store, err := manager.provider.SessionRead(sid); err == nil {
+			uid, _ = UserOf(store)
+		}
+	}
+	return manager.destroySession(sid, uid, EventDestroyed)
 }
 
 // GetSessionStore Get SessionStore by its id.
@@ -279,6 +363,7 @@ func (manager *Manager) GC() {
 }
 
 // SessionRegenerateID Regenerate a session id for this SessionStore who's id is saving in http request.
+// in a handler wrapped by Middleware the new session replaces the one in the request context.
 func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Request) (session Store) {
 	sid, err := manager.sessionID()
 	if err != nil {
@@ -288,6 +373,7 @@ func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Reque
 	if err != nil || cookie.Value == "" {
 		//delete old cookie
 		session, _ = manager.provider.SessionRead(sid)
+		manager.emit(EventCreated, sid, "", "")
 		cookie = &http.Cookie{Name: manager.config.CookieName,
 			Value:    url.QueryEscape(sid),
 			Path:     "/",
@@ -298,6 +384,14 @@ func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Reque
 	} else {
 		oldsid, _ := url.QueryUnescape(cookie.Value)
 		session, _ = manager.provider.SessionRegenerate(oldsid, sid)
+		if session != nil {
+			uid, ok := UserOf(session)
+			if ok {
+				manager.index.Remove(uid, oldsid)
+				manager.index.Add(uid, sid)
+			}
+			manager.emit(EventRegenerated, sid, oldsid, uid)
+		}
 		cookie.Value = url.QueryEscape(sid)
 		cookie.HttpOnly = true
 		cookie.Path = "/"
@@ -315,10 +409,33 @@ func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Reque
 		r.Header.Set(manager.config.SessionNameInHTTPHeader, sid)
 		w.Header().Set(manager.config.SessionNameInHTTPHeader, sid)
 	}
+	if h := holderFromContext(r.Context()); h != nil && session != nil {
+		h.set(session)
+	}
 
 	return
 }
 
+// ClockProvider is implemented by the providers able to expire the sessions
+// with another clock than the system time, the memory and cookie providers.
+type ClockProvider interface {
+	Provider
+	SetClock(c clock.Clock)
+}
+
+// SetClock sets the clock of the timeouts, of the events and of the provider
+// if it implements ClockProvider, the system time by default.
+func (manager *Manager) SetClock(c clock.Clock) {
+	manager.clock = c
+	if cp, ok := manager.provider.(ClockProvider); ok {
+		cp.SetClock(c)
+	}
+}
+
+func (manager *Manager) now() time.Time {
+	return clock.Or(manager.clock).Now()
+}
+
 // GetActiveSession Get all active sessions count number.
 func (manager *Manager) GetActiveSession() int {
 	return manager.provider.SessionAll()
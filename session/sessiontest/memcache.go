@@ -0,0 +1,277 @@
+package sessiontest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"libs/clock"
+)
+
+// memcacheMaxRelative is the largest expiration in seconds memcache reads
+// as relative to now, larger ones are unix times.
+const memcacheMaxRelative = 60 * 60 * 24 * 30
+
+type memcacheItem struct {
+	value   []byte
+	flags   uint32
+	expires time.Time // zero when the item does not expire
+	cas     uint64
+}
+
+// Memcache is an in-memory memcache server speaking the text protocol
+// used by github.com/bradfitz/gomemcache: get, gets, set, add, replace,
+// cas, delete, touch, flush_all and version.
+type Memcache struct {
+	clock *clock.Fake
+	l     net.Listener
+	lock  sync.Mutex
+	items map[string]*memcacheItem
+	cas   uint64
+	conns map[net.Conn]bool
+}
+
+// NewMemcache starts a Memcache server on a local port, close it with Close.
+// the items expire with the time of c, or the system time if c is nil.
+func NewMemcache(c *clock.Fake) (*Memcache, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	m := &Memcache{clock: c, l: l, items: make(map[string]*memcacheItem), conns: make(map[net.Conn]bool)}
+	go m.serve()
+	return m, nil
+}
+
+// Addr returns the address of the server.
+func (m *Memcache) Addr() string {
+	return m.l.Addr().String()
+}
+
+// Close stops the server and closes its connections.
+func (m *Memcache) Close() error {
+	err := m.l.Close()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for conn := range m.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (m *Memcache) now() time.Time {
+	if m.clock != nil {
+		return m.clock.Now()
+	}
+	return time.Now()
+}
+
+func (m *Memcache) serve() {
+	for {
+		conn, err := m.l.Accept()
+		if err != nil {
+			return
+		}
+		m.lock.Lock()
+		m.conns[conn] = true
+		m.lock.Unlock()
+		go func() {
+			m.handle(bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)))
+			m.lock.Lock()
+			delete(m.conns, conn)
+			m.lock.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (m *Memcache) handle(rw *bufio.ReadWriter) {
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "get", "gets":
+			m.get(rw, args[1:], args[0] == "gets")
+		case "set", "add", "replace", "cas":
+			if err = m.store(rw, args); err != nil {
+				return
+			}
+		case "delete":
+			m.delete(rw, args[1:])
+		case "touch":
+			m.touch(rw, args[1:])
+		case "flush_all":
+			m.lock.Lock()
+			m.items = make(map[string]*memcacheItem)
+			m.lock.Unlock()
+			rw.WriteString("OK\r\n")
+		case "version":
+			rw.WriteString("VERSION 1.6.0\r\n")
+		default:
+			rw.WriteString("ERROR\r\n")
+		}
+		if err = rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// item returns the live item of key, the caller holds the lock.
+func (m *Memcache) item(key string) *memcacheItem {
+	it, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+	if !it.expires.IsZero() && !m.now().Before(it.expires) {
+		delete(m.items, key)
+		return nil
+	}
+	return it
+}
+
+// expires returns the expiry time of the expiration exptime of the protocol.
+func (m *Memcache) expires(exptime string) (time.Time, error) {
+	exp, err := strconv.ParseInt(exptime, 10, 64)
+	switch {
+	case err != nil:
+		return time.Time{}, err
+	case exp == 0:
+		return time.Time{}, nil
+	case exp < 0:
+		return m.now(), nil
+	case exp > memcacheMaxRelative:
+		return time.Unix(exp, 0), nil
+	}
+	return m.now().Add(time.Duration(exp) * time.Second), nil
+}
+
+func (m *Memcache) get(rw *bufio.ReadWriter, keys []string, withCas bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, key := range keys {
+		it := m.item(key)
+		if it == nil {
+			continue
+		}
+		if withCas {
+			fmt.Fprintf(rw, "VALUE %s %d %d %d\r\n", key, it.flags, len(it.value), it.cas)
+		} else {
+			fmt.Fprintf(rw, "VALUE %s %d %d\r\n", key, it.flags, len(it.value))
+		}
+		rw.Write(it.value)
+		rw.WriteString("\r\n")
+	}
+	rw.WriteString("END\r\n")
+}
+
+// store runs the storage command "<cmd> <key> <flags> <exptime> <bytes> [<cas>] [noreply]".
+func (m *Memcache) store(rw *bufio.ReadWriter, args []string) error {
+	n := 5
+	if args[0] == "cas" {
+		n = 6
+	}
+	if len(args) < n {
+		rw.WriteString("ERROR\r\n")
+		return nil
+	}
+	size, err := strconv.Atoi(args[4])
+	if err != nil || size < 0 {
+		rw.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return nil
+	}
+	value := make([]byte, size+2)
+	if _, err = io.ReadFull(rw, value); err != nil {
+		return err
+	}
+	flags, err := strconv.ParseUint(args[2], 10, 32)
+	if err != nil {
+		rw.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+	expires, err := m.expires(args[3])
+	if err != nil {
+		rw.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return nil
+	}
+	noreply := len(args) > n && args[n] == "noreply"
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := args[1]
+	it := m.item(key)
+	reply := "STORED"
+	switch args[0] {
+	case "add":
+		if it != nil {
+			reply = "NOT_STORED"
+		}
+	case "replace":
+		if it == nil {
+			reply = "NOT_STORED"
+		}
+	case "cas":
+		if it == nil {
+			reply = "NOT_FOUND"
+		} else if args[5] != strconv.FormatUint(it.cas, 10) {
+			reply = "EXISTS"
+		}
+	}
+	if reply == "STORED" {
+		m.cas++
+		m.items[key] = &memcacheItem{value: value[:size], flags: uint32(flags), expires: expires, cas: m.cas}
+	}
+	if !noreply {
+		rw.WriteString(reply + "\r\n")
+	}
+	return nil
+}
+
+func (m *Memcache) delete(rw *bufio.ReadWriter, args []string) {
+	if len(args) == 0 {
+		rw.WriteString("ERROR\r\n")
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	reply := "NOT_FOUND"
+	if m.item(args[0]) != nil {
+		delete(m.items, args[0])
+		reply = "DELETED"
+	}
+	if len(args) < 2 || args[len(args)-1] != "noreply" {
+		rw.WriteString(reply + "\r\n")
+	}
+}
+
+func (m *Memcache) touch(rw *bufio.ReadWriter, args []string) {
+	if len(args) < 2 {
+		rw.WriteString("ERROR\r\n")
+		return
+	}
+	expires, err := m.expires(args[1])
+	if err != nil {
+		rw.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	reply := "NOT_FOUND"
+	if it := m.item(args[0]); it != nil {
+		it.expires = expires
+		reply = "TOUCHED"
+	}
+	if len(args) < 3 || args[2] != "noreply" {
+		rw.WriteString(reply + "\r\n")
+	}
+}
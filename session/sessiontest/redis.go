@@ -0,0 +1,28 @@
+package sessiontest
+
+import (
+	"github.com/alicebob/miniredis/v2"
+
+	"libs/clock"
+)
+
+// NewRedis starts an in-memory redis server, close it with Close.
+// the keys expire when c is moved forward, c may be nil.
+// usage:
+//	s, err := sessiontest.NewRedis(c)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//	p := &session.RedisProvider{}
+//	p.SessionInit(3600, s.Addr())
+func NewRedis(c *clock.Fake) (*miniredis.Miniredis, error) {
+	s, err := miniredis.Run()
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		c.OnAdvance(s.FastForward)
+	}
+	return s, nil
+}
@@ -0,0 +1,291 @@
+// Package sessiontest runs any session.Provider through the behaviours
+// shared by the providers, with in-memory redis and memcache servers to
+// test their providers without the services. the expiry is tested by
+// moving a clock.Fake forward.
+//
+// Usage:
+//	func TestRedisProvider(t *testing.T) {
+//		c := clock.NewFake(time.Now())
+//		s, err := sessiontest.NewRedis(c)
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		defer s.Close()
+//		p := &session.RedisProvider{}
+//		if err = p.SessionInit(3600, s.Addr()); err != nil {
+//			t.Fatal(err)
+//		}
+//		sessiontest.Run(t, p, sessiontest.Options{Maxlifetime: 3600, Clock: c, NoCount: true})
+//	}
+package sessiontest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"libs/clock"
+	"libs/session"
+)
+
+// Options describes the provider run by Run.
+type Options struct {
+	// Maxlifetime is the maxlifetime in seconds the provider was initialized with.
+	Maxlifetime int64
+	// Clock is the clock of the provider, set with session.ClockProvider or
+	// clock.Fake.OnAdvance. the expiry tests are skipped when it is nil.
+	Clock *clock.Fake
+	// NoCount is set for the providers whose SessionAll does not count the sessions.
+	NoCount bool
+}
+
+// Run runs the behaviours shared by every provider on p, initialized with
+// SessionInit by the caller.
+func Run(t *testing.T, p session.Provider, opts Options) {
+	t.Run("ReadWrite", func(t *testing.T) { testReadWrite(t, p) })
+	t.Run("Regenerate", func(t *testing.T) { testRegenerate(t, p) })
+	t.Run("RegenerateMissing", func(t *testing.T) { testRegenerateMissing(t, p) })
+	t.Run("Destroy", func(t *testing.T) { testDestroy(t, p) })
+	t.Run("Count", func(t *testing.T) { testCount(t, p, opts) })
+	t.Run("GC", func(t *testing.T) { testGC(t, p) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, p) })
+	t.Run("Expiry", func(t *testing.T) { testExpiry(t, p, opts) })
+}
+
+// newSid returns a random session id.
+func newSid(t *testing.T) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// save reads the session sid, sets values in it and releases it.
+func save(t *testing.T, p session.Provider, sid string, values map[string]string) {
+	sess, err := p.SessionRead(sid)
+	if err != nil {
+		t.Fatal("read error", err)
+	}
+	for k, v := range values {
+		if err = sess.Set(k, v); err != nil {
+			t.Fatal("set error", err)
+		}
+	}
+	sess.SessionRelease(httptest.NewRecorder())
+}
+
+// check reads the session sid and verifies it holds values.
+func check(t *testing.T, p session.Provider, sid string, values map[string]string) {
+	sess, err := p.SessionRead(sid)
+	if err != nil {
+		t.Fatal("read error", err)
+	}
+	if sess.SessionID() != sid {
+		t.Fatal("session id error", sess.SessionID())
+	}
+	for k, v := range values {
+		if got := sess.Get(k); got != v {
+			t.Fatalf("get %s error: %v, want %v", k, got, v)
+		}
+	}
+}
+
+func testReadWrite(t *testing.T, p session.Provider) {
+	sid := newSid(t)
+	defer p.SessionDestroy(sid)
+
+	sess, err := p.SessionRead(sid)
+	if err != nil {
+		t.Fatal("read error", err)
+	}
+	if sess.SessionID() != sid || sess.Get("username") != nil {
+		t.Fatal("new session error", sess.SessionID())
+	}
+	save(t, p, sid, map[string]string{"username": "user001", "theme": "dark"})
+	if !p.SessionExist(sid) {
+		t.Fatal("released session does not exist")
+	}
+	check(t, p, sid, map[string]string{"username": "user001", "theme": "dark"})
+
+	if sess, err = p.SessionRead(sid); err != nil {
+		t.Fatal("read error", err)
+	}
+	sess.Delete("theme")
+	sess.Set("username", "user002")
+	sess.SessionRelease(httptest.NewRecorder())
+	check(t, p, sid, map[string]string{"username": "user002"})
+	if sess, _ = p.SessionRead(sid); sess.Get("theme") != nil {
+		t.Fatal("deleted value read", sess.Get("theme"))
+	}
+
+	sess.Flush()
+	if sess.Get("username") != nil {
+		t.Fatal("flush error")
+	}
+	sess.SessionRelease(httptest.NewRecorder())
+	if sess, _ = p.SessionRead(sid); sess.Get("username") != nil {
+		t.Fatal("flushed value read", sess.Get("username"))
+	}
+}
+
+func testRegenerate(t *testing.T, p session.Provider) {
+	sid, newsid := newSid(t), newSid(t)
+	defer p.SessionDestroy(newsid)
+
+	save(t, p, sid, map[string]string{"username": "user001"})
+	sess, err := p.SessionRegenerate(sid, newsid)
+	if err != nil {
+		t.Fatal("regenerate error", err)
+	}
+	if sess.SessionID() != newsid || sess.Get("username") != "user001" {
+		t.Fatal("regenerated session error", sess.SessionID(), sess.Get("username"))
+	}
+	sess.SessionRelease(httptest.NewRecorder())
+	if p.SessionExist(sid) {
+		t.Fatal("old session still exists after regenerate")
+	}
+	check(t, p, newsid, map[string]string{"username": "user001"})
+}
+
+func testRegenerateMissing(t *testing.T, p session.Provider) {
+	sid, newsid := newSid(t), newSid(t)
+	defer p.SessionDestroy(newsid)
+
+	sess, err := p.SessionRegenerate(sid, newsid)
+	if err != nil {
+		t.Fatal("regenerate error", err)
+	}
+	if sess.SessionID() != newsid || sess.Get("username") != nil {
+		t.Fatal("regenerated session error", sess.SessionID(), sess.Get("username"))
+	}
+	sess.SessionRelease(httptest.NewRecorder())
+	if !p.SessionExist(newsid) {
+		t.Fatal("regenerated session does not exist")
+	}
+}
+
+func testDestroy(t *testing.T, p session.Provider) {
+	sid := newSid(t)
+	save(t, p, sid, map[string]string{"username": "user001"})
+	if err := p.SessionDestroy(sid); err != nil {
+		t.Fatal("destroy error", err)
+	}
+	if p.SessionExist(sid) {
+		t.Fatal("destroyed session still exists")
+	}
+	if sess, _ := p.SessionRead(sid); sess.Get("username") != nil {
+		t.Fatal("destroyed session read", sess.Get("username"))
+	}
+}
+
+func testCount(t *testing.T, p session.Provider, opts Options) {
+	if opts.NoCount {
+		t.Skip("the provider does not count its sessions")
+	}
+	sid := newSid(t)
+	defer p.SessionDestroy(sid)
+
+	before := p.SessionAll()
+	save(t, p, sid, map[string]string{"username": "user001"})
+	if got := p.SessionAll(); got != before+1 {
+		t.Fatalf("session count error: %d, want %d", got, before+1)
+	}
+}
+
+func testGC(t *testing.T, p session.Provider) {
+	sid := newSid(t)
+	defer p.SessionDestroy(sid)
+
+	save(t, p, sid, map[string]string{"username": "user001"})
+	p.SessionGC()
+	if !p.SessionExist(sid) {
+		t.Fatal("gc removed a live session")
+	}
+	check(t, p, sid, map[string]string{"username": "user001"})
+}
+
+func testConcurrent(t *testing.T, p session.Provider) {
+	const n = 10
+	sids := make([]string, n)
+	for i := range sids {
+		sids[i] = newSid(t)
+		defer p.SessionDestroy(sids[i])
+	}
+
+	// sessions used at the same time.
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i, sid := range sids {
+		wg.Add(1)
+		go func(i int, sid string) {
+			defer wg.Done()
+			sess, err := p.SessionRead(sid)
+			if err != nil {
+				errs <- err
+				return
+			}
+			sess.Set("n", fmt.Sprint(i))
+			sess.SessionRelease(httptest.NewRecorder())
+			if sess, err = p.SessionRead(sid); err != nil {
+				errs <- err
+			} else if got := sess.Get("n"); got != fmt.Sprint(i) {
+				errs <- fmt.Errorf("session %d read %v", i, got)
+			}
+		}(i, sid)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// a session used by several goroutines.
+	sess, err := p.SessionRead(sids[0])
+	if err != nil {
+		t.Fatal("read error", err)
+	}
+	values := make(map[string]string)
+	for i := 0; i < n; i++ {
+		k, v := fmt.Sprint("key", i), fmt.Sprint(i)
+		values[k] = v
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sess.Set(k, v)
+			sess.Get(k)
+		}()
+	}
+	wg.Wait()
+	sess.SessionRelease(httptest.NewRecorder())
+	check(t, p, sids[0], values)
+}
+
+func testExpiry(t *testing.T, p session.Provider, opts Options) {
+	if opts.Clock == nil {
+		t.Skip("no clock for the provider")
+	}
+	sid := newSid(t)
+	defer p.SessionDestroy(sid)
+
+	save(t, p, sid, map[string]string{"username": "user001"})
+	lifetime := time.Duration(opts.Maxlifetime) * time.Second
+	opts.Clock.Advance(lifetime / 2)
+	p.SessionGC()
+	if !p.SessionExist(sid) {
+		t.Fatal("session expired before maxlifetime")
+	}
+
+	opts.Clock.Advance(lifetime/2 + 2*time.Second)
+	p.SessionGC()
+	if p.SessionExist(sid) {
+		t.Fatal("session still exists after maxlifetime")
+	}
+	if sess, _ := p.SessionRead(sid); sess.Get("username") != nil {
+		t.Fatal("expired session read", sess.Get("username"))
+	}
+}
@@ -0,0 +1,274 @@
+package sessiontest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"libs/clock"
+	"libs/internal/sqlitedb"
+	"libs/session"
+)
+
+func TestMemProvider(t *testing.T) {
+	p, err := session.GetProvider("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.SessionInit(3600, ""); err != nil {
+		t.Fatal(err)
+	}
+	c := clock.NewFake(time.Now())
+	p.(session.ClockProvider).SetClock(c)
+	defer p.(session.ClockProvider).SetClock(nil)
+	Run(t, p, Options{Maxlifetime: 3600, Clock: c})
+}
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p, err := session.GetProvider("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.SessionInit(3600, dir); err != nil {
+		t.Fatal(err)
+	}
+	Run(t, p, Options{Maxlifetime: 3600})
+}
+
+func TestRedisProvider(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	s, err := NewRedis(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	p := &session.RedisProvider{}
+	if err = p.SessionInit(3600, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	Run(t, p, Options{Maxlifetime: 3600, Clock: c, NoCount: true})
+	p.SetDirtyTracking(true)
+	Run(t, p, Options{Maxlifetime: 3600, Clock: c, NoCount: true})
+}
+
+func TestMemcacheProvider(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	s, err := NewMemcache(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	p := &session.MemcacheProvider{}
+	if err = p.SessionInit(3600, s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	Run(t, p, Options{Maxlifetime: 3600, Clock: c, NoCount: true})
+}
+
+func TestPostgresqlProvider(t *testing.T) {
+	dsn := "postgres://postgres@127.0.0.1:5432/test?sslmode=disable"
+	p := &session.PostgresqlProvider{}
+	if err := p.SessionInit(3600, dsn); err != nil {
+		t.Skip(err)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS " + session.PostgresTableName + ` (
+		session_key varchar(64) NOT NULL PRIMARY KEY,
+		session_data bytea,
+		session_expiry bigint NOT NULL,
+		session_version integer NOT NULL DEFAULT 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Run(t, p, Options{Maxlifetime: 3600})
+	p.SetDirtyTracking(true)
+	Run(t, p, Options{Maxlifetime: 3600})
+}
+
+func TestSqliteProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := &session.SqliteProvider{}
+	if err = p.SessionInit(3600, filepath.Join(dir, "session.db")); err != nil {
+		t.Fatal(err)
+	}
+	c := clock.NewFake(time.Now())
+	p.SetClock(c)
+	Run(t, p, Options{Maxlifetime: 3600, Clock: c})
+}
+
+// cookieJar keeps the cookies of the cookie provider as a browser does,
+// so the sessions are found by their id.
+type cookieJar struct {
+	session.Provider
+	lock    sync.Mutex
+	cookies map[string]string
+}
+
+// cookieStore is a session read from the cookie of sid.
+type cookieStore struct {
+	session.Store
+	jar *cookieJar
+	sid string
+}
+
+func (st *cookieStore) SessionID() string {
+	return st.sid
+}
+
+// SessionRelease keeps the cookie sent to the browser.
+func (st *cookieStore) SessionRelease(w http.ResponseWriter) {
+	rec := httptest.NewRecorder()
+	st.Store.SessionRelease(rec)
+	for _, c := range rec.Result().Cookies() {
+		if v, err := url.QueryUnescape(c.Value); err == nil {
+			st.jar.lock.Lock()
+			st.jar.cookies[st.sid] = v
+			st.jar.lock.Unlock()
+		}
+	}
+}
+
+func (j *cookieJar) SessionRead(sid string) (session.Store, error) {
+	j.lock.Lock()
+	cookie := j.cookies[sid]
+	j.lock.Unlock()
+	sess, err := j.Provider.SessionRead(cookie)
+	if err != nil {
+		return nil, err
+	}
+	return &cookieStore{Store: sess, jar: j, sid: sid}, nil
+}
+
+func (j *cookieJar) SessionExist(sid string) bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	_, ok := j.cookies[sid]
+	return ok
+}
+
+func (j *cookieJar) SessionRegenerate(oldsid, sid string) (session.Store, error) {
+	j.lock.Lock()
+	if cookie, ok := j.cookies[oldsid]; ok {
+		j.cookies[sid] = cookie
+		delete(j.cookies, oldsid)
+	}
+	j.lock.Unlock()
+	return j.SessionRead(sid)
+}
+
+func (j *cookieJar) SessionDestroy(sid string) error {
+	j.lock.Lock()
+	delete(j.cookies, sid)
+	j.lock.Unlock()
+	return nil
+}
+
+func TestCookieProvider(t *testing.T) {
+	p, err := session.GetProvider("cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.SessionInit(3600, `{"cookieName":"gosessionid","securityKey":"beegocookiehashkey"}`); err != nil {
+		t.Fatal(err)
+	}
+	Run(t, &cookieJar{Provider: p, cookies: make(map[string]string)}, Options{Maxlifetime: 3600, NoCount: true})
+}
+
+// mysqlDriver runs the statements of the mysql provider on sqlite,
+// which reads the backquoted names of mysql.
+type mysqlDriver struct {
+	driver.Driver
+}
+
+func (d mysqlDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return mysqlConn{c}, nil
+}
+
+type mysqlConn struct {
+	driver.Conn
+}
+
+// sqliteQuery rewrites the mysql syntax unknown to sqlite,
+// sqlite locking the whole database in a write transaction.
+func sqliteQuery(query string) string {
+	query = strings.Replace(query, " for update", "", 1)
+	return strings.Replace(query, "insert ignore", "insert or ignore", 1)
+}
+
+func (c mysqlConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(sqliteQuery(query))
+}
+
+func (c mysqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, sqliteQuery(query), args)
+}
+
+func (c mysqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, sqliteQuery(query), args)
+}
+
+func (c mysqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func TestMysqlProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dsn := "file:" + filepath.Join(dir, "mysql.db") + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open(sqlitedb.DriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE " + session.TableName + ` (
+		session_key varchar(64) NOT NULL PRIMARY KEY,
+		session_data blob,
+		session_expiry integer NOT NULL,
+		session_version integer NOT NULL DEFAULT 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql.Register("sessiontest-mysql", mysqlDriver{db.Driver()})
+	defer func(name string) { session.MysqlDriverName = name }(session.MysqlDriverName)
+	session.MysqlDriverName = "sessiontest-mysql"
+
+	p := &session.MysqlProvider{}
+	if err = p.SessionInit(3600, dsn); err != nil {
+		t.Fatal(err)
+	}
+	// the gc runs in a transaction when the expired sessions are wanted.
+	p.SetExpiredFunc(func(sid string) {})
+	Run(t, p, Options{Maxlifetime: 3600})
+	p.SetDirtyTracking(true)
+	Run(t, p, Options{Maxlifetime: 3600})
+}
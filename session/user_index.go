@@ -0,0 +1,103 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	rediss "github.com/go-redis/redis"
+)
+
+// UserIndex records the sessions of each user bound with Manager.BindUser,
+// for ManagerConfig.MaxSessionsPerUser and Manager.LogoutOtherDevices.
+// the default index is in memory, share one between the servers of a cluster
+// with Manager.SetUserIndex.
+type UserIndex interface {
+	// Add records the session sid of the user uid.
+	Add(uid, sid string) error
+	// Remove forgets the session sid of the user uid.
+	Remove(uid, sid string) error
+	// Sessions returns the sessions of the user uid, the oldest first.
+	Sessions(uid string) ([]string, error)
+}
+
+// MemoryUserIndex keeps the sessions of the users in memory.
+type MemoryUserIndex struct {
+	lock  sync.Mutex
+	users map[string][]string // in the order they were added
+}
+
+// NewMemoryUserIndex returns an empty MemoryUserIndex.
+func NewMemoryUserIndex() *MemoryUserIndex {
+	return &MemoryUserIndex{users: make(map[string][]string)}
+}
+
+// Add records the session sid of the user uid.
+func (mi *MemoryUserIndex) Add(uid, sid string) error {
+	mi.lock.Lock()
+	defer mi.lock.Unlock()
+	for _, s := range mi.users[uid] {
+		if s == sid {
+			return nil
+		}
+	}
+	mi.users[uid] = append(mi.users[uid], sid)
+	return nil
+}
+
+// Remove forgets the session sid of the user uid.
+func (mi *MemoryUserIndex) Remove(uid, sid string) error {
+	mi.lock.Lock()
+	defer mi.lock.Unlock()
+	sids := mi.users[uid]
+	for i, s := range sids {
+		if s == sid {
+			sids = append(sids[:i:i], sids[i+1:]...)
+			break
+		}
+	}
+	if len(sids) == 0 {
+		delete(mi.users, uid)
+	} else {
+		mi.users[uid] = sids
+	}
+	return nil
+}
+
+// Sessions returns the sessions of the user uid, the oldest first.
+func (mi *MemoryUserIndex) Sessions(uid string) ([]string, error) {
+	mi.lock.Lock()
+	defer mi.lock.Unlock()
+	return append([]string(nil), mi.users[uid]...), nil
+}
+
+// UserIndexProvider is implemented by the providers able to keep the user index
+// next to the sessions, the redis, redis_cluster, redis_sentinel and mysql providers.
+// it is used with ManagerConfig.ProviderUserIndex.
+type UserIndexProvider interface {
+	Provider
+	UserIndex() UserIndex
+}
+
+// goRedisUserIndex is RedisUserIndex for the go-redis clients
+// of the redis_cluster and redis_sentinel providers.
+type goRedisUserIndex struct {
+	c           rediss.Cmdable
+	maxlifetime int64
+}
+
+func (ri *goRedisUserIndex) Add(uid, sid string) error {
+	key := RedisUserIndexPrefix + uid
+	pipe := ri.c.TxPipeline()
+	pipe.ZAdd(key, rediss.Z{Score: float64(time.Now().UnixNano() / int64(time.Millisecond)), Member: sid})
+	pipe.Expire(key, time.Duration(ri.maxlifetime)*time.Second)
+	_, err := pipe.Exec()
+	return err
+}
+
+func (ri *goRedisUserIndex) Remove(uid, sid string) error {
+	return ri.c.ZRem(RedisUserIndexPrefix+uid, sid).Err()
+}
+
+func (ri *goRedisUserIndex) Sessions(uid string) ([]string, error) {
+	return ri.c.ZRange(RedisUserIndexPrefix+uid, 0, -1).Result()
+}